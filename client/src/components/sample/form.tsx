@@ -120,9 +120,22 @@ function SampleForm() {
   //   fetchList()
   // }, [])
 
-  useBroadcast<Feedback>("feedback.create", fetchList, console.error)
-  useBroadcast<Payload>("feedback.update", fetchList, console.error)
-  useBroadcast<Payload>("feedback.delete", fetchList, console.error)
+  // The collection wide feedback topics are for administrators; users follow
+  // the feedback they are editing by its id and refetch after their own writes
+  const selectedId = selectedFeedback?.id
+  const refreshSelected = () => {
+    fetchList()
+    if (selectedId) {
+      fetchFeedback(selectedId)
+    }
+  }
+  const clearSelected = () => {
+    fetchList()
+    form.reset()
+    setSelectedFeedback(null)
+  }
+  useBroadcast<Payload>(selectedId && `feedback.update.${selectedId}`, refreshSelected, console.error)
+  useBroadcast<Payload>(selectedId && `feedback.delete.${selectedId}`, clearSelected, console.error)
 
   return (
     <div className="p-6 max-w-xxl mx-auto">
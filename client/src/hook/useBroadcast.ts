@@ -1,58 +1,43 @@
 import { useEffect } from "react";
-import { connect, StringCodec, type NatsConnection, type Subscription } from "nats.ws";
 
-import axios from 'axios'
+// Frame relayed by the server's broadcast gateway; data is the event payload
+interface BroadcastFrame<T> {
+  type: string
+  topic: string
+  id?: string
+  event?: string
+  occurred_at?: string
+  data: T
+}
+
+// useBroadcast follows subject while it is set; the server only relays the
+// topics its topic policy lets the signed in user subscribe to
 export function useBroadcast<T = any>(
-  subject: string,
+  subject: string | undefined,
   onMessage: (message: T) => void,
   onError: (error: Error) => void
 ): void {
-  const health = async () => {
-      try {
-        const res = await axios.get(
-          `${import.meta.env.VITE_SERVER_URL}/health`,
-          { withCredentials: true }
-        )
-        console.log("Health:", res.data)
-      } catch (error) {
-        console.error("Get Error:", error)
-      }
-    }
   useEffect(() => {
-    let isCancelled = false;
-    let nc: NatsConnection;
-    let sub: Subscription;
-
-    async function connectSocket() {
-      try {
-        await health()
-        const sc = StringCodec();
-        nc = await connect({ servers: import.meta.env.VITE_BROADCAST_URL });
-        sub = nc.subscribe(subject);
+    if (!subject) {
+      return
+    }
+    const url = new URL(`${import.meta.env.VITE_SERVER_URL}/broadcast/events`)
+    url.searchParams.append("topic", subject)
 
-        (async () => {
-          for await (const msg of sub) {
-            if (isCancelled) break;
-            const decoded = sc.decode(msg.data);
-            const parsed = JSON.parse(decoded) as T;
-            onMessage(parsed);
-          }
-        })();
+    // The gateway authenticates with the user token cookie, hence withCredentials
+    const source = new EventSource(url, { withCredentials: true })
 
-        console.log(`connected to: ${subject}`);
-      } catch (err: any) {
-        if (!isCancelled) {
-          onError(err);
-        }
+    source.addEventListener("message", (event) => {
+      const frame = JSON.parse((event as MessageEvent).data) as BroadcastFrame<T>
+      onMessage(frame.data)
+    })
+    source.onopen = () => console.log(`connected to: ${subject}`)
+    source.onerror = () => {
+      if (source.readyState === EventSource.CLOSED) {
+        onError(new Error(`broadcast of ${subject} closed`))
       }
     }
 
-    connectSocket();
-
-    return () => {
-      isCancelled = true;
-      if (sub) sub.unsubscribe();
-      if (nc) nc.close();
-    };
-  },[]);
+    return () => source.close()
+  }, [subject]);
 }
@@ -27,7 +27,13 @@ func main() {
 			model.NewMediaCollection,
 			model.NewFeedbackCollection,
 		),
-		fx.Invoke(func(lc fx.Lifecycle, controller *controller.Controller, provider *src.Provider) error {
+		fx.Invoke(func(
+			lc fx.Lifecycle,
+			controller *controller.Controller,
+			provider *src.Provider,
+			media *model.MediaCollection,
+			feedback *model.FeedbackCollection,
+		) error {
 			lc.Append(fx.Hook{
 				OnStart: func(ctx context.Context) error {
 					controller.Routes()
@@ -41,6 +47,12 @@ func main() {
 					); err != nil {
 						return err
 					}
+					if err := media.Manager.Migrate(ctx); err != nil {
+						return err
+					}
+					if err := feedback.Manager.Migrate(ctx); err != nil {
+						return err
+					}
 					return nil
 				},
 				OnStop: func(ctx context.Context) error {
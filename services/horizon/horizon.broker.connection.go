@@ -0,0 +1,296 @@
+package horizon
+
+import (
+	"context"
+	"crypto/tls"
+	"math/rand/v2"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rotisserie/eris"
+)
+
+/*
+broker := horizon.NewHorizonMessageBroker("nats.internal", 4222, horizon.BrokerOptions{
+	Username:      "horizon",
+	Password:      "secret",
+	TLSCAFile:     "/etc/nats/ca.pem",
+	MaxReconnects: -1,
+})
+
+status := broker.Status()
+err := broker.Ping(ctx)
+*/
+
+// BrokerOptions configures how HorizonMessageBroker connects to NATS and
+// recovers a dropped connection. Publishes made while reconnecting are buffered
+// and flushed once the connection is back.
+type BrokerOptions struct {
+	// Name identifies the connection in the NATS monitoring endpoints
+	Name string
+
+	// The first of CredentialsFile, NKeySeedFile, Token and Username with Password
+	// that is set authenticates the connection; the credentials file holds a user
+	// JWT and its NKey seed
+	Token           string
+	Username        string
+	Password        string
+	NKeySeedFile    string
+	CredentialsFile string
+
+	// TLS requires a TLS connection, which TLSCAFile and the client certificate
+	// of TLSCertFile and TLSKeyFile also imply
+	TLS         bool
+	TLSCAFile   string
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// ConnectTimeout bounds the dial of each server, 2s by default
+	ConnectTimeout time.Duration
+
+	// MaxReconnects bounds the attempts to reconnect after the connection drops;
+	// zero keeps the NATS default of 60 and a negative value retries forever
+	MaxReconnects int
+
+	// ReconnectWait is the delay before the first reconnect attempt, 2s by default.
+	// It doubles with each failed attempt up to MaxReconnectWait, 30s by default.
+	ReconnectWait    time.Duration
+	MaxReconnectWait time.Duration
+
+	// ReconnectBufferSize bounds the bytes of publishes buffered while
+	// reconnecting; zero keeps the NATS default of 8MB and a negative value makes
+	// them fail right away
+	ReconnectBufferSize int
+
+	// PingInterval is how often the server is pinged to detect a stale connection, 2m by default
+	PingInterval time.Duration
+}
+
+// ErrBrokerReconnected is reported through the error hook when a dropped
+// connection comes back, so that recoveries are logged next to the failures
+var ErrBrokerReconnected = eris.New("broker reconnected to NATS")
+
+// BrokerState is the state of the connection of a broker
+type BrokerState string
+
+const (
+	BrokerConnected    BrokerState = "connected"
+	BrokerReconnecting BrokerState = "reconnecting"
+	BrokerDisconnected BrokerState = "disconnected"
+	BrokerClosed       BrokerState = "closed"
+)
+
+// BrokerStatus describes the connection of a broker, as reported by Status
+type BrokerStatus struct {
+	State BrokerState `json:"state"`
+
+	// Server is the URL of the connected server, without credentials
+	Server string `json:"server,omitempty"`
+
+	// Reconnects counts the reconnections since Run
+	Reconnects uint64 `json:"reconnects"`
+
+	// Buffered is the bytes of publishes waiting for the connection to come back
+	Buffered int `json:"buffered"`
+
+	// LastError is the reason the connection last dropped or failed
+	LastError string `json:"last_error,omitempty"`
+
+	// Since is when the connection entered State
+	Since time.Time `json:"since"`
+}
+
+var (
+	brokerConnected = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "horizon_broker_connected",
+		Help: "1 while the message broker is connected to NATS, 0 otherwise.",
+	})
+	brokerConnectionEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "horizon_broker_connection_events_total",
+		Help: "Connection events of the message broker: disconnected, reconnected, closed and error.",
+	}, []string{"event"})
+)
+
+// natsOptions returns the connection options of the broker, with the handlers
+// recording its state
+func (h *HorizonMessageBroker) natsOptions() ([]nats.Option, error) {
+	options := h.options
+	natsOptions := []nats.Option{
+		nats.DisconnectErrHandler(h.disconnected),
+		nats.ReconnectHandler(h.reconnected),
+		nats.ClosedHandler(h.closed),
+		nats.ErrorHandler(h.asyncError),
+		nats.CustomReconnectDelay(options.reconnectDelay),
+	}
+	if options.Name != "" {
+		natsOptions = append(natsOptions, nats.Name(options.Name))
+	}
+	switch {
+	case options.CredentialsFile != "":
+		natsOptions = append(natsOptions, nats.UserCredentials(options.CredentialsFile))
+	case options.NKeySeedFile != "":
+		nkey, err := nats.NkeyOptionFromSeed(options.NKeySeedFile)
+		if err != nil {
+			return nil, eris.Wrap(err, "failed to load NATS NKey seed")
+		}
+		natsOptions = append(natsOptions, nkey)
+	case options.Token != "":
+		natsOptions = append(natsOptions, nats.Token(options.Token))
+	case options.Username != "":
+		natsOptions = append(natsOptions, nats.UserInfo(options.Username, options.Password))
+	}
+	if options.TLS {
+		natsOptions = append(natsOptions, nats.Secure(&tls.Config{MinVersion: tls.VersionTLS12}))
+	}
+	if options.TLSCAFile != "" {
+		natsOptions = append(natsOptions, nats.RootCAs(options.TLSCAFile))
+	}
+	if options.TLSCertFile != "" || options.TLSKeyFile != "" {
+		natsOptions = append(natsOptions, nats.ClientCert(options.TLSCertFile, options.TLSKeyFile))
+	}
+	if options.ConnectTimeout > 0 {
+		natsOptions = append(natsOptions, nats.Timeout(options.ConnectTimeout))
+	}
+	if options.MaxReconnects != 0 {
+		natsOptions = append(natsOptions, nats.MaxReconnects(options.MaxReconnects))
+	}
+	if options.ReconnectBufferSize != 0 {
+		natsOptions = append(natsOptions, nats.ReconnectBufSize(options.ReconnectBufferSize))
+	}
+	if options.PingInterval > 0 {
+		natsOptions = append(natsOptions, nats.PingInterval(options.PingInterval))
+	}
+	return natsOptions, nil
+}
+
+// reconnectDelay backs off exponentially from ReconnectWait to MaxReconnectWait,
+// with up to 20% of jitter so that instances do not reconnect all at once
+func (o BrokerOptions) reconnectDelay(attempts int) time.Duration {
+	delay := o.ReconnectWait
+	if delay <= 0 {
+		delay = nats.DefaultReconnectWait
+	}
+	maxDelay := o.MaxReconnectWait
+	if maxDelay <= 0 {
+		maxDelay = 30 * time.Second
+	}
+	for i := 1; i < attempts && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, maxDelay)
+	return delay + rand.N(delay/5+1)
+}
+
+// disconnected records that the connection dropped; NATS keeps reconnecting
+func (h *HorizonMessageBroker) disconnected(nc *nats.Conn, err error) {
+	brokerConnected.Set(0)
+	brokerConnectionEvents.WithLabelValues("disconnected").Inc()
+	h.setState(err)
+	if err != nil {
+		h.reportError("", eris.Wrap(err, "broker disconnected from NATS"))
+	}
+}
+
+// reconnected records that the connection is back
+func (h *HorizonMessageBroker) reconnected(nc *nats.Conn) {
+	brokerConnected.Set(1)
+	brokerConnectionEvents.WithLabelValues("reconnected").Inc()
+	h.setState(nil)
+	h.reportError("", eris.Wrapf(ErrBrokerReconnected, "connection to %s restored", nc.ConnectedUrlRedacted()))
+}
+
+// closed records that the connection is closed for good, either by Stop or
+// after the reconnect attempts ran out
+func (h *HorizonMessageBroker) closed(nc *nats.Conn) {
+	brokerConnected.Set(0)
+	brokerConnectionEvents.WithLabelValues("closed").Inc()
+	h.setState(nc.LastError())
+	if err := nc.LastError(); err != nil {
+		h.reportError("", eris.Wrap(err, "broker connection to NATS closed"))
+	}
+}
+
+// asyncError reports the errors NATS raises outside of a call, such as a slow
+// consumer dropping messages or a permission violation
+func (h *HorizonMessageBroker) asyncError(nc *nats.Conn, sub *nats.Subscription, err error) {
+	brokerConnectionEvents.WithLabelValues("error").Inc()
+	topic := ""
+	if sub != nil {
+		topic = sub.Subject
+	}
+	h.reportError(topic, eris.Wrap(err, "NATS connection error"))
+}
+
+// setState records the time the connection changed state and why
+func (h *HorizonMessageBroker) setState(err error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.since = time.Now().UTC()
+	if err != nil {
+		h.lastError = err.Error()
+	}
+}
+
+// conn returns the connection opened by Run, nil once Stop closed it
+func (h *HorizonMessageBroker) conn() *nats.Conn {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.nc
+}
+
+// jetstream returns the JetStream context opened by Run, nil without streams or once Stop ran
+func (h *HorizonMessageBroker) jetstream() jetstream.JetStream {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.js
+}
+
+// Ping implements MessageBroker.
+func (h *HorizonMessageBroker) Ping(ctx context.Context) error {
+	nc := h.conn()
+	if nc == nil {
+		return eris.New("NATS connection not initialized")
+	}
+	if !nc.IsConnected() {
+		return eris.Errorf("NATS connection is %s", h.Status().State)
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+	}
+	if err := nc.FlushWithContext(ctx); err != nil {
+		return eris.Wrap(err, "NATS ping failed")
+	}
+	return nil
+}
+
+// Status implements MessageBroker.
+func (h *HorizonMessageBroker) Status() BrokerStatus {
+	h.mutex.Lock()
+	status := BrokerStatus{
+		State:     BrokerDisconnected,
+		LastError: h.lastError,
+		Since:     h.since,
+	}
+	nc := h.nc
+	h.mutex.Unlock()
+	if nc == nil {
+		return status
+	}
+	switch nc.Status() {
+	case nats.CONNECTED, nats.DRAINING_SUBS, nats.DRAINING_PUBS:
+		status.State = BrokerConnected
+		status.Server = nc.ConnectedUrlRedacted()
+	case nats.CONNECTING, nats.RECONNECTING:
+		status.State = BrokerReconnecting
+	case nats.CLOSED:
+		status.State = BrokerClosed
+	}
+	status.Reconnects = nc.Stats().Reconnects
+	status.Buffered, _ = nc.Buffered()
+	return status
+}
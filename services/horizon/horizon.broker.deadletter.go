@@ -0,0 +1,226 @@
+package horizon
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rotisserie/eris"
+	"gorm.io/gorm"
+)
+
+// DeadLetterMessage is a stored DeadLetter. Payload holds the envelope of the
+// failed message, or its body when it was published without one.
+type DeadLetterMessage struct {
+	ID uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+
+	CreatedAt  time.Time  `gorm:"not null;default:now();index"`
+	FailedAt   time.Time  `gorm:"not null"`
+	ReplayedAt *time.Time `gorm:"index"`
+
+	Topic        string     `gorm:"type:varchar(255);not null;index"`
+	Subscription string     `gorm:"type:varchar(255)"`
+	EventID      *uuid.UUID `gorm:"type:uuid;index"`
+	EventType    string     `gorm:"type:varchar(255)"`
+	Payload      []byte     `gorm:"type:jsonb;not null"`
+	Error        string     `gorm:"type:text;not null"`
+	Attempts     int        `gorm:"not null;default:0"`
+	Replays      int        `gorm:"not null;default:0"`
+}
+
+func (DeadLetterMessage) TableName() string {
+	return "horizon_dead_letters"
+}
+
+// DeadLetterQuery filters the dead letters returned by List
+type DeadLetterQuery struct {
+	// Topic is the original topic; a trailing > matches every topic below it, e.g. feedback.>
+	Topic        string
+	Subscription string
+
+	// Replayed keeps only the replayed dead letters when true and the others when false
+	Replayed *bool
+
+	// Page starts at 1; Size defaults to 20
+	Page int
+	Size int
+}
+
+// DeadLetterService stores the messages published to the dead-letter topics so
+// that they can be inspected and replayed
+type DeadLetterService interface {
+	// Run migrates the dead letter table and starts storing the dead letters of every instance
+	Run(ctx context.Context) error
+
+	// Stop stops storing dead letters
+	Stop(ctx context.Context) error
+
+	// List returns a page of the dead letters matching query, newest first, and how many match
+	List(ctx context.Context, query DeadLetterQuery) ([]*DeadLetterMessage, int64, error)
+
+	// Get returns the dead letter with id
+	Get(ctx context.Context, id uuid.UUID) (*DeadLetterMessage, error)
+
+	// Replay publishes the failed message again to its original topic. Envelopes
+	// keep their id, so handlers that already applied the event can recognize it,
+	// while the message is given a Nats-Msg-Id of its own so that JetStream does
+	// not drop it as a duplicate of the original.
+	Replay(ctx context.Context, id uuid.UUID) (*DeadLetterMessage, error)
+
+	// Delete forgets the dead letter with id
+	Delete(ctx context.Context, id uuid.UUID) error
+}
+
+type HorizonDeadLetters struct {
+	database     SQLDatabaseService
+	broker       MessageBrokerService
+	subscription Subscription
+}
+
+// NewHorizonDeadLetters creates a DeadLetterService storing dead letters in database
+func NewHorizonDeadLetters(database SQLDatabaseService, broker MessageBrokerService) DeadLetterService {
+	return &HorizonDeadLetters{
+		database: database,
+		broker:   broker,
+	}
+}
+
+// Run implements DeadLetterService.
+func (h *HorizonDeadLetters) Run(ctx context.Context) error {
+	if err := h.database.Client().AutoMigrate(&DeadLetterMessage{}); err != nil {
+		return eris.Wrap(err, "failed to migrate dead letter table")
+	}
+	// One instance of the queue group stores each dead letter, retrying while the
+	// database is unavailable; dead letters are never dead-lettered themselves
+	retry := RetryPolicy{Name: "horizon-dead-letters", MaxAttempts: 5, InitialBackoff: time.Second}
+	subscription, err := h.broker.QueueSubscribe(context.WithoutCancel(ctx), DeadLetterPrefix+".>", retry.Name, Retry(h.broker, retry, Typed(h.store)))
+	if err != nil {
+		return eris.Wrap(err, "failed to subscribe to dead-letter topics")
+	}
+	h.subscription = subscription
+	return nil
+}
+
+// Stop implements DeadLetterService.
+func (h *HorizonDeadLetters) Stop(ctx context.Context) error {
+	if h.subscription == nil {
+		return nil
+	}
+	err := h.subscription.Drain()
+	h.subscription = nil
+	return err
+}
+
+// List implements DeadLetterService.
+func (h *HorizonDeadLetters) List(ctx context.Context, query DeadLetterQuery) ([]*DeadLetterMessage, int64, error) {
+	db := h.database.Client().WithContext(ctx).Model(&DeadLetterMessage{})
+	if prefix, ok := strings.CutSuffix(query.Topic, ">"); ok {
+		db = db.Where("topic LIKE ?", strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(prefix)+"%")
+	} else if query.Topic != "" {
+		db = db.Where("topic = ?", query.Topic)
+	}
+	if query.Subscription != "" {
+		db = db.Where("subscription = ?", query.Subscription)
+	}
+	if query.Replayed != nil {
+		if *query.Replayed {
+			db = db.Where("replayed_at IS NOT NULL")
+		} else {
+			db = db.Where("replayed_at IS NULL")
+		}
+	}
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, eris.Wrap(err, "failed to count dead letters")
+	}
+	size := query.Size
+	if size <= 0 {
+		size = 20
+	}
+	page := max(query.Page, 1)
+	var messages []*DeadLetterMessage
+	if err := db.Order("created_at DESC").Limit(size).Offset((page - 1) * size).Find(&messages).Error; err != nil {
+		return nil, 0, eris.Wrap(err, "failed to list dead letters")
+	}
+	return messages, total, nil
+}
+
+// Get implements DeadLetterService.
+func (h *HorizonDeadLetters) Get(ctx context.Context, id uuid.UUID) (*DeadLetterMessage, error) {
+	message := new(DeadLetterMessage)
+	if err := h.database.Client().WithContext(ctx).First(message, "id = ?", id).Error; err != nil {
+		return nil, eris.Wrapf(err, "failed to find dead letter %s", id)
+	}
+	return message, nil
+}
+
+// Replay implements DeadLetterService.
+func (h *HorizonDeadLetters) Replay(ctx context.Context, id uuid.UUID) (*DeadLetterMessage, error) {
+	message, err := h.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	replayCtx := withReplay(serverContext(ctx), message.Replays+1)
+	if err := h.broker.Publish(replayCtx, message.Topic, outboxPayload(&OutboxMessage{Payload: message.Payload})); err != nil {
+		return nil, eris.Wrapf(err, "failed to replay dead letter %s", id)
+	}
+	now := time.Now().UTC()
+	message.ReplayedAt = &now
+	message.Replays++
+	if err := h.database.Client().WithContext(ctx).Save(message).Error; err != nil {
+		return nil, eris.Wrapf(err, "failed to record replay of dead letter %s", id)
+	}
+	return message, nil
+}
+
+type replayContextKey struct{}
+
+// withReplay marks the publishes of ctx as the given replay of their envelope
+func withReplay(ctx context.Context, replay int) context.Context {
+	return context.WithValue(ctx, replayContextKey{}, replay)
+}
+
+// Delete implements DeadLetterService.
+func (h *HorizonDeadLetters) Delete(ctx context.Context, id uuid.UUID) error {
+	result := h.database.Client().WithContext(ctx).Delete(&DeadLetterMessage{}, "id = ?", id)
+	if result.Error != nil {
+		return eris.Wrapf(result.Error, "failed to delete dead letter %s", id)
+	}
+	if result.RowsAffected == 0 {
+		return eris.Wrapf(gorm.ErrRecordNotFound, "failed to find dead letter %s", id)
+	}
+	return nil
+}
+
+// store saves a dead letter received from a dead-letter topic
+func (h *HorizonDeadLetters) store(ctx context.Context, letter DeadLetter) error {
+	message := &DeadLetterMessage{
+		FailedAt:     letter.FailedAt,
+		Topic:        letter.Topic,
+		Subscription: letter.Subscription,
+		Error:        letter.Error,
+		Attempts:     letter.Attempts,
+		Payload:      letter.Data,
+	}
+	if message.FailedAt.IsZero() {
+		message.FailedAt = time.Now().UTC()
+	}
+	if letter.Envelope != nil {
+		data, err := json.Marshal(letter.Envelope)
+		if err != nil {
+			return eris.Wrapf(err, "failed to marshal dead letter of topic %s", letter.Topic)
+		}
+		message.Payload = data
+		message.EventID = &letter.Envelope.ID
+		message.EventType = letter.Envelope.Type
+	}
+	if len(message.Payload) == 0 {
+		message.Payload = []byte("null")
+	}
+	if err := h.database.Client().WithContext(ctx).Create(message).Error; err != nil {
+		return eris.Wrapf(err, "failed to store dead letter of topic %s", letter.Topic)
+	}
+	return nil
+}
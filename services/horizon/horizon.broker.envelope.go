@@ -0,0 +1,183 @@
+package horizon
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/rotisserie/eris"
+)
+
+/*
+{
+	"id": "0a8c...",
+	"type": "feedback.created",
+	"schema_version": 1,
+	"occurred_at": "2025-06-01T08:00:00Z",
+	"producer": "horizon-7f9c",
+	"tenant": "4b1e...:00000000-0000-0000-0000-000000000000",
+	"correlation_id": "c1d2...",
+	"trace_id": "4bf92f3577b34da6a3ce929d0e0e4736",
+	"data": {"id": "...", "email": "..."}
+}
+*/
+
+// Headers carrying the envelope metadata of broker messages. Nats-Msg-Id lets
+// JetStream drop duplicates published within its deduplication window.
+const (
+	HeaderMessageID     = "Nats-Msg-Id"
+	HeaderEventID       = "Horizon-Event-Id"
+	HeaderEventType     = "Horizon-Event-Type"
+	HeaderSchemaVersion = "Horizon-Schema-Version"
+	HeaderOccurredAt    = "Horizon-Occurred-At"
+	HeaderProducer      = "Horizon-Producer"
+	HeaderTenant        = "Horizon-Tenant"
+	HeaderCorrelationID = "Horizon-Correlation-Id"
+	HeaderTraceID       = "Horizon-Trace-Id"
+)
+
+// Envelope wraps the payload of every broker message with the metadata consumers
+// need to route, dedupe and correlate events. The ID identifies the event: a
+// change broadcast to several topics carries the same ID on each of them.
+type Envelope struct {
+	ID            uuid.UUID       `json:"id"`
+	Type          string          `json:"type"`
+	SchemaVersion int             `json:"schema_version"`
+	OccurredAt    time.Time       `json:"occurred_at"`
+	Producer      string          `json:"producer,omitempty"`
+	Tenant        string          `json:"tenant,omitempty"`
+	CorrelationID string          `json:"correlation_id,omitempty"`
+	TraceID       string          `json:"trace_id,omitempty"`
+	Data          json.RawMessage `json:"data"`
+}
+
+// Trace correlates the broker events caused by the same piece of work, usually a request
+type Trace struct {
+	CorrelationID string
+	TraceID       string
+}
+
+type traceContextKey struct{}
+
+// WithTrace returns a context whose envelopes carry trace
+func WithTrace(ctx context.Context, trace Trace) context.Context {
+	return context.WithValue(ctx, traceContextKey{}, trace)
+}
+
+// TraceFromContext returns the trace stored by WithTrace
+func TraceFromContext(ctx context.Context) (Trace, bool) {
+	trace, ok := ctx.Value(traceContextKey{}).(Trace)
+	return trace, ok
+}
+
+// ParseTraceParent extracts the trace id of a W3C traceparent header such as
+// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+func ParseTraceParent(value string) string {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) != 4 || len(parts[1]) != 32 {
+		return ""
+	}
+	return parts[1]
+}
+
+// envelopeProducer names this process in the envelopes it produces
+var envelopeProducer = func() string {
+	host, err := os.Hostname()
+	if err != nil {
+		return "horizon"
+	}
+	return host
+}()
+
+// NewEnvelope wraps payload in a version 1 envelope of eventType, traced by the trace of ctx
+func NewEnvelope(ctx context.Context, eventType string, payload any) (*Envelope, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, eris.Wrapf(err, "failed to marshal payload of %s event", eventType)
+	}
+	trace, _ := TraceFromContext(ctx)
+	return &Envelope{
+		ID:            uuid.New(),
+		Type:          eventType,
+		SchemaVersion: 1,
+		OccurredAt:    time.Now().UTC(),
+		Producer:      envelopeProducer,
+		CorrelationID: trace.CorrelationID,
+		TraceID:       trace.TraceID,
+		Data:          data,
+	}, nil
+}
+
+// Decode unmarshals the payload of the envelope into v
+func (e *Envelope) Decode(v any) error {
+	if err := json.Unmarshal(e.Data, v); err != nil {
+		return eris.Wrap(ErrUndecodable, "envelope "+e.ID.String()+" of type "+e.Type+": "+err.Error())
+	}
+	return nil
+}
+
+// Trace returns the trace the envelope was produced under
+func (e *Envelope) Trace() Trace {
+	return Trace{CorrelationID: e.CorrelationID, TraceID: e.TraceID}
+}
+
+// Header returns the NATS headers of the envelope published to topic
+func (e *Envelope) Header(topic string) nats.Header {
+	header := nats.Header{}
+	header.Set(HeaderMessageID, e.ID.String()+":"+topic)
+	header.Set(HeaderEventID, e.ID.String())
+	header.Set(HeaderEventType, e.Type)
+	header.Set(HeaderSchemaVersion, strconv.Itoa(e.SchemaVersion))
+	header.Set(HeaderOccurredAt, e.OccurredAt.Format(time.RFC3339Nano))
+	for name, value := range map[string]string{
+		HeaderProducer:      e.Producer,
+		HeaderTenant:        e.Tenant,
+		HeaderCorrelationID: e.CorrelationID,
+		HeaderTraceID:       e.TraceID,
+	} {
+		if value != "" {
+			header.Set(name, value)
+		}
+	}
+	return header
+}
+
+// envelopeOf returns payload when it already is an envelope and wraps it in a
+// new envelope typed after topic otherwise
+func envelopeOf(ctx context.Context, topic string, payload any) (*Envelope, error) {
+	switch value := payload.(type) {
+	case *Envelope:
+		return value, nil
+	case Envelope:
+		return &value, nil
+	}
+	return NewEnvelope(ctx, topic, payload)
+}
+
+// openEnvelope reads the envelope of a message carrying the envelope headers.
+// Messages without them, such as those of older producers, are returned as is.
+func openEnvelope(msg *BrokerMessage, header nats.Header) *BrokerMessage {
+	if header.Get(HeaderEventID) == "" {
+		return msg
+	}
+	envelope := new(Envelope)
+	if err := json.Unmarshal(msg.Data, envelope); err != nil {
+		return msg
+	}
+	msg.Envelope = envelope
+	msg.Data = envelope.Data
+	return msg
+}
+
+// handlerContext is the context a handler receives: ctx traced like the envelope of msg
+func handlerContext(ctx context.Context, msg *BrokerMessage) context.Context {
+	if msg.Envelope == nil {
+		return ctx
+	}
+	return WithTrace(ctx, msg.Envelope.Trace())
+}
@@ -0,0 +1,405 @@
+package horizon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+)
+
+/*
+gateway := horizon.NewBrokerGateway(service.Broker, service.Request.Origins(), func(c echo.Context) (horizon.TopicPermission, error) {
+	claim, err := userToken.GetToken(c.Request().Context(), c)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusUnauthorized, "authentication required")
+	}
+	return policy.Permission(horizon.BrokerClaims{UserID: claim.UserID}), nil
+})
+
+GET /broadcast/events?topic=feedback.update.0a8c...&topic=feedback.delete.0a8c...
+
+	id: 5d1e...
+	event: message
+	data: {"type":"message","topic":"feedback.update.0a8c...","id":"5d1e...","event":"feedback.updated","data":{...}}
+
+GET /broadcast/ws
+
+	→ {"action":"subscribe","topic":"feedback.update.0a8c..."}
+	← {"type":"subscribed","topic":"feedback.update.0a8c..."}
+	← {"type":"message","topic":"feedback.update.0a8c...","id":"5d1e...","event":"feedback.updated","data":{...}}
+	→ {"action":"unsubscribe","topic":"feedback.update.0a8c..."}
+	← {"type":"unsubscribed","topic":"feedback.update.0a8c..."}
+	→ {"action":"publish","topic":"user.9f3b....typing","data":{...}}
+	← {"type":"published","topic":"user.9f3b....typing"}
+*/
+
+const (
+	// MaxGatewaySubscriptions bounds how many topics a single gateway connection may subscribe to
+	MaxGatewaySubscriptions = 32
+
+	// gatewayHeartbeat is how often idle connections are pinged so proxies keep them open
+	gatewayHeartbeat = 25 * time.Second
+
+	// gatewayWriteWait bounds how long a write to a client may block
+	gatewayWriteWait = 10 * time.Second
+
+	// gatewayBuffer is how many frames may queue for a client before it is dropped as too slow
+	gatewayBuffer = 64
+
+	// gatewayReadLimit bounds the size of the commands a WebSocket client sends
+	gatewayReadLimit = 4096
+)
+
+// Types of the frames the gateway sends
+const (
+	FrameMessage      = "message"
+	FrameSubscribed   = "subscribed"
+	FrameUnsubscribed = "unsubscribed"
+	FramePublished    = "published"
+	FrameError        = "error"
+)
+
+// TopicPermission decides whether a connected client may subscribe or publish to topic
+type TopicPermission func(action TopicAction, topic string) error
+
+// GatewayAuthenticator authenticates the client of c when it connects and returns
+// the permission its subscriptions are checked against. The error it returns is
+// sent as the response, so it is usually an *echo.HTTPError.
+type GatewayAuthenticator func(c echo.Context) (TopicPermission, error)
+
+// GatewayFrame is what the gateway sends to a client: a broker message, or the
+// outcome of a command. Data is the payload of the message, without its envelope.
+type GatewayFrame struct {
+	Type       string          `json:"type"`
+	Topic      string          `json:"topic,omitempty"`
+	ID         string          `json:"id,omitempty"`
+	Event      string          `json:"event,omitempty"`
+	OccurredAt *time.Time      `json:"occurred_at,omitempty"`
+	Data       json.RawMessage `json:"data,omitempty"`
+	Error      string          `json:"error,omitempty"`
+}
+
+// gatewayCommand is what a WebSocket client sends to the gateway
+type gatewayCommand struct {
+	Action string          `json:"action"`
+	Topic  string          `json:"topic"`
+	Data   json.RawMessage `json:"data,omitempty"`
+}
+
+// BrokerGateway relays the messages of broker topics to browsers over WebSocket
+// and Server-Sent Events, so they never connect to the broker themselves.
+type BrokerGateway struct {
+	broker       MessageBrokerService
+	authenticate GatewayAuthenticator
+	upgrader     websocket.Upgrader
+}
+
+// NewBrokerGateway creates a gateway relaying broker to the clients authenticate
+// accepts. WebSocket upgrades are accepted from origins and from the server's own.
+func NewBrokerGateway(broker MessageBrokerService, origins []string, authenticate GatewayAuthenticator) *BrokerGateway {
+	return &BrokerGateway{
+		broker:       broker,
+		authenticate: authenticate,
+		upgrader: websocket.Upgrader{
+			CheckOrigin: func(r *http.Request) bool {
+				origin := r.Header.Get(echo.HeaderOrigin)
+				if origin == "" || slices.Contains(origins, origin) {
+					return true
+				}
+				parsed, err := url.Parse(origin)
+				return err == nil && strings.EqualFold(parsed.Host, r.Host)
+			},
+		},
+	}
+}
+
+// Events streams the messages of the topics given as ?topic= as Server-Sent Events.
+// Every topic is checked before the stream starts, so a single forbidden topic
+// rejects the whole request.
+func (g *BrokerGateway) Events(c echo.Context) error {
+	permission, err := g.authenticate(c)
+	if err != nil {
+		return err
+	}
+	topics := c.QueryParams()["topic"]
+	if len(topics) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "at least one topic is required")
+	}
+	session := g.session(c, permission)
+	defer session.close()
+	for _, topic := range topics {
+		if err := session.subscribe(topic); err != nil {
+			return err
+		}
+	}
+
+	response := c.Response()
+	response.Header().Set(echo.HeaderContentType, "text/event-stream")
+	response.Header().Set("Cache-Control", "no-cache")
+	response.Header().Set("Connection", "keep-alive")
+	response.Header().Set("X-Accel-Buffering", "no")
+	response.WriteHeader(http.StatusOK)
+	response.Flush()
+
+	heartbeat := time.NewTicker(gatewayHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-session.ctx.Done():
+			return nil
+		case frame := <-session.frames:
+			data, err := json.Marshal(frame)
+			if err != nil {
+				continue
+			}
+			if frame.ID != "" {
+				if _, err := fmt.Fprintf(response, "id: %s\n", frame.ID); err != nil {
+					return nil
+				}
+			}
+			if _, err := fmt.Fprintf(response, "event: %s\ndata: %s\n\n", frame.Type, data); err != nil {
+				return nil
+			}
+			response.Flush()
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(response, ": ping\n\n"); err != nil {
+				return nil
+			}
+			response.Flush()
+		}
+	}
+}
+
+// WebSocket upgrades the request and relays the topics the client subscribes to
+// with subscribe and unsubscribe commands; publish commands publish their data
+// to a topic. A rejected command is answered with an error frame and leaves the
+// connection open.
+func (g *BrokerGateway) WebSocket(c echo.Context) error {
+	permission, err := g.authenticate(c)
+	if err != nil {
+		return err
+	}
+	conn, err := g.upgrader.Upgrade(c.Response(), c.Request(), nil)
+	if err != nil {
+		// the upgrader has already answered the request
+		return nil
+	}
+	defer conn.Close()
+	session := g.session(c, permission)
+	defer session.close()
+
+	conn.SetReadLimit(gatewayReadLimit)
+	_ = conn.SetReadDeadline(time.Now().Add(2 * gatewayHeartbeat))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(2 * gatewayHeartbeat))
+	})
+	go func() {
+		defer session.cancel()
+		for {
+			var command gatewayCommand
+			if err := conn.ReadJSON(&command); err != nil {
+				return
+			}
+			session.send(session.handle(command))
+		}
+	}()
+
+	heartbeat := time.NewTicker(gatewayHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-session.ctx.Done():
+			_ = conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+				time.Now().Add(gatewayWriteWait))
+			return nil
+		case frame := <-session.frames:
+			_ = conn.SetWriteDeadline(time.Now().Add(gatewayWriteWait))
+			if err := conn.WriteJSON(frame); err != nil {
+				return nil
+			}
+		case <-heartbeat.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(gatewayWriteWait)); err != nil {
+				return nil
+			}
+		}
+	}
+}
+
+// gatewaySession holds the subscriptions of one gateway connection; they all end
+// when the connection closes
+type gatewaySession struct {
+	broker     MessageBrokerService
+	permission TopicPermission
+	ctx        context.Context
+	cancel     context.CancelFunc
+	frames     chan GatewayFrame
+
+	mutex         sync.Mutex
+	subscriptions map[string]Subscription
+}
+
+func (g *BrokerGateway) session(c echo.Context, permission TopicPermission) *gatewaySession {
+	ctx, cancel := context.WithCancel(c.Request().Context())
+	return &gatewaySession{
+		broker:        g.broker,
+		permission:    permission,
+		ctx:           ctx,
+		cancel:        cancel,
+		frames:        make(chan GatewayFrame, gatewayBuffer),
+		subscriptions: map[string]Subscription{},
+	}
+}
+
+// handle runs a command and returns the frame answering it
+func (s *gatewaySession) handle(command gatewayCommand) GatewayFrame {
+	var err error
+	answer := FrameSubscribed
+	switch command.Action {
+	case "subscribe":
+		err = s.subscribe(command.Topic)
+	case "unsubscribe":
+		answer = FrameUnsubscribed
+		s.unsubscribe(command.Topic)
+	case "publish":
+		answer = FramePublished
+		err = s.publish(command.Topic, command.Data)
+	default:
+		err = echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown action: %s", command.Action))
+	}
+	if err != nil {
+		message := err.Error()
+		if httpError, ok := err.(*echo.HTTPError); ok {
+			message = fmt.Sprint(httpError.Message)
+		}
+		return GatewayFrame{Type: FrameError, Topic: command.Topic, Error: message}
+	}
+	return GatewayFrame{Type: answer, Topic: command.Topic}
+}
+
+// subscribe relays topic once the permission allows it. A client too slow to
+// keep up with its topics is disconnected rather than allowed to hold messages back.
+func (s *gatewaySession) subscribe(topic string) error {
+	if !validTopic(topic) {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid topic: %s", topic))
+	}
+	if err := s.authorize(TopicSubscribe, topic); err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.subscriptions[topic]; ok {
+		return nil
+	}
+	if len(s.subscriptions) >= MaxGatewaySubscriptions {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("at most %d topics can be subscribed to", MaxGatewaySubscriptions))
+	}
+	subscription, err := s.broker.SubscribeMessage(s.ctx, topic, func(_ context.Context, msg *BrokerMessage) error {
+		select {
+		case s.frames <- messageFrame(msg):
+		default:
+			s.cancel()
+		}
+		return nil
+	})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, fmt.Sprintf("failed to subscribe to %s", topic))
+	}
+	s.subscriptions[topic] = subscription
+	return nil
+}
+
+// publish publishes data to topic once the permission allows it. Wildcards are
+// rejected since a message is published to a single subject.
+func (s *gatewaySession) publish(topic string, data json.RawMessage) error {
+	if !validTopic(topic) || strings.ContainsAny(topic, "*>") {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid topic: %s", topic))
+	}
+	if len(data) == 0 {
+		data = json.RawMessage("null")
+	}
+	if err := s.authorize(TopicPublish, topic); err != nil {
+		return err
+	}
+	if err := s.broker.Publish(s.ctx, topic, data); err != nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, fmt.Sprintf("failed to publish to %s", topic))
+	}
+	return nil
+}
+
+// authorize checks the permission of the session, answering with 403 when it refuses
+func (s *gatewaySession) authorize(action TopicAction, topic string) error {
+	if err := s.permission(action, topic); err != nil {
+		if httpError, ok := err.(*echo.HTTPError); ok {
+			return httpError
+		}
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	}
+	return nil
+}
+
+func (s *gatewaySession) unsubscribe(topic string) {
+	s.mutex.Lock()
+	subscription, ok := s.subscriptions[topic]
+	delete(s.subscriptions, topic)
+	s.mutex.Unlock()
+	if ok {
+		_ = subscription.Unsubscribe()
+	}
+}
+
+// send queues frame unless the session has ended
+func (s *gatewaySession) send(frame GatewayFrame) {
+	select {
+	case s.frames <- frame:
+	case <-s.ctx.Done():
+	}
+}
+
+func (s *gatewaySession) close() {
+	s.cancel()
+	s.mutex.Lock()
+	subscriptions := s.subscriptions
+	s.subscriptions = map[string]Subscription{}
+	s.mutex.Unlock()
+	for _, subscription := range subscriptions {
+		_ = subscription.Unsubscribe()
+	}
+}
+
+// messageFrame converts msg to the frame relayed to clients
+func messageFrame(msg *BrokerMessage) GatewayFrame {
+	frame := GatewayFrame{Type: FrameMessage, Topic: msg.Topic, Data: json.RawMessage(msg.Data)}
+	if !json.Valid(msg.Data) {
+		frame.Data, _ = json.Marshal(string(msg.Data))
+	}
+	if msg.Envelope != nil {
+		occurredAt := msg.Envelope.OccurredAt
+		frame.ID = msg.Envelope.ID.String()
+		frame.Event = msg.Envelope.Type
+		frame.OccurredAt = &occurredAt
+	}
+	return frame
+}
+
+// validTopic accepts subjects made of non empty tokens, with > only as the last token
+func validTopic(topic string) bool {
+	if topic == "" || strings.ContainsAny(topic, " \t\r\n") {
+		return false
+	}
+	tokens := strings.Split(topic, ".")
+	for i, token := range tokens {
+		if token == "" || (token == ">" && i != len(tokens)-1) {
+			return false
+		}
+	}
+	return true
+}
@@ -4,11 +4,117 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
 	"github.com/rotisserie/eris"
 )
 
+// BrokerStream is a JetStream stream that persists every message published to
+// one of its subjects, e.g. "feedback.>", so that durable subscribers offline
+// at the time still receive it
+type BrokerStream struct {
+	// Name defaults to the first token of the first subject in upper case, e.g. FEEDBACK
+	Name     string
+	Subjects []string
+
+	// MaxAge and MaxMsgs bound how long and how many messages the stream keeps; zero is unlimited
+	MaxAge  time.Duration
+	MaxMsgs int64
+
+	// Replicas defaults to 1
+	Replicas int
+}
+
+// BrokerConsumer configures a JetStream consumer registered by SubscribeDurable
+type BrokerConsumer struct {
+	// Durable names the consumer so that it resumes where it left off after a
+	// restart; an empty name creates an ephemeral consumer. Instances subscribing
+	// with the same name share its messages like a queue group.
+	Durable string
+
+	// Backoff is the delay before each redelivery of a message whose handler
+	// failed or was not acknowledged within AckWait; the last delay repeats
+	Backoff []time.Duration
+
+	// MaxDeliver bounds how many times a message is delivered; zero is unlimited
+	MaxDeliver int
+
+	// AckWait is how long the server waits for a handler before redelivering, 30s by default
+	AckWait time.Duration
+
+	// StartSequence or StartTime replay the stream from that sequence or point in
+	// time instead of delivering only new messages. A durable consumer keeps the
+	// position it was created with; delete it to replay again.
+	StartSequence uint64
+	StartTime     time.Time
+
+	// DeadLetter publishes a message to its DeadLetterTopic and stops redelivering
+	// it once its last delivery, as bounded by MaxDeliver, fails or it cannot be decoded
+	DeadLetter bool
+}
+
+// BrokerMessage is a message received from a topic. Data is the payload: the
+// data of the envelope, or the whole body of a message published without one.
+type BrokerMessage struct {
+	Topic    string
+	Data     []byte
+	Envelope *Envelope
+
+	// Reply is the inbox of a Request waiting for an answer, empty otherwise
+	Reply string
+}
+
+// Decode unmarshals the JSON body of the message into v
+func (m *BrokerMessage) Decode(v any) error {
+	if err := json.Unmarshal(m.Data, v); err != nil {
+		return eris.Wrap(ErrUndecodable, fmt.Sprintf("message from topic %s: %v", m.Topic, err))
+	}
+	return nil
+}
+
+// ErrUndecodable wraps handler errors of messages whose body could not be decoded.
+// Durable consumers terminate such messages instead of redelivering them.
+var ErrUndecodable = eris.New("undecodable message")
+
+// ErrNoResponders is returned by Request when no subscriber listens on the topic
+var ErrNoResponders = eris.New("no responders")
+
+// MessageHandler handles a message; ctx is the context the subscription was registered with
+type MessageHandler func(ctx context.Context, msg *BrokerMessage) error
+
+// ErrorHandler receives the errors returned by the handlers of a broker and
+// those of background work, such as the outbox relay, with an empty topic
+type ErrorHandler func(topic string, err error)
+
+// Subscription is a registered handler; it also ends when the context it was registered with is cancelled
+type Subscription interface {
+	// Unsubscribe stops delivery immediately
+	Unsubscribe() error
+
+	// Drain stops delivery once the messages already received are handled
+	Drain() error
+}
+
+// Typed adapts a handler of T to a MessageHandler that decodes the JSON body into T
+func Typed[T any](handler func(ctx context.Context, payload T) error) MessageHandler {
+	return func(ctx context.Context, msg *BrokerMessage) error {
+		var payload T
+		if err := msg.Decode(&payload); err != nil {
+			return err
+		}
+		return handler(ctx, payload)
+	}
+}
+
+// SubscribeTyped registers a handler receiving the messages of topic decoded into T
+func SubscribeTyped[T any](ctx context.Context, broker MessageBrokerService, topic string, handler func(ctx context.Context, payload T) error) (Subscription, error) {
+	return broker.SubscribeMessage(ctx, topic, Typed(handler))
+}
+
 // MessageBroker defines the interface for pub/sub messaging systems
 type MessageBrokerService interface {
 	// Run connects to a broker cluster
@@ -17,61 +123,158 @@ type MessageBrokerService interface {
 	// Stop closes all producer/consumer connections
 	Stop(ctx context.Context) error
 
-	// Publish sends a message to a single topic
+	// Publish sends a message to a single topic. A payload that is not an *Envelope
+	// is wrapped in one typed after the topic and traced by ctx.
 	Publish(ctx context.Context, topic string, payload any) error
 
-	// DispatchBatch sends a message to multiple topics
+	// DispatchBatch sends a message to multiple topics, wrapped in a single envelope
 	Dispatch(ctx context.Context, topics []string, payload any) error
 
-	// Subscribe registers a message handler for a topic
-	Subscribe(ctx context.Context, topic string, handler func(any) error) error
+	// Subscribe registers a message handler for a topic, decoding the payload into any
+	Subscribe(ctx context.Context, topic string, handler func(any) error) (Subscription, error)
+
+	// SubscribeMessage registers a handler receiving the undecoded messages of a topic
+	SubscribeMessage(ctx context.Context, topic string, handler MessageHandler) (Subscription, error)
+
+	// QueueSubscribe registers a handler in a queue group: each message of topic
+	// is delivered to a single member of the group across every instance
+	QueueSubscribe(ctx context.Context, topic string, queue string, handler MessageHandler) (Subscription, error)
+
+	// Request sends payload to topic and waits up to timeout for the first reply
+	Request(ctx context.Context, topic string, payload any, timeout time.Duration) (*BrokerMessage, error)
+
+	// Reply answers a message received from Request
+	Reply(ctx context.Context, msg *BrokerMessage, payload any) error
+
+	// SubscribeDurable registers a handler on a JetStream consumer of the stream
+	// holding topic. Messages are acknowledged once the handler succeeds and
+	// redelivered after the consumer backoff when it fails.
+	SubscribeDurable(ctx context.Context, topic string, consumer BrokerConsumer, handler MessageHandler) (Subscription, error)
+
+	// OnError replaces the hook receiving handler errors, which prints them by default
+	OnError(handler ErrorHandler)
+
+	// Ping checks that the broker is connected and answering, for health checks
+	Ping(ctx context.Context) error
+
+	// Status describes the connection of the broker
+	Status() BrokerStatus
 }
 
 type HorizonMessageBroker struct {
-	host string
-	port int
-	nc   *nats.Conn
+	host    string
+	port    int
+	options BrokerOptions
+	streams []BrokerStream
+	nc      *nats.Conn
+	js      jetstream.JetStream
+
+	mutex         sync.Mutex
+	onError       ErrorHandler
+	subscriptions map[*brokerSubscription]struct{}
+	lastError     string
+	since         time.Time
 }
 
-func NewHorizonMessageBroker(host string, port int) MessageBrokerService {
+// NewHorizonMessageBroker creates a broker on core NATS, or on JetStream when
+// streams are given, connecting and reconnecting as options configure. In
+// JetStream mode publishes to a subject of a stream wait for the stream to
+// store the message.
+func NewHorizonMessageBroker(host string, port int, options BrokerOptions, streams ...BrokerStream) MessageBrokerService {
 	return &HorizonMessageBroker{
-		host: host,
-		port: port,
+		host:          host,
+		port:          port,
+		options:       options,
+		streams:       streams,
+		onError:       PrintError,
+		subscriptions: map[*brokerSubscription]struct{}{},
 	}
 }
 
 // Run implements MessageBroker.
 func (h *HorizonMessageBroker) Run(ctx context.Context) error {
 	natsURL := fmt.Sprintf("nats://%s:%d", h.host, h.port)
-	nc, err := nats.Connect(natsURL)
+	options, err := h.natsOptions()
 	if err != nil {
+		return err
+	}
+	nc, err := nats.Connect(natsURL, options...)
+	if err != nil {
+		brokerConnectionEvents.WithLabelValues("error").Inc()
 		return eris.Wrap(err, "failed to connect to NATS")
 	}
+	h.mutex.Lock()
 	h.nc = nc
+	h.mutex.Unlock()
+	brokerConnected.Set(1)
+	h.setState(nil)
+	if len(h.streams) == 0 {
+		return nil
+	}
+	js, err := jetstream.New(nc)
+	if err != nil {
+		return eris.Wrap(err, "failed to open JetStream context")
+	}
+	for i, stream := range h.streams {
+		if len(stream.Subjects) == 0 {
+			return eris.Errorf("stream %d has no subjects", i)
+		}
+		if stream.Name == "" {
+			h.streams[i].Name = streamName(stream.Subjects[0])
+		}
+		if _, err := js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+			Name:     h.streams[i].Name,
+			Subjects: stream.Subjects,
+			MaxAge:   stream.MaxAge,
+			MaxMsgs:  stream.MaxMsgs,
+			Replicas: max(stream.Replicas, 1),
+			Storage:  jetstream.FileStorage,
+		}); err != nil {
+			return eris.Wrapf(err, "failed to create stream %s", h.streams[i].Name)
+		}
+	}
+	h.mutex.Lock()
+	h.js = js
+	h.mutex.Unlock()
 	return nil
 }
 
 // Stop implements MessageBroker.
 func (h *HorizonMessageBroker) Stop(ctx context.Context) error {
-	if h.nc != nil {
-		h.nc.Close()
-		h.nc = nil
+	h.mutex.Lock()
+	subscriptions := h.subscriptions
+	h.subscriptions = map[*brokerSubscription]struct{}{}
+	h.mutex.Unlock()
+	for subscription := range subscriptions {
+		_ = subscription.Unsubscribe()
+	}
+	h.mutex.Lock()
+	nc := h.nc
+	h.nc = nil
+	h.js = nil
+	h.mutex.Unlock()
+	if nc != nil {
+		nc.Close()
 	}
 	return nil
 }
 
 // DispatchBatch implements MessageBroker.
 func (h *HorizonMessageBroker) Dispatch(ctx context.Context, topics []string, payload any) error {
-	if h.nc == nil {
+	nc, js := h.conn(), h.jetstream()
+	if nc == nil {
 		return eris.New("NATS connection not initialized")
 	}
-	data, err := json.Marshal(payload)
+	if len(topics) == 0 {
+		return nil
+	}
+	envelope, err := envelopeOf(ctx, topics[0], payload)
 	if err != nil {
-		return eris.Wrap(err, "failed to marshal payload for topics")
+		return err
 	}
 	for _, topic := range topics {
-		if err := h.nc.Publish(topic, data); err != nil {
-			return eris.Wrap(err, fmt.Sprintf("failed to publish to topic %s", topic))
+		if err := h.publish(ctx, nc, js, topic, envelope); err != nil {
+			return err
 		}
 	}
 
@@ -80,37 +283,335 @@ func (h *HorizonMessageBroker) Dispatch(ctx context.Context, topics []string, pa
 
 // Publish implements MessageBroker.
 func (h *HorizonMessageBroker) Publish(ctx context.Context, topic string, payload any) error {
-	if h.nc == nil {
+	nc, js := h.conn(), h.jetstream()
+	if nc == nil {
 		return eris.New("NATS connection not initialized")
 	}
-	data, err := json.Marshal(payload)
+	envelope, err := envelopeOf(ctx, topic, payload)
+	if err != nil {
+		return err
+	}
+	return h.publish(ctx, nc, js, topic, envelope)
+}
+
+// publish stores envelope in the stream holding topic in JetStream mode and
+// publishes it on core NATS otherwise
+func (h *HorizonMessageBroker) publish(ctx context.Context, nc *nats.Conn, js jetstream.JetStream, topic string, envelope *Envelope) error {
+	msg, err := envelopeMsg(topic, envelope)
 	if err != nil {
-		return eris.Wrap(err, "failed to marshal payload for topic")
+		return err
 	}
-	if err := h.nc.Publish(topic, data); err != nil {
+	if replay, ok := ctx.Value(replayContextKey{}).(int); ok {
+		msg.Header.Set(HeaderMessageID, fmt.Sprintf("%s:replay:%d", msg.Header.Get(HeaderMessageID), replay))
+	}
+	if js != nil && h.streamFor(topic) != "" {
+		if _, err := js.PublishMsg(ctx, msg); err != nil {
+			return eris.Wrap(err, fmt.Sprintf("failed to publish to stream topic %s", topic))
+		}
+		return nil
+	}
+	if err := nc.PublishMsg(msg); err != nil {
 		return eris.Wrap(err, fmt.Sprintf("failed to publish to topic %s", topic))
 	}
 	return nil
 }
 
 // Subscribe implements MessageBroker.
-func (h *HorizonMessageBroker) Subscribe(ctx context.Context, topic string, handler func(any) error) error {
-	if h.nc == nil {
-		return eris.New("NATS connection not initialized")
+func (h *HorizonMessageBroker) Subscribe(ctx context.Context, topic string, handler func(any) error) (Subscription, error) {
+	return h.SubscribeMessage(ctx, topic, Typed(func(_ context.Context, payload any) error {
+		return handler(payload)
+	}))
+}
+
+// SubscribeMessage implements MessageBroker.
+func (h *HorizonMessageBroker) SubscribeMessage(ctx context.Context, topic string, handler MessageHandler) (Subscription, error) {
+	return h.subscribe(ctx, topic, "", handler)
+}
+
+// QueueSubscribe implements MessageBroker.
+func (h *HorizonMessageBroker) QueueSubscribe(ctx context.Context, topic string, queue string, handler MessageHandler) (Subscription, error) {
+	if queue == "" {
+		return nil, eris.Errorf("queue group is required to subscribe to topic %s", topic)
+	}
+	return h.subscribe(ctx, topic, queue, handler)
+}
+
+// subscribe registers handler on core NATS, in queue when it is not empty
+func (h *HorizonMessageBroker) subscribe(ctx context.Context, topic string, queue string, handler MessageHandler) (Subscription, error) {
+	nc := h.conn()
+	if nc == nil {
+		return nil, eris.New("NATS connection not initialized")
+	}
+	sub, err := nc.QueueSubscribe(topic, queue, func(msg *nats.Msg) {
+		message := openEnvelope(&BrokerMessage{Topic: msg.Subject, Data: msg.Data, Reply: msg.Reply}, msg.Header)
+		if err := handler(handlerContext(ctx, message), message); err != nil {
+			h.reportError(msg.Subject, err)
+		}
+	})
+	if err != nil {
+		return nil, eris.Wrap(err, fmt.Sprintf("failed to subscribe to topic %s", topic))
+	}
+	return h.track(ctx, &brokerSubscription{
+		unsubscribe: sub.Unsubscribe,
+		drain:       sub.Drain,
+	}), nil
+}
+
+// Request implements MessageBroker.
+func (h *HorizonMessageBroker) Request(ctx context.Context, topic string, payload any, timeout time.Duration) (*BrokerMessage, error) {
+	nc := h.conn()
+	if nc == nil {
+		return nil, eris.New("NATS connection not initialized")
+	}
+	envelope, err := envelopeOf(ctx, topic, payload)
+	if err != nil {
+		return nil, err
+	}
+	request, err := envelopeMsg(topic, envelope)
+	if err != nil {
+		return nil, err
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	msg, err := nc.RequestMsgWithContext(ctx, request)
+	if eris.Is(err, nats.ErrNoResponders) {
+		return nil, eris.Wrapf(ErrNoResponders, "failed to request topic %s", topic)
+	}
+	if err != nil {
+		return nil, eris.Wrapf(err, "failed to request topic %s", topic)
+	}
+	return openEnvelope(&BrokerMessage{Topic: msg.Subject, Data: msg.Data}, msg.Header), nil
+}
+
+// Reply implements MessageBroker.
+func (h *HorizonMessageBroker) Reply(ctx context.Context, msg *BrokerMessage, payload any) error {
+	if msg.Reply == "" {
+		return eris.Errorf("message from topic %s does not expect a reply", msg.Topic)
+	}
+	return h.Publish(ctx, msg.Reply, payload)
+}
+
+// SubscribeDurable implements MessageBroker.
+func (h *HorizonMessageBroker) SubscribeDurable(ctx context.Context, topic string, consumer BrokerConsumer, handler MessageHandler) (Subscription, error) {
+	js := h.jetstream()
+	if js == nil {
+		return nil, eris.New("JetStream is not enabled: no streams configured")
 	}
-	_, err := h.nc.Subscribe(topic, func(msg *nats.Msg) {
-		var payload map[string]interface{}
-		if err := json.Unmarshal(msg.Data, &payload); err != nil {
-			fmt.Printf("failed to unmarshal message from topic %s: %v\n", topic, err)
+	stream := h.streamFor(topic)
+	if stream == "" {
+		return nil, eris.Errorf("topic %s does not belong to any stream", topic)
+	}
+	config := jetstream.ConsumerConfig{
+		Durable:       consumer.Durable,
+		FilterSubject: topic,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       consumer.AckWait,
+		MaxDeliver:    consumer.MaxDeliver,
+		DeliverPolicy: jetstream.DeliverNewPolicy,
+	}
+	if len(consumer.Backoff) > 0 && (consumer.MaxDeliver <= 0 || consumer.MaxDeliver > len(consumer.Backoff)) {
+		config.BackOff = consumer.Backoff
+	}
+	switch {
+	case consumer.StartSequence > 0:
+		config.DeliverPolicy = jetstream.DeliverByStartSequencePolicy
+		config.OptStartSeq = consumer.StartSequence
+	case !consumer.StartTime.IsZero():
+		config.DeliverPolicy = jetstream.DeliverByStartTimePolicy
+		config.OptStartTime = &consumer.StartTime
+	}
+	if consumer.Durable != "" {
+		// The start position of an existing consumer cannot change
+		if existing, err := js.Consumer(ctx, stream, consumer.Durable); err == nil {
+			info := existing.CachedInfo()
+			config.DeliverPolicy = info.Config.DeliverPolicy
+			config.OptStartSeq = info.Config.OptStartSeq
+			config.OptStartTime = info.Config.OptStartTime
+		} else if !eris.Is(err, jetstream.ErrConsumerNotFound) {
+			return nil, eris.Wrapf(err, "failed to look up consumer %s", consumer.Durable)
+		}
+	}
+	created, err := js.CreateOrUpdateConsumer(ctx, stream, config)
+	if err != nil {
+		return nil, eris.Wrapf(err, "failed to create consumer for topic %s", topic)
+	}
+	consume, err := created.Consume(func(msg jetstream.Msg) {
+		message := openEnvelope(&BrokerMessage{Topic: msg.Subject(), Data: msg.Data()}, msg.Headers())
+		if err := handler(handlerContext(ctx, message), message); err != nil {
+			h.reportError(msg.Subject(), err)
+			attempts := 1
+			if metadata, metaErr := msg.Metadata(); metaErr == nil {
+				attempts = int(metadata.NumDelivered)
+			}
+			exhausted := eris.Is(err, ErrUndecodable) || (consumer.MaxDeliver > 0 && attempts >= consumer.MaxDeliver)
+			if exhausted && consumer.DeadLetter {
+				if deadErr := publishDeadLetter(ctx, h, consumer.Durable, message, err, attempts); deadErr != nil {
+					h.reportError(msg.Subject(), eris.Wrap(deadErr, "failed to dead-letter message"))
+					_ = msg.NakWithDelay(redeliveryDelay(msg, consumer.Backoff))
+					return
+				}
+			}
+			if exhausted {
+				_ = msg.Term()
+				return
+			}
+			_ = msg.NakWithDelay(redeliveryDelay(msg, consumer.Backoff))
 			return
 		}
-		if err := handler(payload); err != nil {
-			fmt.Printf("handler error for topic %s: %v\n", topic, err)
+		if err := msg.Ack(); err != nil {
+			h.reportError(msg.Subject(), eris.Wrap(err, "failed to acknowledge message"))
 		}
 	})
-
 	if err != nil {
-		return eris.Wrap(err, fmt.Sprintf("failed to subscribe to topic %s", topic))
+		return nil, eris.Wrapf(err, "failed to consume topic %s", topic)
+	}
+	return h.track(ctx, &brokerSubscription{
+		unsubscribe: func() error {
+			consume.Stop()
+			return nil
+		},
+		drain: func() error {
+			consume.Drain()
+			return nil
+		},
+	}), nil
+}
+
+// OnError implements MessageBroker.
+func (h *HorizonMessageBroker) OnError(handler ErrorHandler) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if handler == nil {
+		handler = PrintError
+	}
+	h.onError = handler
+}
+
+func (h *HorizonMessageBroker) reportError(topic string, err error) {
+	h.mutex.Lock()
+	onError := h.onError
+	h.mutex.Unlock()
+	onError(topic, err)
+}
+
+// track keeps subscription until it ends, which happens at the latest when ctx is cancelled
+func (h *HorizonMessageBroker) track(ctx context.Context, subscription *brokerSubscription) Subscription {
+	h.mutex.Lock()
+	h.subscriptions[subscription] = struct{}{}
+	h.mutex.Unlock()
+	subscription.release = func() {
+		h.mutex.Lock()
+		delete(h.subscriptions, subscription)
+		h.mutex.Unlock()
+	}
+	subscription.mutex.Lock()
+	subscription.stop = context.AfterFunc(ctx, func() {
+		_ = subscription.Unsubscribe()
+	})
+	subscription.mutex.Unlock()
+	return subscription
+}
+
+// brokerSubscription ends a subscription once, through Unsubscribe, Drain or its context
+type brokerSubscription struct {
+	mutex       sync.Mutex
+	ended       bool
+	unsubscribe func() error
+	drain       func() error
+	release     func()
+	stop        func() bool
+}
+
+func (b *brokerSubscription) Unsubscribe() error {
+	return b.end(b.unsubscribe)
+}
+
+func (b *brokerSubscription) Drain() error {
+	return b.end(b.drain)
+}
+
+func (b *brokerSubscription) end(fn func() error) error {
+	b.mutex.Lock()
+	if b.ended {
+		b.mutex.Unlock()
+		return nil
+	}
+	b.ended = true
+	stop := b.stop
+	b.mutex.Unlock()
+	if stop != nil {
+		stop()
+	}
+	b.release()
+	if err := fn(); err != nil {
+		return eris.Wrap(err, "failed to end subscription")
 	}
 	return nil
 }
+
+// PrintError is the default ErrorHandler, which prints err to standard output
+func PrintError(topic string, err error) {
+	if topic == "" {
+		fmt.Printf("error: %v\n", err)
+		return
+	}
+	fmt.Printf("handler error for topic %s: %v\n", topic, err)
+}
+
+// envelopeMsg encodes envelope as the body and headers of a message to topic
+func envelopeMsg(topic string, envelope *Envelope) (*nats.Msg, error) {
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		return nil, eris.Wrapf(err, "failed to marshal envelope for topic %s", topic)
+	}
+	return &nats.Msg{Subject: topic, Data: data, Header: envelope.Header(topic)}, nil
+}
+
+// streamFor returns the name of the stream with a subject matching topic
+func (h *HorizonMessageBroker) streamFor(topic string) string {
+	for _, stream := range h.streams {
+		for _, subject := range stream.Subjects {
+			if SubjectMatches(subject, topic) {
+				return stream.Name
+			}
+		}
+	}
+	return ""
+}
+
+// redeliveryDelay picks the backoff delay for the delivery attempt of msg
+func redeliveryDelay(msg jetstream.Msg, backoff []time.Duration) time.Duration {
+	if len(backoff) == 0 {
+		return 0
+	}
+	attempt := 1
+	if metadata, err := msg.Metadata(); err == nil {
+		attempt = int(metadata.NumDelivered)
+	}
+	return backoff[min(max(attempt, 1), len(backoff))-1]
+}
+
+// streamName derives a stream name from a subject: feedback.> becomes FEEDBACK
+func streamName(subject string) string {
+	token, _, _ := strings.Cut(subject, ".")
+	return strings.ToUpper(strings.NewReplacer("*", "ALL", ">", "ALL").Replace(token))
+}
+
+// SubjectMatches reports whether subject matches pattern, where * in pattern
+// matches exactly one token and a trailing > matches one or more
+func SubjectMatches(pattern, subject string) bool {
+	patterns := strings.Split(pattern, ".")
+	subjects := strings.Split(subject, ".")
+	for i, token := range patterns {
+		if token == ">" {
+			return i == len(patterns)-1 && len(subjects) > i
+		}
+		if i >= len(subjects) || (token != "*" && token != subjects[i]) {
+			return false
+		}
+	}
+	return len(patterns) == len(subjects)
+}
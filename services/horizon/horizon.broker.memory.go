@@ -0,0 +1,445 @@
+package horizon
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rotisserie/eris"
+)
+
+/*
+broker := horizon.NewMemoryMessageBroker(horizon.DeliverSync)
+service := &horizon_services.HorizonService{Broker: broker}
+
+...
+
+created := broker.Messages("feedback.create.*")
+*/
+
+// MemoryDelivery selects how MemoryMessageBroker runs handlers
+type MemoryDelivery int
+
+const (
+	// DeliverSync runs every handler before Publish returns, which keeps tests deterministic
+	DeliverSync MemoryDelivery = iota
+
+	// DeliverAsync runs each handler on its own goroutine, as NATS does; Wait blocks until they finish
+	DeliverAsync
+)
+
+// DefaultMemoryCapacity is the number of messages a memory broker keeps by default
+const DefaultMemoryCapacity = 10000
+
+// MemoryMessageBroker is an in-process MessageBrokerService for tests and single
+// node runs. Subjects support the NATS wildcards * and >, and the latest
+// published messages are captured for inspection, the oldest being dropped once
+// the capacity is reached as from a stream limited by MaxMsgs. Durable consumers
+// replay the captured messages and redeliver failed ones without waiting for
+// their backoff.
+type MemoryMessageBroker struct {
+	delivery MemoryDelivery
+	capacity int
+	sequence uint64
+
+	mutex         sync.Mutex
+	onError       ErrorHandler
+	subscriptions []*memorySubscription
+	messages      []*memoryMessage
+	queues        map[string]int
+	inbox         int
+	pending       sync.WaitGroup
+	since         time.Time
+}
+
+// memoryMessage is a captured message with the sequence and time a durable consumer replays from
+type memoryMessage struct {
+	*BrokerMessage
+	sequence uint64
+	time     time.Time
+}
+
+// memorySubscription is a handler registered on the memory broker; queue holds
+// the queue group, or the consumer name of a durable subscription
+type memorySubscription struct {
+	broker     *MemoryMessageBroker
+	topic      string
+	queue      string
+	handler    MessageHandler
+	ctx        context.Context
+	maxDeliver int
+	deadLetter bool
+
+	mutex sync.Mutex
+	ended bool
+	stop  func() bool
+}
+
+// NewMemoryMessageBroker creates an in-process broker running handlers as delivery selects
+func NewMemoryMessageBroker(delivery MemoryDelivery) *MemoryMessageBroker {
+	return &MemoryMessageBroker{
+		delivery: delivery,
+		capacity: DefaultMemoryCapacity,
+		onError:  PrintError,
+		queues:   map[string]int{},
+		since:    time.Now().UTC(),
+	}
+}
+
+// Run implements MessageBroker.
+func (m *MemoryMessageBroker) Run(ctx context.Context) error {
+	return nil
+}
+
+// Stop implements MessageBroker.
+func (m *MemoryMessageBroker) Stop(ctx context.Context) error {
+	m.mutex.Lock()
+	subscriptions := m.subscriptions
+	m.subscriptions = nil
+	m.mutex.Unlock()
+	for _, subscription := range subscriptions {
+		subscription.end()
+	}
+	done := make(chan struct{})
+	go func() {
+		m.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return eris.Wrap(ctx.Err(), "memory broker handlers did not finish in time")
+	}
+}
+
+// Ping implements MessageBroker.
+func (m *MemoryMessageBroker) Ping(ctx context.Context) error {
+	return nil
+}
+
+// Status implements MessageBroker.
+func (m *MemoryMessageBroker) Status() BrokerStatus {
+	return BrokerStatus{State: BrokerConnected, Server: "memory", Since: m.since}
+}
+
+// Publish implements MessageBroker.
+func (m *MemoryMessageBroker) Publish(ctx context.Context, topic string, payload any) error {
+	envelope, err := envelopeOf(ctx, topic, payload)
+	if err != nil {
+		return err
+	}
+	m.deliver(&BrokerMessage{Topic: topic, Data: envelope.Data, Envelope: envelope})
+	return nil
+}
+
+// Dispatch implements MessageBroker.
+func (m *MemoryMessageBroker) Dispatch(ctx context.Context, topics []string, payload any) error {
+	if len(topics) == 0 {
+		return nil
+	}
+	envelope, err := envelopeOf(ctx, topics[0], payload)
+	if err != nil {
+		return err
+	}
+	for _, topic := range topics {
+		m.deliver(&BrokerMessage{Topic: topic, Data: envelope.Data, Envelope: envelope})
+	}
+	return nil
+}
+
+// Subscribe implements MessageBroker.
+func (m *MemoryMessageBroker) Subscribe(ctx context.Context, topic string, handler func(any) error) (Subscription, error) {
+	return m.SubscribeMessage(ctx, topic, Typed(func(_ context.Context, payload any) error {
+		return handler(payload)
+	}))
+}
+
+// SubscribeMessage implements MessageBroker.
+func (m *MemoryMessageBroker) SubscribeMessage(ctx context.Context, topic string, handler MessageHandler) (Subscription, error) {
+	return m.subscribe(ctx, &memorySubscription{topic: topic, handler: handler}), nil
+}
+
+// QueueSubscribe implements MessageBroker.
+func (m *MemoryMessageBroker) QueueSubscribe(ctx context.Context, topic string, queue string, handler MessageHandler) (Subscription, error) {
+	if queue == "" {
+		return nil, eris.Errorf("queue group is required to subscribe to topic %s", topic)
+	}
+	return m.subscribe(ctx, &memorySubscription{topic: topic, queue: queue, handler: handler}), nil
+}
+
+// SubscribeDurable implements MessageBroker.
+func (m *MemoryMessageBroker) SubscribeDurable(ctx context.Context, topic string, consumer BrokerConsumer, handler MessageHandler) (Subscription, error) {
+	subscription := &memorySubscription{
+		topic:      topic,
+		handler:    handler,
+		maxDeliver: consumer.MaxDeliver,
+		deadLetter: consumer.DeadLetter,
+	}
+	if consumer.Durable != "" {
+		subscription.queue = "durable:" + consumer.Durable
+	}
+	if subscription.maxDeliver <= 0 {
+		subscription.maxDeliver = len(consumer.Backoff) + 1
+	}
+	m.subscribe(ctx, subscription)
+
+	if consumer.StartSequence > 0 || !consumer.StartTime.IsZero() {
+		m.mutex.Lock()
+		var replay []*BrokerMessage
+		for _, message := range m.messages {
+			if message.sequence >= consumer.StartSequence && !message.time.Before(consumer.StartTime) && SubjectMatches(topic, message.Topic) {
+				replay = append(replay, message.BrokerMessage)
+			}
+		}
+		m.mutex.Unlock()
+		for _, message := range replay {
+			m.run(subscription, message)
+		}
+	}
+	return subscription, nil
+}
+
+// Request implements MessageBroker.
+func (m *MemoryMessageBroker) Request(ctx context.Context, topic string, payload any, timeout time.Duration) (*BrokerMessage, error) {
+	envelope, err := envelopeOf(ctx, topic, payload)
+	if err != nil {
+		return nil, err
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	m.mutex.Lock()
+	m.inbox++
+	inbox := fmt.Sprintf("_INBOX.memory.%d", m.inbox)
+	responders := slices.ContainsFunc(m.subscriptions, func(subscription *memorySubscription) bool {
+		return SubjectMatches(subscription.topic, topic)
+	})
+	m.mutex.Unlock()
+	if !responders {
+		return nil, eris.Wrapf(ErrNoResponders, "failed to request topic %s", topic)
+	}
+
+	replies := make(chan *BrokerMessage, 1)
+	subscription := m.subscribe(ctx, &memorySubscription{topic: inbox, handler: func(_ context.Context, msg *BrokerMessage) error {
+		select {
+		case replies <- msg:
+		default:
+		}
+		return nil
+	}})
+	defer subscription.Unsubscribe()
+
+	m.deliver(&BrokerMessage{Topic: topic, Data: envelope.Data, Envelope: envelope, Reply: inbox})
+	select {
+	case reply := <-replies:
+		return reply, nil
+	case <-ctx.Done():
+		return nil, eris.Wrapf(ctx.Err(), "failed to request topic %s", topic)
+	}
+}
+
+// Reply implements MessageBroker.
+func (m *MemoryMessageBroker) Reply(ctx context.Context, msg *BrokerMessage, payload any) error {
+	if msg.Reply == "" {
+		return eris.Errorf("message from topic %s does not expect a reply", msg.Topic)
+	}
+	return m.Publish(ctx, msg.Reply, payload)
+}
+
+// OnError implements MessageBroker.
+func (m *MemoryMessageBroker) OnError(handler ErrorHandler) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if handler == nil {
+		handler = PrintError
+	}
+	m.onError = handler
+}
+
+// Messages returns the captured messages whose topic matches pattern, oldest first
+func (m *MemoryMessageBroker) Messages(pattern string) []*BrokerMessage {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var messages []*BrokerMessage
+	for _, message := range m.messages {
+		if SubjectMatches(pattern, message.Topic) {
+			messages = append(messages, message.BrokerMessage)
+		}
+	}
+	return messages
+}
+
+// Topics returns the topic of every captured message, oldest first
+func (m *MemoryMessageBroker) Topics() []string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	topics := make([]string, len(m.messages))
+	for i, message := range m.messages {
+		topics[i] = message.Topic
+	}
+	return topics
+}
+
+// SetCapacity bounds the captured messages to the latest capacity; zero or less
+// restores DefaultMemoryCapacity
+func (m *MemoryMessageBroker) SetCapacity(capacity int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if capacity <= 0 {
+		capacity = DefaultMemoryCapacity
+	}
+	m.capacity = capacity
+	if excess := len(m.messages) - capacity; excess > 0 {
+		m.messages = slices.Clone(m.messages[excess:])
+	}
+}
+
+// Reset forgets the captured messages
+func (m *MemoryMessageBroker) Reset() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.messages = nil
+}
+
+// Wait blocks until the handlers started by DeliverAsync have finished
+func (m *MemoryMessageBroker) Wait() {
+	m.pending.Wait()
+}
+
+// subscribe registers subscription until it ends, at the latest when ctx is cancelled
+func (m *MemoryMessageBroker) subscribe(ctx context.Context, subscription *memorySubscription) *memorySubscription {
+	subscription.broker = m
+	subscription.ctx = ctx
+	m.mutex.Lock()
+	m.subscriptions = append(m.subscriptions, subscription)
+	m.mutex.Unlock()
+	subscription.mutex.Lock()
+	subscription.stop = context.AfterFunc(ctx, func() {
+		_ = subscription.Unsubscribe()
+	})
+	subscription.mutex.Unlock()
+	return subscription
+}
+
+// deliver captures msg, dropping the oldest message beyond the capacity, and hands
+// it to every matching subscription and to one member of each matching queue group in turn
+func (m *MemoryMessageBroker) deliver(msg *BrokerMessage) {
+	m.mutex.Lock()
+	m.sequence++
+	m.messages = append(m.messages, &memoryMessage{
+		BrokerMessage: msg,
+		sequence:      m.sequence,
+		time:          time.Now(),
+	})
+	if len(m.messages) > m.capacity {
+		m.messages[0] = nil
+		m.messages = m.messages[1:]
+	}
+	var targets []*memorySubscription
+	groups := map[string][]*memorySubscription{}
+	var order []string
+	for _, subscription := range m.subscriptions {
+		if !SubjectMatches(subscription.topic, msg.Topic) || subscription.ctx.Err() != nil {
+			continue
+		}
+		if subscription.queue == "" {
+			targets = append(targets, subscription)
+			continue
+		}
+		if _, ok := groups[subscription.queue]; !ok {
+			order = append(order, subscription.queue)
+		}
+		groups[subscription.queue] = append(groups[subscription.queue], subscription)
+	}
+	for _, queue := range order {
+		members := groups[queue]
+		targets = append(targets, members[m.queues[queue]%len(members)])
+		m.queues[queue]++
+	}
+	m.mutex.Unlock()
+
+	for _, subscription := range targets {
+		m.run(subscription, msg)
+	}
+}
+
+// run calls the handler of subscription, redelivering up to its maxDeliver and
+// dead-lettering the message when the last delivery fails
+func (m *MemoryMessageBroker) run(subscription *memorySubscription, msg *BrokerMessage) {
+	handle := func() {
+		for attempt := 1; ; attempt++ {
+			if subscription.isEnded() || subscription.ctx.Err() != nil {
+				return
+			}
+			err := subscription.handler(handlerContext(subscription.ctx, msg), msg)
+			if err == nil {
+				return
+			}
+			m.mutex.Lock()
+			onError := m.onError
+			m.mutex.Unlock()
+			onError(msg.Topic, err)
+			if attempt >= subscription.maxDeliver || eris.Is(err, ErrUndecodable) {
+				if subscription.deadLetter {
+					name := strings.TrimPrefix(subscription.queue, "durable:")
+					if deadErr := publishDeadLetter(subscription.ctx, m, name, msg, err, attempt); deadErr != nil {
+						onError(msg.Topic, eris.Wrap(deadErr, "failed to dead-letter message"))
+					}
+				}
+				return
+			}
+		}
+	}
+	if m.delivery == DeliverAsync {
+		m.pending.Add(1)
+		go func() {
+			defer m.pending.Done()
+			handle()
+		}()
+		return
+	}
+	handle()
+}
+
+// Unsubscribe implements Subscription.
+func (s *memorySubscription) Unsubscribe() error {
+	s.broker.mutex.Lock()
+	s.broker.subscriptions = slices.DeleteFunc(s.broker.subscriptions, func(other *memorySubscription) bool {
+		return other == s
+	})
+	s.broker.mutex.Unlock()
+	s.end()
+	return nil
+}
+
+// Drain implements Subscription. Delivery to the memory broker is immediate,
+// so nothing is left to drain.
+func (s *memorySubscription) Drain() error {
+	return s.Unsubscribe()
+}
+
+func (s *memorySubscription) end() {
+	s.mutex.Lock()
+	if s.ended {
+		s.mutex.Unlock()
+		return
+	}
+	s.ended = true
+	stop := s.stop
+	s.mutex.Unlock()
+	if stop != nil {
+		stop()
+	}
+}
+
+func (s *memorySubscription) isEnded() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.ended
+}
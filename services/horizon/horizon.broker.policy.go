@@ -0,0 +1,286 @@
+package horizon
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/rotisserie/eris"
+)
+
+/*
+policy := horizon.NewHorizonTopicPolicy(
+	horizon.TopicRule{Pattern: "tenant.{organization}.{branch}.>", Require: horizon.ClaimOrganization, Subscribe: true},
+	horizon.TopicRule{Pattern: "user.{user}.>", Require: horizon.ClaimUser, Subscribe: true, Publish: true},
+	horizon.TopicRule{Pattern: "feedback.*.{id}", Require: horizon.ClaimUser, Subscribe: true},
+	horizon.TopicRule{Pattern: "feedback.>", Require: horizon.ClaimAdmin, Subscribe: true},
+)
+
+broker := horizon.NewPolicyMessageBroker(broker, policy)
+broker.SubscribeMessage(horizon.WithBrokerClaims(ctx, claims), "user."+claims.UserID+".notification", handler)
+*/
+
+// ErrTopicForbidden is returned when the claims of a client do not allow it to
+// subscribe or publish to a topic
+var ErrTopicForbidden = eris.New("topic forbidden")
+
+// TopicAction is what a client wants to do with a topic
+type TopicAction string
+
+const (
+	TopicSubscribe TopicAction = "subscribe"
+	TopicPublish   TopicAction = "publish"
+)
+
+// ClaimRequirement lists the claims a topic rule requires, combined with |
+type ClaimRequirement int
+
+const (
+	ClaimUser ClaimRequirement = 1 << iota
+	ClaimOrganization
+	ClaimBranch
+	ClaimAdmin
+)
+
+// BrokerClaims identifies the client a subscription or publish is made for,
+// usually taken from its user and user organization tokens
+type BrokerClaims struct {
+	UserID         string
+	OrganizationID string
+	BranchID       string
+
+	// Admin is set for the users the application trusts with every topic a rule requiring ClaimAdmin covers
+	Admin bool
+}
+
+type brokerClaimsContextKey struct{}
+
+// WithBrokerClaims returns a context whose broker calls are checked against claims
+func WithBrokerClaims(ctx context.Context, claims BrokerClaims) context.Context {
+	return context.WithValue(ctx, brokerClaimsContextKey{}, claims)
+}
+
+// BrokerClaimsFromContext returns the claims stored by WithBrokerClaims
+func BrokerClaimsFromContext(ctx context.Context) (BrokerClaims, bool) {
+	claims, ok := ctx.Value(brokerClaimsContextKey{}).(BrokerClaims)
+	return claims, ok
+}
+
+// has reports whether claims carry every claim of require
+func (c BrokerClaims) has(require ClaimRequirement) bool {
+	return (require&ClaimUser == 0 || claimValue(c.UserID) != "") &&
+		(require&ClaimOrganization == 0 || claimValue(c.OrganizationID) != "") &&
+		(require&ClaimBranch == 0 || claimValue(c.BranchID) != "") &&
+		(require&ClaimAdmin == 0 || c.Admin)
+}
+
+// TopicRule declares a topic clients may use. The tokens {user}, {organization}
+// and {branch} of Pattern stand for the claims of the client, so a rule only
+// covers the topics of its own user or tenant. A client without a branch claim
+// acts for every branch of its organization. The token {id} stands for any one
+// token but a wildcard, so that a client follows entities one by one and never
+// a whole collection.
+type TopicRule struct {
+	Pattern   string
+	Require   ClaimRequirement
+	Subscribe bool
+	Publish   bool
+}
+
+// TopicPolicy decides which topics clients may subscribe and publish to. Topics
+// no rule covers are forbidden.
+type TopicPolicy interface {
+	// Authorize returns ErrTopicForbidden unless a rule lets claims perform action on topic
+	Authorize(claims BrokerClaims, action TopicAction, topic string) error
+
+	// Permission binds claims to the policy, for the gateway to check a connection with
+	Permission(claims BrokerClaims) TopicPermission
+
+	// Rules returns the declared rules
+	Rules() []TopicRule
+}
+
+type HorizonTopicPolicy struct {
+	rules []TopicRule
+}
+
+// NewHorizonTopicPolicy creates a policy allowing what rules declare and nothing else
+func NewHorizonTopicPolicy(rules ...TopicRule) TopicPolicy {
+	return &HorizonTopicPolicy{rules: rules}
+}
+
+// Authorize implements TopicPolicy.
+func (h *HorizonTopicPolicy) Authorize(claims BrokerClaims, action TopicAction, topic string) error {
+	for _, rule := range h.rules {
+		if (action == TopicSubscribe && !rule.Subscribe) || (action == TopicPublish && !rule.Publish) {
+			continue
+		}
+		if !claims.has(rule.Require) {
+			continue
+		}
+		pattern, ok := rule.expand(claims)
+		if ok && covers(pattern, topic) {
+			return nil
+		}
+	}
+	return eris.Wrapf(ErrTopicForbidden, "%s to %s is not allowed", action, topic)
+}
+
+// Permission implements TopicPolicy.
+func (h *HorizonTopicPolicy) Permission(claims BrokerClaims) TopicPermission {
+	return func(action TopicAction, topic string) error {
+		return h.Authorize(claims, action, topic)
+	}
+}
+
+// Rules implements TopicPolicy.
+func (h *HorizonTopicPolicy) Rules() []TopicRule {
+	return h.rules
+}
+
+// expand replaces the claim tokens of the pattern with the claims of the client.
+// It fails when the pattern refers to a claim the client does not have.
+func (r TopicRule) expand(claims BrokerClaims) (string, bool) {
+	tokens := strings.Split(r.Pattern, ".")
+	for i, token := range tokens {
+		var value string
+		switch token {
+		case "{user}":
+			value = claimValue(claims.UserID)
+		case "{organization}":
+			value = claimValue(claims.OrganizationID)
+		case "{branch}":
+			value = claimValue(claims.BranchID)
+			if value == "" {
+				value = "*"
+			}
+		default:
+			continue
+		}
+		if value == "" {
+			return "", false
+		}
+		tokens[i] = value
+	}
+	return strings.Join(tokens, "."), true
+}
+
+// claimValue returns value unless it could not stand as a single subject token
+func claimValue(value string) string {
+	if strings.ContainsAny(value, ".*> \t\r\n") {
+		return ""
+	}
+	return value
+}
+
+// covers reports whether every subject topic matches is also matched by pattern.
+// Unlike SubjectMatches it treats the wildcards of topic as wildcards, so a rule
+// on feedback.* does not cover a subscription to feedback.>, and only a literal
+// * of pattern covers a * of topic.
+func covers(pattern, topic string) bool {
+	patterns := strings.Split(pattern, ".")
+	topics := strings.Split(topic, ".")
+	for i, token := range patterns {
+		if token == ">" {
+			return len(topics) > i
+		}
+		if i >= len(topics) || topics[i] == ">" {
+			return false
+		}
+		switch token {
+		case "*":
+		case "{id}":
+			if topics[i] == "*" {
+				return false
+			}
+		default:
+			if token != topics[i] {
+				return false
+			}
+		}
+	}
+	return len(patterns) == len(topics)
+}
+
+// PolicyMessageBroker checks the claims carried by the context of each call
+// against a TopicPolicy before passing it to the broker it wraps. Calls without
+// claims come from the server itself, such as the outbox relay, and are trusted.
+type PolicyMessageBroker struct {
+	MessageBrokerService
+	policy TopicPolicy
+}
+
+// NewPolicyMessageBroker wraps broker so that clients only reach the topics policy allows
+func NewPolicyMessageBroker(broker MessageBrokerService, policy TopicPolicy) MessageBrokerService {
+	return &PolicyMessageBroker{MessageBrokerService: broker, policy: policy}
+}
+
+// Publish implements MessageBrokerService.
+func (p *PolicyMessageBroker) Publish(ctx context.Context, topic string, payload any) error {
+	if err := p.authorize(ctx, TopicPublish, topic); err != nil {
+		return err
+	}
+	return p.MessageBrokerService.Publish(ctx, topic, payload)
+}
+
+// Dispatch implements MessageBrokerService.
+func (p *PolicyMessageBroker) Dispatch(ctx context.Context, topics []string, payload any) error {
+	if err := p.authorize(ctx, TopicPublish, topics...); err != nil {
+		return err
+	}
+	return p.MessageBrokerService.Dispatch(ctx, topics, payload)
+}
+
+// Subscribe implements MessageBrokerService.
+func (p *PolicyMessageBroker) Subscribe(ctx context.Context, topic string, handler func(any) error) (Subscription, error) {
+	if err := p.authorize(ctx, TopicSubscribe, topic); err != nil {
+		return nil, err
+	}
+	return p.MessageBrokerService.Subscribe(ctx, topic, handler)
+}
+
+// SubscribeMessage implements MessageBrokerService.
+func (p *PolicyMessageBroker) SubscribeMessage(ctx context.Context, topic string, handler MessageHandler) (Subscription, error) {
+	if err := p.authorize(ctx, TopicSubscribe, topic); err != nil {
+		return nil, err
+	}
+	return p.MessageBrokerService.SubscribeMessage(ctx, topic, handler)
+}
+
+// QueueSubscribe implements MessageBrokerService.
+func (p *PolicyMessageBroker) QueueSubscribe(ctx context.Context, topic string, queue string, handler MessageHandler) (Subscription, error) {
+	if err := p.authorize(ctx, TopicSubscribe, topic); err != nil {
+		return nil, err
+	}
+	return p.MessageBrokerService.QueueSubscribe(ctx, topic, queue, handler)
+}
+
+// SubscribeDurable implements MessageBrokerService.
+func (p *PolicyMessageBroker) SubscribeDurable(ctx context.Context, topic string, consumer BrokerConsumer, handler MessageHandler) (Subscription, error) {
+	if err := p.authorize(ctx, TopicSubscribe, topic); err != nil {
+		return nil, err
+	}
+	return p.MessageBrokerService.SubscribeDurable(ctx, topic, consumer, handler)
+}
+
+// Request implements MessageBrokerService.
+func (p *PolicyMessageBroker) Request(ctx context.Context, topic string, payload any, timeout time.Duration) (*BrokerMessage, error) {
+	if err := p.authorize(ctx, TopicPublish, topic); err != nil {
+		return nil, err
+	}
+	return p.MessageBrokerService.Request(ctx, topic, payload, timeout)
+}
+
+// authorize checks the claims of ctx, if any, for action on every topic
+func (p *PolicyMessageBroker) authorize(ctx context.Context, action TopicAction, topics ...string) error {
+	claims, ok := BrokerClaimsFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	for _, topic := range topics {
+		if err := p.policy.Authorize(claims, action, topic); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package horizon
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/rotisserie/eris"
+)
+
+/*
+retry := horizon.RetryPolicy{Name: "mailer", MaxAttempts: 5, InitialBackoff: time.Second, DeadLetter: true}
+
+broker.QueueSubscribe(ctx, "feedback.create", "mailer", horizon.Retry(broker, retry, handler))
+broker.SubscribeDurable(ctx, "feedback.>", retry.Consumer("mailer"), handler)
+*/
+
+// DeadLetterPrefix prefixes the topic of a failed message to form its dead-letter topic
+const DeadLetterPrefix = "deadletter"
+
+// DeadLetterTopic is the topic the messages of topic are dead-lettered to, e.g.
+// deadletter.feedback.create
+func DeadLetterTopic(topic string) string {
+	return DeadLetterPrefix + "." + topic
+}
+
+// DeadLetter is published to the dead-letter topic of a message once every
+// attempt to handle it failed. Envelope is the envelope of the failed message;
+// Data is its body when it was published without one.
+type DeadLetter struct {
+	Topic        string          `json:"topic"`
+	Subscription string          `json:"subscription,omitempty"`
+	Envelope     *Envelope       `json:"envelope,omitempty"`
+	Data         json.RawMessage `json:"data,omitempty"`
+	Error        string          `json:"error"`
+	Attempts     int             `json:"attempts"`
+	FailedAt     time.Time       `json:"failed_at"`
+}
+
+// RetryPolicy configures how a subscription retries a failing handler. The delay
+// before retry n is InitialBackoff * Multiplier^(n-1), capped at MaxBackoff.
+type RetryPolicy struct {
+	// Name identifies the subscription in its dead letters
+	Name string
+
+	// MaxAttempts bounds how many times a message is handled, 3 by default
+	MaxAttempts int
+
+	// InitialBackoff defaults to 100ms, Multiplier to 2 and MaxBackoff to 30s
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+
+	// DeadLetter publishes the message to its DeadLetterTopic once the last attempt fails
+	DeadLetter bool
+}
+
+// Attempts returns MaxAttempts or its default
+func (p RetryPolicy) Attempts() int {
+	if p.MaxAttempts <= 0 {
+		return 3
+	}
+	return p.MaxAttempts
+}
+
+// Backoff returns the delay before retrying a message whose attempt failed
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	delay := p.InitialBackoff
+	if delay <= 0 {
+		delay = 100 * time.Millisecond
+	}
+	maxBackoff := p.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = 30 * time.Second
+	}
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	for i := 1; i < attempt && delay < maxBackoff; i++ {
+		delay = time.Duration(float64(delay) * multiplier)
+	}
+	return min(delay, maxBackoff)
+}
+
+// Consumer returns the JetStream consumer named durable that redelivers like the
+// policy: the server waits the backoff between deliveries instead of the handler.
+func (p RetryPolicy) Consumer(durable string) BrokerConsumer {
+	backoff := make([]time.Duration, p.Attempts()-1)
+	for i := range backoff {
+		backoff[i] = p.Backoff(i + 1)
+	}
+	return BrokerConsumer{
+		Durable:    durable,
+		Backoff:    backoff,
+		MaxDeliver: p.Attempts(),
+		DeadLetter: p.DeadLetter,
+	}
+}
+
+// Retry wraps handler so that a failing message is handled again after the
+// backoff of policy, and dead-lettered through broker once the last attempt
+// fails. Retries hold back the following messages of the subscription, so the
+// backoff should stay short; use SubscribeDurable with policy.Consumer for long
+// ones. Undecodable messages are not retried, and a subscription that ends
+// while waiting stops retrying.
+func Retry(broker MessageBrokerService, policy RetryPolicy, handler MessageHandler) MessageHandler {
+	return func(ctx context.Context, msg *BrokerMessage) error {
+		var err error
+		attempt := 1
+		for ; ; attempt++ {
+			if err = handler(ctx, msg); err == nil {
+				return nil
+			}
+			if attempt >= policy.Attempts() || eris.Is(err, ErrUndecodable) {
+				break
+			}
+			timer := time.NewTimer(policy.Backoff(attempt))
+			select {
+			case <-timer.C:
+				continue
+			case <-ctx.Done():
+				timer.Stop()
+			}
+			break
+		}
+		if !policy.DeadLetter {
+			return eris.Wrapf(err, "failed after %d attempts", attempt)
+		}
+		if deadErr := publishDeadLetter(ctx, broker, policy.Name, msg, err, attempt); deadErr != nil {
+			return eris.Wrapf(deadErr, "failed to dead-letter message after %d attempts: %v", attempt, err)
+		}
+		return eris.Wrapf(err, "dead-lettered after %d attempts", attempt)
+	}
+}
+
+// publishDeadLetter publishes msg, which failed with err, to its dead-letter topic
+func publishDeadLetter(ctx context.Context, broker MessageBrokerService, subscription string, msg *BrokerMessage, err error, attempts int) error {
+	letter := DeadLetter{
+		Topic:        msg.Topic,
+		Subscription: subscription,
+		Envelope:     msg.Envelope,
+		Error:        err.Error(),
+		Attempts:     attempts,
+		FailedAt:     time.Now().UTC(),
+	}
+	if msg.Envelope == nil {
+		letter.Data = json.RawMessage(msg.Data)
+		if !json.Valid(msg.Data) {
+			letter.Data, _ = json.Marshal(string(msg.Data))
+		}
+	}
+	return broker.Publish(serverContext(ctx), DeadLetterTopic(msg.Topic), letter)
+}
+
+// serverContext keeps only the trace of ctx, for publishes the server makes on
+// its own behalf that neither the cancellation nor the claims of ctx may stop
+func serverContext(ctx context.Context) context.Context {
+	if trace, ok := TraceFromContext(ctx); ok {
+		return WithTrace(context.Background(), trace)
+	}
+	return context.Background()
+}
@@ -0,0 +1,297 @@
+package horizon
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rotisserie/eris"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	OutboxPending   = "pending"
+	OutboxDelivered = "delivered"
+	OutboxFailed    = "failed"
+)
+
+// OutboxMessage is a broker message waiting to be relayed. It is written in
+// the same transaction as the entity change that produced it.
+type OutboxMessage struct {
+	ID uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+
+	CreatedAt     time.Time  `gorm:"not null;default:now()"`
+	NextAttemptAt time.Time  `gorm:"not null;default:now();index:idx_outbox_pending,priority:2"`
+	DeliveredAt   *time.Time `gorm:"index"`
+
+	Topic     string `gorm:"type:varchar(255);not null"`
+	Payload   []byte `gorm:"type:jsonb;not null"`
+	Status    string `gorm:"type:varchar(20);not null;default:'pending';index:idx_outbox_pending,priority:1"`
+	Attempts  int    `gorm:"not null;default:0"`
+	LastError string `gorm:"type:text"`
+}
+
+func (OutboxMessage) TableName() string {
+	return "horizon_outbox"
+}
+
+// OutboxEntry is one topic and payload passed to EnqueueMany. A payload that is
+// not an *Envelope is wrapped in one when it is enqueued, traced by the context.
+type OutboxEntry struct {
+	Topic   string
+	Payload any
+}
+
+// OutboxService stores broker messages transactionally and relays them to the message broker
+type OutboxService interface {
+	// Run migrates the outbox table and starts the relay worker
+	Run(ctx context.Context) error
+
+	// Stop waits for the relay worker to finish
+	Stop(ctx context.Context) error
+
+	// Enqueue writes one pending message per topic using the provided transaction, all
+	// carrying the same envelope
+	Enqueue(ctx context.Context, tx *gorm.DB, topics []string, payload any) error
+
+	// EnqueueMany writes one pending message per entry in a single insert using the provided transaction
+	EnqueueMany(ctx context.Context, tx *gorm.DB, entries []OutboxEntry) error
+
+	// Notify wakes the relay worker without waiting for the next interval
+	Notify()
+
+	// Relay publishes a batch of due messages and records the outcome of each
+	Relay(ctx context.Context) error
+
+	// OnError replaces the hook receiving the errors of the relay worker, which prints them by default
+	OnError(handler ErrorHandler)
+}
+
+type HorizonOutbox struct {
+	database    SQLDatabaseService
+	broker      MessageBrokerService
+	interval    time.Duration
+	batchSize   int
+	maxAttempts int
+	retention   time.Duration
+
+	mutex  sync.Mutex
+	wake   chan struct{}
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	errorMutex sync.Mutex
+	onError    ErrorHandler
+}
+
+// NewHorizonOutbox creates a new OutboxService instance. A batchSize of zero
+// relays 100 messages at a time and a maxAttempts of zero gives up after 10.
+func NewHorizonOutbox(
+	database SQLDatabaseService,
+	broker MessageBrokerService,
+	interval time.Duration,
+	batchSize int,
+	maxAttempts int,
+	retention time.Duration,
+) OutboxService {
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	if maxAttempts <= 0 {
+		maxAttempts = 10
+	}
+	return &HorizonOutbox{
+		database:    database,
+		broker:      broker,
+		interval:    interval,
+		batchSize:   batchSize,
+		maxAttempts: maxAttempts,
+		retention:   retention,
+		onError:     PrintError,
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// Run implements OutboxService.
+func (h *HorizonOutbox) Run(ctx context.Context) error {
+	if err := h.database.Client().AutoMigrate(&OutboxMessage{}); err != nil {
+		return eris.Wrap(err, "failed to migrate outbox table")
+	}
+	relayCtx, cancel := context.WithCancel(context.Background())
+	h.cancel = cancel
+	h.done = make(chan struct{})
+	go func() {
+		defer close(h.done)
+		interval := h.interval
+		if interval <= 0 {
+			interval = 2 * time.Second
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-relayCtx.Done():
+				return
+			case <-ticker.C:
+			case <-h.wake:
+			}
+			if err := h.Relay(relayCtx); err != nil && relayCtx.Err() == nil {
+				h.reportError(eris.Wrap(err, "outbox relay failed"))
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop implements OutboxService.
+func (h *HorizonOutbox) Stop(ctx context.Context) error {
+	if h.cancel == nil {
+		return nil
+	}
+	h.cancel()
+	select {
+	case <-h.done:
+	case <-ctx.Done():
+		return eris.Wrap(ctx.Err(), "outbox relay did not stop in time")
+	}
+	h.cancel = nil
+	return nil
+}
+
+// OnError implements OutboxService.
+func (h *HorizonOutbox) OnError(handler ErrorHandler) {
+	h.errorMutex.Lock()
+	defer h.errorMutex.Unlock()
+	if handler == nil {
+		handler = PrintError
+	}
+	h.onError = handler
+}
+
+func (h *HorizonOutbox) reportError(err error) {
+	h.errorMutex.Lock()
+	onError := h.onError
+	h.errorMutex.Unlock()
+	onError("", err)
+}
+
+// Enqueue implements OutboxService.
+func (h *HorizonOutbox) Enqueue(ctx context.Context, tx *gorm.DB, topics []string, payload any) error {
+	if len(topics) == 0 {
+		return nil
+	}
+	envelope, err := envelopeOf(ctx, topics[0], payload)
+	if err != nil {
+		return err
+	}
+	entries := make([]OutboxEntry, len(topics))
+	for i, topic := range topics {
+		entries[i] = OutboxEntry{Topic: topic, Payload: envelope}
+	}
+	return h.EnqueueMany(ctx, tx, entries)
+}
+
+// EnqueueMany implements OutboxService.
+func (h *HorizonOutbox) EnqueueMany(ctx context.Context, tx *gorm.DB, entries []OutboxEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	now := time.Now().UTC()
+	messages := make([]*OutboxMessage, len(entries))
+	for i, entry := range entries {
+		envelope, err := envelopeOf(ctx, entry.Topic, entry.Payload)
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(envelope)
+		if err != nil {
+			return eris.Wrapf(err, "failed to marshal outbox payload for topic %s", entry.Topic)
+		}
+		messages[i] = &OutboxMessage{
+			CreatedAt:     now,
+			NextAttemptAt: now,
+			Topic:         entry.Topic,
+			Payload:       data,
+			Status:        OutboxPending,
+		}
+	}
+	if err := tx.CreateInBatches(messages, max(h.batchSize, 100)).Error; err != nil {
+		return eris.Wrap(err, "failed to enqueue outbox messages")
+	}
+	return nil
+}
+
+// Notify implements OutboxService.
+func (h *HorizonOutbox) Notify() {
+	select {
+	case h.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Relay implements OutboxService.
+func (h *HorizonOutbox) Relay(ctx context.Context) error {
+	if !h.mutex.TryLock() {
+		return nil
+	}
+	defer h.mutex.Unlock()
+
+	err := h.database.Client().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var messages []*OutboxMessage
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", OutboxPending, time.Now().UTC()).
+			Order("created_at").
+			Limit(h.batchSize).
+			Find(&messages).Error; err != nil {
+			return eris.Wrap(err, "failed to load pending outbox messages")
+		}
+		for _, message := range messages {
+			now := time.Now().UTC()
+			if err := h.broker.Publish(ctx, message.Topic, outboxPayload(message)); err != nil {
+				message.Attempts++
+				message.LastError = err.Error()
+				message.NextAttemptAt = now.Add(outboxBackoff(message.Attempts))
+				if message.Attempts >= h.maxAttempts {
+					message.Status = OutboxFailed
+				}
+			} else {
+				message.Status = OutboxDelivered
+				message.DeliveredAt = &now
+			}
+			if err := tx.Save(message).Error; err != nil {
+				return eris.Wrapf(err, "failed to update outbox message %s", message.ID)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if h.retention > 0 {
+		if err := h.database.Client().WithContext(ctx).
+			Where("status = ? AND delivered_at < ?", OutboxDelivered, time.Now().UTC().Add(-h.retention)).
+			Delete(&OutboxMessage{}).Error; err != nil {
+			return eris.Wrap(err, "failed to remove delivered outbox messages")
+		}
+	}
+	return nil
+}
+
+// outboxPayload returns the envelope a message was enqueued with, or its raw
+// payload for messages enqueued before envelopes were introduced
+func outboxPayload(message *OutboxMessage) any {
+	envelope := new(Envelope)
+	if err := json.Unmarshal(message.Payload, envelope); err != nil || envelope.ID == uuid.Nil || envelope.Type == "" || envelope.OccurredAt.IsZero() {
+		return json.RawMessage(message.Payload)
+	}
+	return envelope
+}
+
+// outboxBackoff doubles the retry delay per attempt, starting at one second and capped at five minutes
+func outboxBackoff(attempts int) time.Duration {
+	delay := time.Second << min(attempts-1, 9)
+	return min(delay, 5*time.Minute)
+}
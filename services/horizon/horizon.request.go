@@ -4,12 +4,16 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"maps"
+	"net"
 	"net/http"
 	"regexp"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/labstack/echo-contrib/echoprometheus"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
@@ -44,6 +48,12 @@ type APIService interface {
 	GetRoute() []Route
 
 	RegisterRoute(route Route, callback func(c echo.Context) error, m ...echo.MiddlewareFunc)
+
+	// Origins returns the origins allowed to make credentialed requests
+	Origins() []string
+
+	// HealthCheck adds check to the checks /health runs, reported under name when it fails
+	HealthCheck(name string, check func(ctx context.Context) error)
 }
 
 const (
@@ -61,16 +71,31 @@ type Route struct {
 	Response string
 	Method   string
 	Note     string
+
+	// Stream marks a long-lived route, such as a WebSocket or Server-Sent Events
+	// endpoint, which is exempt from the request timeout and from compression
+	Stream bool
 }
 
 type HorizonAPIService struct {
-	service     *echo.Echo
-	serverPort  int
-	metricsPort int
-	clientURL   string
-	clientName  string
+	service        *echo.Echo
+	serverPort     int
+	metricsPort    int
+	clientURL      string
+	clientName     string
+	requestTimeout time.Duration
+	origins        []string
+
+	healthMutex  sync.Mutex
+	healthChecks map[string]func(ctx context.Context) error
+
+	// cancel aborts the context of requests still running once Stop has waited for them
+	cancel context.CancelFunc
 
 	routesList []Route
+
+	streamMutex sync.RWMutex
+	streams     map[string]bool
 }
 
 var suspiciousPathPattern = regexp.MustCompile(`(?i)\.(env|yaml|yml|ini|config|conf|xml|git|htaccess|htpasswd|backup|secret|credential|password|private|key|token|dump|database|db|logs|debug)$|dockerfile|Dockerfile`)
@@ -80,9 +105,28 @@ func NewHorizonAPIService(
 	metricsPort int,
 	clientURL string,
 	clientName string,
+	requestTimeout time.Duration,
 ) APIService {
 	service := echo.New()
 
+	base, cancel := context.WithCancel(context.Background())
+	service.Server.BaseContext = func(net.Listener) context.Context {
+		return base
+	}
+
+	api := &HorizonAPIService{
+		service:        service,
+		serverPort:     serverPort,
+		metricsPort:    metricsPort,
+		clientURL:      clientURL,
+		clientName:     clientName,
+		requestTimeout: requestTimeout,
+		cancel:         cancel,
+		routesList:     []Route{},
+		streams:        map[string]bool{},
+		healthChecks:   map[string]func(ctx context.Context) error{},
+	}
+
 	service.Pre(middleware.RemoveTrailingSlash())
 
 	service.Use(middleware.SecureWithConfig(middleware.SecureConfig{
@@ -132,35 +176,37 @@ func NewHorizonAPIService(
 		}
 	})
 
+	origins := []string{
+		"http://0.0.0.0",
+		"http://0.0.0.0:80",
+		"http://0.0.0.0:3000",
+		"http://0.0.0.0:3001",
+		"http://0.0.0.0:4173",
+		"http://0.0.0.0:8080",
+
+		// Client Docker
+		"http://client",
+		"http://client:80",
+		"http://client:3000",
+		"http://client:3001",
+		"http://client:4173",
+		"http://client:8080",
+
+		// Localhost
+		"http://localhost",
+		"http://localhost:80",
+		"http://localhost:3000",
+		"http://localhost:3001",
+		"http://localhost:4173",
+		"http://localhost:8080",
+		"http://localhost:5173",
+		"http://localhost:5174",
+		"http://localhost:5175",
+		clientURL,
+	}
+
 	service.Use(middleware.CORSWithConfig(middleware.CORSConfig{
-		AllowOrigins: []string{
-			"http://0.0.0.0",
-			"http://0.0.0.0:80",
-			"http://0.0.0.0:3000",
-			"http://0.0.0.0:3001",
-			"http://0.0.0.0:4173",
-			"http://0.0.0.0:8080",
-
-			// Client Docker
-			"http://client",
-			"http://client:80",
-			"http://client:3000",
-			"http://client:3001",
-			"http://client:4173",
-			"http://client:8080",
-
-			// Localhost
-			"http://localhost",
-			"http://localhost:80",
-			"http://localhost:3000",
-			"http://localhost:3001",
-			"http://localhost:4173",
-			"http://localhost:8080",
-			"http://localhost:5173",
-			"http://localhost:5174",
-			"http://localhost:5175",
-			clientURL,
-		},
+		AllowOrigins: origins,
 		AllowMethods: []string{
 			http.MethodGet,
 			http.MethodPost,
@@ -174,28 +220,58 @@ func NewHorizonAPIService(
 			echo.HeaderAccept,
 			echo.HeaderAuthorization,
 			echo.HeaderXRequestedWith,
-		}, ExposeHeaders: []string{echo.HeaderContentLength},
+			"If-Match",
+			"If-None-Match",
+		}, ExposeHeaders: []string{echo.HeaderContentLength, "ETag"},
 		AllowCredentials: true, // must be true if the client sends cookies/auth
 		MaxAge:           3600,
 	}))
 
+	// Trace the broker events caused by the request with its X-Request-ID, or a
+	// new one, and the trace id of its traceparent header
+	service.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			trace := Trace{
+				CorrelationID: c.Request().Header.Get(echo.HeaderXRequestID),
+				TraceID:       ParseTraceParent(c.Request().Header.Get("traceparent")),
+			}
+			if trace.CorrelationID == "" {
+				trace.CorrelationID = uuid.NewString()
+			}
+			c.Response().Header().Set(echo.HeaderXRequestID, trace.CorrelationID)
+			c.SetRequest(c.Request().WithContext(WithTrace(c.Request().Context(), trace)))
+			return next(c)
+		}
+	})
+
+	// Per-request deadline, inherited by every query made with the request context.
+	// File uploads are exempt since their duration depends on the client's bandwidth,
+	// and so are the routes registered as streams, which stay open for as long as
+	// the client listens.
+	if requestTimeout > 0 {
+		service.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+			return func(c echo.Context) error {
+				if strings.HasPrefix(c.Request().Header.Get(echo.HeaderContentType), echo.MIMEMultipartForm) || api.isStream(c) {
+					return next(c)
+				}
+				ctx, cancel := context.WithTimeout(c.Request().Context(), requestTimeout)
+				defer cancel()
+				c.SetRequest(c.Request().WithContext(ctx))
+				return next(c)
+			}
+		})
+	}
+
 	// 9. Metrics middleware
 	service.Use(echoprometheus.NewMiddleware(clientName))
 
 	service.Use(middleware.GzipWithConfig(middleware.GzipConfig{
-		Level: 5,
+		Level:   5,
+		Skipper: api.isStream,
 	}))
-	service.GET("/health", func(c echo.Context) error {
-		return c.String(200, "OK")
-	})
-	return &HorizonAPIService{
-		service:     service,
-		serverPort:  serverPort,
-		metricsPort: metricsPort,
-		clientURL:   clientURL,
-		clientName:  clientName,
-		routesList:  []Route{},
-	}
+	api.origins = origins
+	service.GET("/health", api.health)
+	return api
 }
 
 // Client implements APIService.
@@ -203,6 +279,52 @@ func (h *HorizonAPIService) Client() *echo.Echo {
 	return h.service
 }
 
+// Origins implements APIService.
+func (h *HorizonAPIService) Origins() []string {
+	return h.origins
+}
+
+// HealthCheck implements APIService.
+func (h *HorizonAPIService) HealthCheck(name string, check func(ctx context.Context) error) {
+	h.healthMutex.Lock()
+	defer h.healthMutex.Unlock()
+	h.healthChecks[name] = check
+}
+
+// health answers OK when every health check passes, and 503 with the failed
+// checks otherwise
+func (h *HorizonAPIService) health(c echo.Context) error {
+	h.healthMutex.Lock()
+	names := make([]string, 0, len(h.healthChecks))
+	for name := range h.healthChecks {
+		names = append(names, name)
+	}
+	checks := maps.Clone(h.healthChecks)
+	h.healthMutex.Unlock()
+	sort.Strings(names)
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), 5*time.Second)
+	defer cancel()
+	var failures []string
+	for _, name := range names {
+		if err := checks[name](ctx); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+	if len(failures) > 0 {
+		return c.String(http.StatusServiceUnavailable, strings.Join(failures, "\n"))
+	}
+	return c.String(http.StatusOK, "OK")
+}
+
+// isStream reports whether c was routed to a route registered with Stream. It
+// goes by the matched route rather than by headers the client controls.
+func (h *HorizonAPIService) isStream(c echo.Context) bool {
+	h.streamMutex.RLock()
+	defer h.streamMutex.RUnlock()
+	return h.streams[c.Request().Method+" "+c.Path()]
+}
+
 // GetRoute implements APIService.
 func (h *HorizonAPIService) GetRoute() []Route {
 	return h.routesList
@@ -225,12 +347,18 @@ func (h *HorizonAPIService) RegisterRoute(route Route, callback func(c echo.Cont
 	default:
 		panic(fmt.Sprintf("Unsupported HTTP method: %s", method))
 	}
+	if route.Stream {
+		h.streamMutex.Lock()
+		h.streams[method+" "+route.Route] = true
+		h.streamMutex.Unlock()
+	}
 	h.routesList = append(h.routesList, Route{
 		Route:    route.Route,
 		Request:  route.Request,
 		Response: route.Response,
 		Method:   method,
 		Note:     route.Note,
+		Stream:   route.Stream,
 	})
 }
 
@@ -256,6 +384,7 @@ func (h *HorizonAPIService) Run(ctx context.Context) error {
 
 // Stop implements APIService.
 func (h *HorizonAPIService) Stop(ctx context.Context) error {
+	defer h.cancel()
 	if err := h.service.Shutdown(ctx); err != nil {
 		return eris.New("failed to gracefully shutdown server")
 	}
@@ -0,0 +1,126 @@
+package horizon_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/lands-horizon/horizon-server/services/horizon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// go test -v ./services/horizon_test/horizon.broker.gateway_test.go
+
+func newGatewayServer(t *testing.T, broker horizon.MessageBrokerService) *httptest.Server {
+	gateway := horizon.NewBrokerGateway(broker, nil, func(c echo.Context) (horizon.TopicPermission, error) {
+		if c.Request().Header.Get("X-Test-User") == "" {
+			return nil, echo.NewHTTPError(http.StatusUnauthorized, "authentication required")
+		}
+		return func(action horizon.TopicAction, topic string) error {
+			if !horizon.SubjectMatches("feedback.>", topic) {
+				return echo.NewHTTPError(http.StatusForbidden, string(action)+" to "+topic+" is not allowed")
+			}
+			return nil
+		}, nil
+	})
+	e := echo.New()
+	e.GET("/broadcast/events", gateway.Events)
+	e.GET("/broadcast/ws", gateway.WebSocket)
+	server := httptest.NewServer(e)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestBrokerGateway_Events(t *testing.T) {
+	broker := horizon.NewMemoryMessageBroker(horizon.DeliverSync)
+	defer broker.Stop(context.Background())
+	server := newGatewayServer(t, broker)
+
+	response, err := http.Get(server.URL + "/broadcast/events?topic=feedback.update.42")
+	require.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+
+	forbidden, _ := http.NewRequest(http.MethodGet, server.URL+"/broadcast/events?topic=feedback.update.42&topic=media.create", nil)
+	forbidden.Header.Set("X-Test-User", "user")
+	response, err = http.DefaultClient.Do(forbidden)
+	require.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusForbidden, response.StatusCode)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/broadcast/events?topic=feedback.update.42", nil)
+	request.Header.Set("X-Test-User", "user")
+	response, err = http.DefaultClient.Do(request)
+	require.NoError(t, err)
+	defer response.Body.Close()
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "text/event-stream", response.Header.Get(echo.HeaderContentType))
+
+	require.NoError(t, broker.Publish(context.Background(), "feedback.update.7", map[string]string{"id": "7"}))
+	require.NoError(t, broker.Publish(context.Background(), "feedback.update.42", map[string]string{"id": "42"}))
+
+	reader := bufio.NewReader(response.Body)
+	var frame horizon.GatewayFrame
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		if data, ok := strings.CutPrefix(line, "data: "); ok {
+			require.NoError(t, json.Unmarshal([]byte(data), &frame))
+			break
+		}
+	}
+	assert.Equal(t, horizon.FrameMessage, frame.Type)
+	assert.Equal(t, "feedback.update.42", frame.Topic)
+	assert.Equal(t, "feedback.update.42", frame.Event)
+	assert.JSONEq(t, `{"id":"42"}`, string(frame.Data))
+}
+
+func TestBrokerGateway_WebSocket(t *testing.T) {
+	broker := horizon.NewMemoryMessageBroker(horizon.DeliverSync)
+	defer broker.Stop(context.Background())
+	server := newGatewayServer(t, broker)
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/broadcast/ws"
+
+	_, response, err := websocket.DefaultDialer.Dial(url, nil)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"X-Test-User": {"user"}})
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+
+	var frame horizon.GatewayFrame
+	require.NoError(t, conn.WriteJSON(map[string]string{"action": "subscribe", "topic": "media.create"}))
+	require.NoError(t, conn.ReadJSON(&frame))
+	assert.Equal(t, horizon.FrameError, frame.Type)
+	assert.Contains(t, frame.Error, "not allowed")
+
+	require.NoError(t, conn.WriteJSON(map[string]string{"action": "subscribe", "topic": "feedback.create.*"}))
+	frame = horizon.GatewayFrame{}
+	require.NoError(t, conn.ReadJSON(&frame))
+	assert.Equal(t, horizon.GatewayFrame{Type: horizon.FrameSubscribed, Topic: "feedback.create.*"}, frame)
+
+	require.NoError(t, broker.Publish(context.Background(), "feedback.create.42", map[string]string{"id": "42"}))
+	frame = horizon.GatewayFrame{}
+	require.NoError(t, conn.ReadJSON(&frame))
+	assert.Equal(t, horizon.FrameMessage, frame.Type)
+	assert.Equal(t, "feedback.create.42", frame.Topic)
+	assert.NotEmpty(t, frame.ID)
+	assert.JSONEq(t, `{"id":"42"}`, string(frame.Data))
+
+	require.NoError(t, conn.WriteJSON(map[string]string{"action": "unsubscribe", "topic": "feedback.create.*"}))
+	frame = horizon.GatewayFrame{}
+	require.NoError(t, conn.ReadJSON(&frame))
+	assert.Equal(t, horizon.FrameUnsubscribed, frame.Type)
+}
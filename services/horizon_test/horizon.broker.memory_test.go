@@ -0,0 +1,204 @@
+package horizon_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lands-horizon/horizon-server/services/horizon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// go test -v ./services/horizon_test/horizon.broker.memory_test.go
+
+func TestMemoryMessageBroker_Wildcards(t *testing.T) {
+	ctx := context.Background()
+	broker := horizon.NewMemoryMessageBroker(horizon.DeliverSync)
+	require.NoError(t, broker.Run(ctx))
+	defer broker.Stop(ctx)
+
+	var single, all []string
+	_, err := broker.SubscribeMessage(ctx, "feedback.*", func(_ context.Context, msg *horizon.BrokerMessage) error {
+		single = append(single, msg.Topic)
+		return nil
+	})
+	require.NoError(t, err)
+	_, err = broker.SubscribeMessage(ctx, "feedback.>", func(_ context.Context, msg *horizon.BrokerMessage) error {
+		all = append(all, msg.Topic)
+		return nil
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, broker.Dispatch(ctx, []string{"feedback.create", "feedback.create.42", "media.create"}, map[string]string{"id": "42"}))
+
+	assert.Equal(t, []string{"feedback.create"}, single)
+	assert.Equal(t, []string{"feedback.create", "feedback.create.42"}, all)
+	assert.Equal(t, []string{"feedback.create", "feedback.create.42", "media.create"}, broker.Topics())
+	assert.Len(t, broker.Messages("*.create"), 2)
+
+	var payload map[string]string
+	require.NoError(t, broker.Messages("media.>")[0].Decode(&payload))
+	assert.Equal(t, "42", payload["id"])
+
+	broker.Reset()
+	assert.Empty(t, broker.Topics())
+}
+
+func TestMemoryMessageBroker_AsyncAndCancel(t *testing.T) {
+	broker := horizon.NewMemoryMessageBroker(horizon.DeliverAsync)
+	defer broker.Stop(context.Background())
+
+	type greeting struct {
+		Message string `json:"message"`
+	}
+	var mutex sync.Mutex
+	var received []string
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err := horizon.SubscribeTyped(ctx, broker, "test.async", func(_ context.Context, msg greeting) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		received = append(received, msg.Message)
+		return nil
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, broker.Publish(context.Background(), "test.async", greeting{Message: "hello"}))
+	broker.Wait()
+	cancel()
+	require.NoError(t, broker.Publish(context.Background(), "test.async", greeting{Message: "late"}))
+	broker.Wait()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Equal(t, []string{"hello"}, received)
+}
+
+func TestMemoryMessageBroker_QueueAndRequest(t *testing.T) {
+	ctx := context.Background()
+	broker := horizon.NewMemoryMessageBroker(horizon.DeliverSync)
+	defer broker.Stop(ctx)
+
+	handled := map[string]int{}
+	for _, worker := range []string{"a", "b"} {
+		_, err := broker.QueueSubscribe(ctx, "test.double", "workers", func(ctx context.Context, msg *horizon.BrokerMessage) error {
+			handled[worker]++
+			var n int
+			if err := msg.Decode(&n); err != nil {
+				return err
+			}
+			return broker.Reply(ctx, msg, n*2)
+		})
+		require.NoError(t, err)
+	}
+
+	for i := 1; i <= 4; i++ {
+		reply, err := broker.Request(ctx, "test.double", i, time.Second)
+		require.NoError(t, err)
+		var doubled int
+		require.NoError(t, reply.Decode(&doubled))
+		assert.Equal(t, i*2, doubled)
+	}
+	assert.Equal(t, map[string]int{"a": 2, "b": 2}, handled)
+
+	_, err := broker.Request(ctx, "test.nobody", 1, time.Second)
+	assert.True(t, errors.Is(err, horizon.ErrNoResponders))
+}
+
+func TestMemoryMessageBroker_DurableReplayAndErrors(t *testing.T) {
+	ctx := context.Background()
+	broker := horizon.NewMemoryMessageBroker(horizon.DeliverSync)
+	defer broker.Stop(ctx)
+
+	var failures []error
+	broker.OnError(func(topic string, err error) {
+		failures = append(failures, err)
+	})
+
+	require.NoError(t, broker.Publish(ctx, "orders.created", "first"))
+	require.NoError(t, broker.Publish(ctx, "orders.created", "second"))
+
+	attempts := map[string]int{}
+	_, err := broker.SubscribeDurable(ctx, "orders.>", horizon.BrokerConsumer{
+		Durable:       "billing",
+		Backoff:       []time.Duration{time.Second, time.Second},
+		StartSequence: 2,
+	}, horizon.Typed(func(_ context.Context, order string) error {
+		attempts[order]++
+		if order == "second" && attempts[order] < 3 {
+			return errors.New("not yet")
+		}
+		return nil
+	}))
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]int{"second": 3}, attempts)
+	assert.Len(t, failures, 2)
+
+	require.NoError(t, broker.Publish(ctx, "orders.created", []int{1}))
+	assert.Len(t, failures, 3, "undecodable messages are reported and not redelivered")
+	assert.True(t, errors.Is(failures[2], horizon.ErrUndecodable))
+}
+
+func TestMemoryMessageBroker_Envelopes(t *testing.T) {
+	broker := horizon.NewMemoryMessageBroker(horizon.DeliverSync)
+	defer broker.Stop(context.Background())
+
+	ctx := horizon.WithTrace(context.Background(), horizon.Trace{CorrelationID: "request-1", TraceID: "4bf92f3577b34da6a3ce929d0e0e4736"})
+
+	var handlerTrace horizon.Trace
+	_, err := broker.SubscribeMessage(context.Background(), "feedback.>", func(ctx context.Context, msg *horizon.BrokerMessage) error {
+		handlerTrace, _ = horizon.TraceFromContext(ctx)
+		return nil
+	})
+	require.NoError(t, err)
+	require.NoError(t, broker.Dispatch(ctx, []string{"feedback.create", "feedback.create.42"}, map[string]string{"id": "42"}))
+
+	messages := broker.Messages("feedback.>")
+	require.Len(t, messages, 2)
+	envelope := messages[0].Envelope
+	require.NotNil(t, envelope)
+	assert.Equal(t, "feedback.create", envelope.Type)
+	assert.Equal(t, 1, envelope.SchemaVersion)
+	assert.Equal(t, "request-1", envelope.CorrelationID)
+	assert.False(t, envelope.OccurredAt.IsZero())
+	assert.Equal(t, envelope.ID, messages[1].Envelope.ID, "one event dispatched to several topics shares its id")
+	assert.Equal(t, envelope.Trace(), handlerTrace)
+
+	var payload map[string]string
+	require.NoError(t, messages[0].Decode(&payload))
+	assert.Equal(t, "42", payload["id"])
+
+	header := envelope.Header("feedback.create.42")
+	assert.Equal(t, envelope.ID.String()+":feedback.create.42", header.Get(horizon.HeaderMessageID))
+	assert.Equal(t, "feedback.create", header.Get(horizon.HeaderEventType))
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", header.Get(horizon.HeaderTraceID))
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", horizon.ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"))
+}
+
+func TestMemoryMessageBroker_Capacity(t *testing.T) {
+	ctx := context.Background()
+	broker := horizon.NewMemoryMessageBroker(horizon.DeliverSync)
+	defer broker.Stop(ctx)
+	broker.SetCapacity(2)
+
+	for _, order := range []string{"first", "second", "third"} {
+		require.NoError(t, broker.Publish(ctx, "orders.created", order))
+	}
+	messages := broker.Messages("orders.>")
+	require.Len(t, messages, 2, "the oldest message is dropped")
+	var order string
+	require.NoError(t, messages[0].Decode(&order))
+	assert.Equal(t, "second", order)
+
+	// Sequences keep counting past the dropped messages
+	var replayed []string
+	_, err := broker.SubscribeDurable(ctx, "orders.>", horizon.BrokerConsumer{Durable: "billing", StartSequence: 3}, horizon.Typed(func(_ context.Context, order string) error {
+		replayed = append(replayed, order)
+		return nil
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"third"}, replayed)
+}
@@ -0,0 +1,82 @@
+package horizon_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/lands-horizon/horizon-server/services/horizon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// go test -v ./services/horizon_test/horizon.broker.policy_test.go
+
+func TestHorizonTopicPolicy_Authorize(t *testing.T) {
+	policy := horizon.NewHorizonTopicPolicy(
+		horizon.TopicRule{Pattern: "tenant.{organization}.{branch}.>", Require: horizon.ClaimUser | horizon.ClaimOrganization, Subscribe: true},
+		horizon.TopicRule{Pattern: "user.{user}.>", Require: horizon.ClaimUser, Subscribe: true, Publish: true},
+		horizon.TopicRule{Pattern: "feedback.*.{id}", Require: horizon.ClaimUser, Subscribe: true},
+		horizon.TopicRule{Pattern: "feedback.*", Require: horizon.ClaimUser | horizon.ClaimAdmin, Subscribe: true},
+	)
+	user := horizon.BrokerClaims{UserID: "u1"}
+	admin := horizon.BrokerClaims{UserID: "u3", Admin: true}
+	member := horizon.BrokerClaims{UserID: "u1", OrganizationID: "o1", BranchID: "b1"}
+	owner := horizon.BrokerClaims{UserID: "u2", OrganizationID: "o1"}
+
+	tests := []struct {
+		name    string
+		claims  horizon.BrokerClaims
+		action  horizon.TopicAction
+		topic   string
+		allowed bool
+	}{
+		{"own user topic", user, horizon.TopicSubscribe, "user.u1.notification", true},
+		{"publish to own user topic", user, horizon.TopicPublish, "user.u1.typing", true},
+		{"other user topic", user, horizon.TopicSubscribe, "user.u2.notification", false},
+		{"feedback by id", user, horizon.TopicSubscribe, "feedback.update.42", true},
+		{"publish feedback", user, horizon.TopicPublish, "feedback.update.42", false},
+		{"undeclared topic", member, horizon.TopicSubscribe, "feedback.create", false},
+		{"wildcard broader than the rule", user, horizon.TopicSubscribe, "feedback.>", false},
+		{"wildcard in place of an id", user, horizon.TopicSubscribe, "feedback.create.*", false},
+		{"wildcard in place of a literal wildcard", user, horizon.TopicSubscribe, "feedback.*.42", true},
+		{"collection topic for an admin", admin, horizon.TopicSubscribe, "feedback.create", true},
+		{"tenant topic without organization", user, horizon.TopicSubscribe, "tenant.o1.b1.loan.create", false},
+		{"own branch", member, horizon.TopicSubscribe, "tenant.o1.b1.loan.create", true},
+		{"other branch", member, horizon.TopicSubscribe, "tenant.o1.b2.loan.create", false},
+		{"every branch of the organization", owner, horizon.TopicSubscribe, "tenant.o1.b2.loan.create", true},
+		{"other organization", owner, horizon.TopicSubscribe, "tenant.o2.b1.loan.create", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := policy.Authorize(test.claims, test.action, test.topic)
+			if test.allowed {
+				assert.NoError(t, err)
+			} else {
+				assert.True(t, errors.Is(err, horizon.ErrTopicForbidden), "expected forbidden, got %v", err)
+			}
+		})
+	}
+}
+
+func TestPolicyMessageBroker(t *testing.T) {
+	memory := horizon.NewMemoryMessageBroker(horizon.DeliverSync)
+	broker := horizon.NewPolicyMessageBroker(memory, horizon.NewHorizonTopicPolicy(
+		horizon.TopicRule{Pattern: "user.{user}.>", Require: horizon.ClaimUser, Subscribe: true},
+	))
+	defer broker.Stop(context.Background())
+	client := horizon.WithBrokerClaims(context.Background(), horizon.BrokerClaims{UserID: "u1"})
+
+	_, err := broker.SubscribeMessage(client, "user.u2.notification", func(context.Context, *horizon.BrokerMessage) error { return nil })
+	assert.True(t, errors.Is(err, horizon.ErrTopicForbidden))
+	assert.True(t, errors.Is(broker.Publish(client, "user.u1.notification", "hi"), horizon.ErrTopicForbidden))
+
+	var received []string
+	_, err = horizon.SubscribeTyped(client, broker, "user.u1.notification", func(_ context.Context, message string) error {
+		received = append(received, message)
+		return nil
+	})
+	require.NoError(t, err)
+	require.NoError(t, broker.Publish(context.Background(), "user.u1.notification", "hi"), "calls without claims are trusted")
+	assert.Equal(t, []string{"hi"}, received)
+}
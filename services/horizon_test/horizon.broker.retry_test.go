@@ -0,0 +1,107 @@
+package horizon_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lands-horizon/horizon-server/services/horizon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// go test -v ./services/horizon_test/horizon.broker.retry_test.go
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := horizon.RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}
+	assert.Equal(t, time.Second, policy.Backoff(1))
+	assert.Equal(t, 2*time.Second, policy.Backoff(2))
+	assert.Equal(t, 4*time.Second, policy.Backoff(3))
+	assert.Equal(t, 5*time.Second, policy.Backoff(4))
+
+	consumer := policy.Consumer("mailer")
+	assert.Equal(t, "mailer", consumer.Durable)
+	assert.Equal(t, 5, consumer.MaxDeliver)
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second}, consumer.Backoff)
+
+	assert.Equal(t, 3, horizon.RetryPolicy{}.Attempts())
+	assert.Equal(t, 100*time.Millisecond, horizon.RetryPolicy{}.Backoff(1))
+}
+
+func TestRetry_DeadLetter(t *testing.T) {
+	ctx := context.Background()
+	broker := horizon.NewMemoryMessageBroker(horizon.DeliverSync)
+	require.NoError(t, broker.Run(ctx))
+	defer broker.Stop(ctx)
+
+	var failures []error
+	broker.OnError(func(topic string, err error) {
+		failures = append(failures, err)
+	})
+
+	attempts := 0
+	policy := horizon.RetryPolicy{Name: "mailer", MaxAttempts: 3, InitialBackoff: time.Millisecond, DeadLetter: true}
+	_, err := broker.QueueSubscribe(ctx, "feedback.create", policy.Name, horizon.Retry(broker, policy, horizon.Typed(func(_ context.Context, email string) error {
+		attempts++
+		if email == "flaky@example.com" && attempts < 2 {
+			return errors.New("smtp unavailable")
+		}
+		if email == "broken@example.com" {
+			return errors.New("mailbox rejected")
+		}
+		return nil
+	})))
+	require.NoError(t, err)
+
+	require.NoError(t, broker.Publish(ctx, "feedback.create", "flaky@example.com"))
+	assert.Equal(t, 2, attempts)
+	assert.Empty(t, failures)
+	assert.Empty(t, broker.Messages(horizon.DeadLetterTopic("feedback.create")))
+
+	attempts = 0
+	require.NoError(t, broker.Publish(ctx, "feedback.create", "broken@example.com"))
+	assert.Equal(t, 3, attempts)
+	require.Len(t, failures, 1)
+
+	letters := broker.Messages("deadletter.>")
+	require.Len(t, letters, 1)
+	assert.Equal(t, "deadletter.feedback.create", letters[0].Topic)
+
+	var letter horizon.DeadLetter
+	require.NoError(t, letters[0].Decode(&letter))
+	assert.Equal(t, "feedback.create", letter.Topic)
+	assert.Equal(t, "mailer", letter.Subscription)
+	assert.Equal(t, 3, letter.Attempts)
+	assert.Contains(t, letter.Error, "mailbox rejected")
+	require.NotNil(t, letter.Envelope)
+	assert.JSONEq(t, `"broken@example.com"`, string(letter.Envelope.Data))
+}
+
+func TestRetry_DurableDeadLetter(t *testing.T) {
+	ctx := context.Background()
+	broker := horizon.NewMemoryMessageBroker(horizon.DeliverSync)
+	defer broker.Stop(ctx)
+
+	attempts := 0
+	policy := horizon.RetryPolicy{MaxAttempts: 2, DeadLetter: true}
+	_, err := broker.SubscribeDurable(ctx, "orders.>", policy.Consumer("billing"), horizon.Typed(func(_ context.Context, order string) error {
+		attempts++
+		return errors.New("card declined")
+	}))
+	require.NoError(t, err)
+
+	require.NoError(t, broker.Publish(ctx, "orders.created", "42"))
+	assert.Equal(t, 2, attempts)
+
+	letters := broker.Messages(horizon.DeadLetterTopic("orders.created"))
+	require.Len(t, letters, 1)
+	var letter horizon.DeadLetter
+	require.NoError(t, letters[0].Decode(&letter))
+	assert.Equal(t, "billing", letter.Subscription)
+	assert.Equal(t, 2, letter.Attempts)
+
+	require.NoError(t, broker.Publish(ctx, "orders.created", []int{1}))
+	assert.Len(t, broker.Messages("deadletter.>"), 2, "undecodable messages are dead-lettered without retries")
+	assert.Equal(t, 2, attempts)
+}
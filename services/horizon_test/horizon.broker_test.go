@@ -2,6 +2,7 @@ package horizon
 
 import (
 	"context"
+	"errors"
 	"sync"
 	"testing"
 	"time"
@@ -17,7 +18,7 @@ func TestHorizonMessageBroker_PublishSubscribe(t *testing.T) {
 	port := env.GetInt("NATS_CLIENT_PORT", 4222)
 
 	ctx := context.Background()
-	broker := horizon.NewHorizonMessageBroker(host, port)
+	broker := horizon.NewHorizonMessageBroker(host, port, horizon.BrokerOptions{})
 
 	err := broker.Run(ctx)
 	if err != nil {
@@ -35,7 +36,7 @@ func TestHorizonMessageBroker_PublishSubscribe(t *testing.T) {
 
 	var receivedMsg map[string]interface{}
 
-	err = broker.Subscribe(ctx, topic, func(msg any) error {
+	_, err = broker.Subscribe(ctx, topic, func(msg any) error {
 		defer wg.Done()
 		if data, ok := msg.(map[string]interface{}); ok {
 			receivedMsg = data
@@ -74,3 +75,230 @@ func TestHorizonMessageBroker_PublishSubscribe(t *testing.T) {
 		t.Errorf("expected %v, got %v", expectedMsg["message"], receivedMsg["message"])
 	}
 }
+
+func TestSubjectMatches(t *testing.T) {
+	cases := []struct {
+		pattern string
+		subject string
+		match   bool
+	}{
+		{"feedback.create", "feedback.create", true},
+		{"feedback.create", "feedback.update", false},
+		{"feedback.*", "feedback.create", true},
+		{"feedback.*", "feedback.create.123", false},
+		{"feedback.>", "feedback.create.123", true},
+		{"feedback.>", "feedback", false},
+		{"*.create", "media.create", true},
+		{">", "media.create", true},
+	}
+	for _, c := range cases {
+		if got := horizon.SubjectMatches(c.pattern, c.subject); got != c.match {
+			t.Errorf("SubjectMatches(%q, %q) = %v, want %v", c.pattern, c.subject, got, c.match)
+		}
+	}
+}
+
+func TestHorizonMessageBroker_SubscribeDurable(t *testing.T) {
+	env := horizon.NewEnvironmentService("../../.env")
+	host := env.GetString("NATS_HOST", "localhost")
+	port := env.GetInt("NATS_CLIENT_PORT", 4222)
+
+	ctx := context.Background()
+	broker := horizon.NewHorizonMessageBroker(host, port, horizon.BrokerOptions{}, horizon.BrokerStream{
+		Name:     "TEST_DURABLE",
+		Subjects: []string{"test.durable.>"},
+		MaxAge:   time.Minute,
+	})
+	if err := broker.Run(ctx); err != nil {
+		t.Skipf("JetStream not available: %v", err)
+	}
+	defer broker.Stop(ctx)
+
+	// Published before the consumer exists, received by replaying the stream
+	start := time.Now()
+	if err := broker.Publish(ctx, "test.durable.created", map[string]any{"message": "missed"}); err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+
+	received := make(chan any, 2)
+	attempts := 0
+	_, err := broker.SubscribeDurable(ctx, "test.durable.created", horizon.BrokerConsumer{
+		Backoff:   []time.Duration{100 * time.Millisecond},
+		StartTime: start,
+	}, horizon.Typed(func(_ context.Context, msg any) error {
+		attempts++
+		if attempts == 1 {
+			return errors.New("first delivery fails")
+		}
+		received <- msg
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+
+	select {
+	case msg := <-received:
+		if msg.(map[string]any)["message"] != "missed" {
+			t.Errorf("unexpected message %v", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for redelivered message")
+	}
+	if attempts != 2 {
+		t.Errorf("expected 2 deliveries, got %d", attempts)
+	}
+}
+
+func TestSubscribeTyped_CancelAndErrorHook(t *testing.T) {
+	env := horizon.NewEnvironmentService("../../.env")
+	host := env.GetString("NATS_HOST", "localhost")
+	port := env.GetInt("NATS_CLIENT_PORT", 4222)
+
+	broker := horizon.NewHorizonMessageBroker(host, port, horizon.BrokerOptions{})
+	if err := broker.Run(context.Background()); err != nil {
+		t.Skipf("NATS not available: %v", err)
+	}
+	defer broker.Stop(context.Background())
+
+	type greeting struct {
+		Message string `json:"message"`
+	}
+	failures := make(chan error, 1)
+	broker.OnError(func(topic string, err error) {
+		failures <- err
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan greeting, 2)
+	_, err := horizon.SubscribeTyped(ctx, broker, "test.typed", func(_ context.Context, msg greeting) error {
+		received <- msg
+		if msg.Message == "fail" {
+			return errors.New("handler failed")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+
+	if err := broker.Publish(context.Background(), "test.typed", greeting{Message: "fail"}); err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+	select {
+	case msg := <-received:
+		if msg.Message != "fail" {
+			t.Errorf("expected fail, got %q", msg.Message)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for message")
+	}
+	select {
+	case <-failures:
+	case <-time.After(2 * time.Second):
+		t.Fatal("handler error was not reported")
+	}
+
+	cancel()
+	time.Sleep(100 * time.Millisecond)
+	if err := broker.Publish(context.Background(), "test.typed", greeting{Message: "late"}); err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+	select {
+	case msg := <-received:
+		t.Errorf("received %q after the context was cancelled", msg.Message)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestHorizonMessageBroker_QueueSubscribeAndRequest(t *testing.T) {
+	env := horizon.NewEnvironmentService("../../.env")
+	host := env.GetString("NATS_HOST", "localhost")
+	port := env.GetInt("NATS_CLIENT_PORT", 4222)
+
+	ctx := context.Background()
+	broker := horizon.NewHorizonMessageBroker(host, port, horizon.BrokerOptions{})
+	if err := broker.Run(ctx); err != nil {
+		t.Skipf("NATS not available: %v", err)
+	}
+	defer broker.Stop(ctx)
+
+	// Both workers share the queue group, so every request is answered once
+	var mutex sync.Mutex
+	handled := map[string]int{}
+	for _, worker := range []string{"a", "b"} {
+		_, err := broker.QueueSubscribe(ctx, "test.queue", "workers", func(ctx context.Context, msg *horizon.BrokerMessage) error {
+			mutex.Lock()
+			handled[worker]++
+			mutex.Unlock()
+			var n int
+			if err := msg.Decode(&n); err != nil {
+				return err
+			}
+			return broker.Reply(ctx, msg, n*2)
+		})
+		if err != nil {
+			t.Fatalf("failed to subscribe worker %s: %v", worker, err)
+		}
+	}
+
+	for i := 1; i <= 10; i++ {
+		reply, err := broker.Request(ctx, "test.queue", i, time.Second)
+		if err != nil {
+			t.Fatalf("request %d failed: %v", i, err)
+		}
+		var doubled int
+		if err := reply.Decode(&doubled); err != nil {
+			t.Fatalf("failed to decode reply: %v", err)
+		}
+		if doubled != i*2 {
+			t.Errorf("expected %d, got %d", i*2, doubled)
+		}
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if handled["a"]+handled["b"] != 10 {
+		t.Errorf("expected 10 deliveries across the group, got %v", handled)
+	}
+
+	if _, err := broker.Request(ctx, "test.queue.nobody", 1, time.Second); !errors.Is(err, horizon.ErrNoResponders) {
+		t.Errorf("expected ErrNoResponders, got %v", err)
+	}
+}
+
+func TestHorizonMessageBroker_Status(t *testing.T) {
+	env := horizon.NewEnvironmentService("../../.env")
+	host := env.GetString("NATS_HOST", "localhost")
+	port := env.GetInt("NATS_CLIENT_PORT", 4222)
+
+	ctx := context.Background()
+	broker := horizon.NewHorizonMessageBroker(host, port, horizon.BrokerOptions{
+		Name:          "horizon-test",
+		MaxReconnects: -1,
+		ReconnectWait: 100 * time.Millisecond,
+	})
+	if err := broker.Ping(ctx); err == nil {
+		t.Error("expected ping to fail before Run")
+	}
+	if err := broker.Run(ctx); err != nil {
+		t.Fatalf("failed to run broker: %v", err)
+	}
+
+	if err := broker.Ping(ctx); err != nil {
+		t.Errorf("ping failed: %v", err)
+	}
+	status := broker.Status()
+	if status.State != horizon.BrokerConnected || status.Server == "" {
+		t.Errorf("expected a connected status, got %+v", status)
+	}
+
+	if err := broker.Stop(ctx); err != nil {
+		t.Fatalf("failed to stop broker: %v", err)
+	}
+	if err := broker.Ping(ctx); err == nil {
+		t.Error("expected ping to fail after Stop")
+	}
+	if status := broker.Status(); status.State != horizon.BrokerDisconnected {
+		t.Errorf("expected a disconnected status after Stop, got %+v", status)
+	}
+}
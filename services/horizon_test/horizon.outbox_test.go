@@ -0,0 +1,72 @@
+package horizon_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lands-horizon/horizon-server/services/horizon"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// go test -v ./services/horizon_test/horizon.outbox_test.go
+
+func TestHorizonOutbox_EnqueueAndRelay(t *testing.T) {
+	env := horizon.NewEnvironmentService("../../.env")
+	dsn := env.GetString("DATABASE_URL", "")
+	if dsn == "" {
+		t.Skip("DATABASE_URL environment variable not set")
+	}
+	ctx := context.Background()
+
+	db := horizon.NewGormDatabase(dsn, 5, 10, time.Minute)
+	require.NoError(t, db.Run(ctx))
+	defer db.Stop(ctx)
+
+	broker := horizon.NewHorizonMessageBroker(
+		env.GetString("NATS_HOST", "localhost"),
+		env.GetInt("NATS_CLIENT_PORT", 4222),
+		horizon.BrokerOptions{},
+	)
+	require.NoError(t, broker.Run(ctx))
+	defer broker.Stop(ctx)
+
+	outbox := horizon.NewHorizonOutbox(db, broker, time.Hour, 100, 3, 0)
+	require.NoError(t, outbox.Run(ctx))
+	defer outbox.Stop(ctx)
+
+	received := make(chan any, 1)
+	sub, err := broker.Subscribe(ctx, "test.outbox", func(msg any) error {
+		received <- msg
+		return nil
+	})
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+	time.Sleep(500 * time.Millisecond)
+
+	// Rolled back messages are never relayed
+	err = db.Client().Transaction(func(tx *gorm.DB) error {
+		require.NoError(t, outbox.Enqueue(ctx, tx, []string{"test.outbox"}, map[string]string{"message": "phantom"}))
+		return gorm.ErrInvalidTransaction
+	})
+	require.Error(t, err)
+
+	err = db.Client().Transaction(func(tx *gorm.DB) error {
+		return outbox.Enqueue(ctx, tx, []string{"test.outbox"}, map[string]string{"message": "hello"})
+	})
+	require.NoError(t, err)
+	require.NoError(t, outbox.Relay(ctx))
+
+	select {
+	case msg := <-received:
+		require.Equal(t, "hello", msg.(map[string]any)["message"])
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for relayed message")
+	}
+	select {
+	case msg := <-received:
+		t.Fatalf("unexpected message relayed: %v", msg)
+	case <-time.After(500 * time.Millisecond):
+	}
+}
@@ -1,15 +1,19 @@
 package horizon_test
 
 import (
+	"compress/gzip"
 	"context"
+	"errors"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
 	"time"
 
 	"fmt"
 
+	"github.com/labstack/echo/v4"
 	"github.com/lands-horizon/horizon-server/services/horizon"
 	"github.com/stretchr/testify/assert"
 )
@@ -27,11 +31,12 @@ func TestMain(m *testing.M) {
 	metricsPort := env.GetInt("APP_METRICS_PORT", 8001)
 	clientUrl := env.GetString("APP_CLIENT_URL", "http://localhost:3000")
 	clientName := env.GetString("APP_CLIENT_NAME", "test-client")
+	requestTimeout := env.GetDuration("APP_REQUEST_TIMEOUT", 30*time.Second)
 	baseURL := "http://localhost:" + fmt.Sprint(apiPort)
 
 	testCtx, testCancel = context.WithCancel(context.Background())
 
-	service := horizon.NewHorizonAPIService(apiPort, metricsPort, clientUrl, clientName)
+	service := horizon.NewHorizonAPIService(apiPort, metricsPort, clientUrl, clientName, requestTimeout)
 
 	go func() {
 		if err := service.Run(testCtx); err != nil {
@@ -84,6 +89,61 @@ func TestNewHorizonAPIService_HealthCheck(t *testing.T) {
 	assert.Equal(t, "OK", string(body))
 }
 
+func TestHorizonAPIService_HealthChecks(t *testing.T) {
+	service := horizon.NewHorizonAPIService(0, 0, "http://localhost:3000", "health_checks", time.Second)
+	broker := horizon.NewMemoryMessageBroker(horizon.DeliverSync)
+	service.HealthCheck("broker", broker.Ping)
+
+	health := func() (int, string) {
+		rec := httptest.NewRecorder()
+		service.Client().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+		return rec.Code, rec.Body.String()
+	}
+	code, body := health()
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "OK", body)
+
+	service.HealthCheck("database", func(ctx context.Context) error {
+		return errors.New("connection refused")
+	})
+	code, body = health()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "database: connection refused", body)
+	assert.Equal(t, horizon.BrokerConnected, broker.Status().State)
+}
+
+func TestHorizonAPIService_StreamRoutes(t *testing.T) {
+	service := horizon.NewHorizonAPIService(0, 0, "http://localhost:3000", "stream_routes", time.Second)
+	deadline := func(c echo.Context) error {
+		_, ok := c.Request().Context().Deadline()
+		return c.String(http.StatusOK, fmt.Sprint(ok))
+	}
+	service.RegisterRoute(horizon.Route{Route: "/plain", Method: "GET"}, deadline)
+	service.RegisterRoute(horizon.Route{Route: "/stream", Method: "GET", Stream: true}, deadline)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, path, nil)
+		request.Header.Set(echo.HeaderAccept, "text/event-stream")
+		request.Header.Set(echo.HeaderAcceptEncoding, "gzip")
+		rec := httptest.NewRecorder()
+		service.Client().ServeHTTP(rec, request)
+		return rec
+	}
+
+	// Asking for an event stream does not lift the timeout or compression of a route
+	rec := get("/plain")
+	assert.Equal(t, "gzip", rec.Header().Get(echo.HeaderContentEncoding))
+	reader, err := gzip.NewReader(rec.Body)
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(reader)
+	assert.Equal(t, "true", string(body))
+
+	// Routes registered as streams are exempt from both
+	rec = get("/stream")
+	assert.Empty(t, rec.Header().Get(echo.HeaderContentEncoding))
+	assert.Equal(t, "false", rec.Body.String())
+}
+
 func TestNewHorizonAPIService_SuspiciousPath(t *testing.T) {
 	env := horizon.NewEnvironmentService("../../.env")
 
@@ -0,0 +1,105 @@
+package horizon_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"testing"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	horizon_services "github.com/lands-horizon/horizon-server/services"
+	"github.com/lands-horizon/horizon-server/services/horizon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// go test -v ./services/horizon_test/repository.export_test.go
+
+type sheetNote struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Title     string
+	Amount    int64
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type sheetNoteResponse struct {
+	Title  string `json:"title"`
+	Amount int64  `json:"amount"`
+}
+
+type sheetNoteRequest struct {
+	Title  string `json:"title" validate:"required"`
+	Amount int64  `json:"amount"`
+}
+
+func TestRepositoryExport_FormulaCells(t *testing.T) {
+	env := horizon.NewEnvironmentService("../../.env")
+	dsn := env.GetString("DATABASE_URL", "")
+	if dsn == "" {
+		t.Skip("DATABASE_URL environment variable not set")
+	}
+	ctx := context.Background()
+
+	db := horizon.NewGormDatabase(dsn, 5, 10, time.Minute)
+	require.NoError(t, db.Run(ctx))
+	defer db.Stop(ctx)
+	client := db.Client()
+	require.NoError(t, client.Migrator().DropTable(&sheetNote{}))
+	require.NoError(t, client.AutoMigrate(&sheetNote{}))
+	defer client.Migrator().DropTable(&sheetNote{})
+
+	repository := horizon_services.NewRepository(horizon_services.RepositoryParams[sheetNote, sheetNoteResponse, sheetNoteRequest]{
+		Service: &horizon_services.HorizonService{Database: db, Validator: validator.New()},
+		Resource: func(note *sheetNote) *sheetNoteResponse {
+			return &sheetNoteResponse{Title: note.Title, Amount: note.Amount}
+		},
+		Entity: func(req *sheetNoteRequest) (*sheetNote, error) {
+			return &sheetNote{ID: uuid.New(), Title: req.Title, Amount: req.Amount}, nil
+		},
+	})
+
+	titles := []string{"=HYPERLINK(\"http://evil\")", "+1", "-2", "@SUM(A1)", "\tx", "'quoted", "plain"}
+	notes := make([]*sheetNote, len(titles))
+	for i, title := range titles {
+		notes[i] = &sheetNote{ID: uuid.New(), Title: title, Amount: -3}
+	}
+	require.NoError(t, repository.CreateMany(ctx, notes))
+
+	// Cells a spreadsheet would run as formulas are exported as text
+	var exported bytes.Buffer
+	require.NoError(t, repository.Export(ctx, &exported, horizon_services.ExportCSV, nil))
+	rows, err := csv.NewReader(bytes.NewReader(exported.Bytes())).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, len(titles)+1)
+	cells := map[string]bool{}
+	for _, row := range rows[1:] {
+		cells[row[0]] = true
+		assert.Equal(t, "-3", row[1], "numbers are left as they are")
+	}
+	for _, cell := range []string{"'=HYPERLINK(\"http://evil\")", "'+1", "'-2", "'@SUM(A1)", "'\tx", "'quoted", "plain"} {
+		assert.True(t, cells[cell], "exported %q", cell)
+	}
+
+	// and importing them restores the original text, in either format
+	for _, format := range []horizon_services.ExportFormat{horizon_services.ExportCSV, horizon_services.ExportXLSX} {
+		var buffer bytes.Buffer
+		require.NoError(t, repository.Export(ctx, &buffer, format, nil))
+		require.NoError(t, client.Where("1 = 1").Delete(&sheetNote{}).Error)
+		result, err := repository.Import(ctx, &buffer, format)
+		require.NoError(t, err, format)
+		assert.Empty(t, result.Errors, format)
+		assert.Equal(t, len(titles), result.Created, format)
+
+		imported, err := repository.List(ctx)
+		require.NoError(t, err)
+		var got []string
+		for _, note := range imported {
+			got = append(got, note.Title)
+			assert.EqualValues(t, -3, note.Amount, format)
+		}
+		assert.ElementsMatch(t, titles, got, format)
+	}
+}
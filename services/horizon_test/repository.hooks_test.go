@@ -0,0 +1,104 @@
+package horizon_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	horizon_services "github.com/lands-horizon/horizon-server/services"
+	"github.com/lands-horizon/horizon-server/services/horizon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// go test -v ./services/horizon_test/repository.hooks_test.go
+
+type hookNote struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Title     string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type hookNoteLog struct {
+	ID     uint `gorm:"primaryKey"`
+	NoteID uuid.UUID
+}
+
+func TestRepositoryHooks_Transaction(t *testing.T) {
+	env := horizon.NewEnvironmentService("../../.env")
+	dsn := env.GetString("DATABASE_URL", "")
+	if dsn == "" {
+		t.Skip("DATABASE_URL environment variable not set")
+	}
+	ctx := context.Background()
+
+	db := horizon.NewGormDatabase(dsn, 5, 10, time.Minute)
+	require.NoError(t, db.Run(ctx))
+	defer db.Stop(ctx)
+	client := db.Client()
+	require.NoError(t, client.Migrator().DropTable(&hookNote{}, &hookNoteLog{}))
+	require.NoError(t, client.AutoMigrate(&hookNote{}, &hookNoteLog{}))
+	defer client.Migrator().DropTable(&hookNote{}, &hookNoteLog{})
+
+	vetoed := errors.New("vetoed")
+	repository := horizon_services.NewRepository(horizon_services.RepositoryParams[hookNote, hookNote, hookNote]{
+		Service: &horizon_services.HorizonService{Database: db},
+		Hooks: horizon_services.Hooks[hookNote]{
+			BeforeCreate: func(ctx context.Context, tx *gorm.DB, note *hookNote) error {
+				if note.Title == "veto" {
+					return vetoed
+				}
+				return nil
+			},
+			AfterCreate: func(ctx context.Context, tx *gorm.DB, note *hookNote) error {
+				// The row is visible to the transaction of the hook only
+				if err := tx.First(&hookNote{}, "id = ?", note.ID).Error; err != nil {
+					return err
+				}
+				if err := client.First(&hookNote{}, "id = ?", note.ID).Error; !errors.Is(err, gorm.ErrRecordNotFound) {
+					return errors.New("after hook ran outside the transaction")
+				}
+				if err := tx.Create(&hookNoteLog{NoteID: note.ID}).Error; err != nil {
+					return err
+				}
+				if note.Title == "fail after" {
+					return vetoed
+				}
+				return nil
+			},
+		},
+	})
+	count := func(model any) int64 {
+		var total int64
+		require.NoError(t, client.Model(model).Count(&total).Error)
+		return total
+	}
+
+	// A before hook veto writes nothing
+	err := repository.Create(ctx, &hookNote{ID: uuid.New(), Title: "veto"})
+	assert.ErrorIs(t, err, vetoed)
+	assert.Zero(t, count(&hookNote{}))
+
+	// nor does it in the middle of a batch
+	err = repository.CreateMany(ctx, []*hookNote{{ID: uuid.New(), Title: "first"}, {ID: uuid.New(), Title: "veto"}})
+	assert.ErrorIs(t, err, vetoed)
+	assert.Zero(t, count(&hookNote{}))
+
+	// An after hook failing rolls back the row and what the hook wrote
+	err = repository.Create(ctx, &hookNote{ID: uuid.New(), Title: "fail after"})
+	assert.ErrorIs(t, err, vetoed)
+	assert.Zero(t, count(&hookNote{}))
+	assert.Zero(t, count(&hookNoteLog{}))
+
+	note := &hookNote{ID: uuid.New(), Title: "kept"}
+	require.NoError(t, repository.Create(ctx, note))
+	assert.EqualValues(t, 1, count(&hookNote{}))
+	var logs []hookNoteLog
+	require.NoError(t, client.Find(&logs).Error)
+	require.Len(t, logs, 1)
+	assert.Equal(t, note.ID, logs[0].NoteID)
+}
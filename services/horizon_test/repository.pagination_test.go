@@ -0,0 +1,163 @@
+package horizon_test
+
+import (
+	"context"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	horizon_services "github.com/lands-horizon/horizon-server/services"
+	"github.com/lands-horizon/horizon-server/services/horizon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// go test -v ./services/horizon_test/repository.pagination_test.go
+
+type pageNote struct {
+	ID         uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Email      string
+	Kind       string
+	ArchivedAt *time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+func TestParsePageQuery(t *testing.T) {
+	sortable := []string{"created_at", "email"}
+	filterable := []string{"email", "feedback_type"}
+
+	query, err := horizon_services.ParsePageQuery(url.Values{
+		"page":              {"2"},
+		"size":              {"10"},
+		"sort":              {"-created_at, email"},
+		"feedback_type[in]": {"bug,feature"},
+		"email[like]":       {"gmail"},
+		"email":             {"a@example.com"},
+		"unrelated":         {"ignored"},
+		"fields":            {"id,email"},
+		"include":           {"media"},
+	}, sortable, filterable)
+	require.NoError(t, err)
+	assert.Equal(t, 2, query.Page)
+	assert.Equal(t, 10, query.Size)
+	assert.Equal(t, []horizon_services.Sort{
+		{Field: "created_at", Direction: horizon_services.SortDescending},
+		{Field: "email", Direction: horizon_services.SortAscending},
+	}, query.Sort)
+	assert.Equal(t, []horizon_services.Filter{
+		{Field: "email", Operator: horizon_services.FilterEqual, Value: "a@example.com"},
+		{Field: "email", Operator: horizon_services.FilterLike, Value: "gmail"},
+		{Field: "feedback_type", Operator: horizon_services.FilterIn, Value: "bug,feature"},
+	}, query.Filters)
+	assert.Equal(t, horizon_services.Fields{"id", "email"}, query.Fields)
+	assert.Equal(t, []string{"media"}, query.Include)
+
+	defaults, err := horizon_services.ParsePageQuery(url.Values{}, sortable, filterable)
+	require.NoError(t, err)
+	assert.Equal(t, 1, defaults.Page)
+	assert.Equal(t, horizon_services.DefaultPageSize, defaults.Size)
+
+	for name, values := range map[string]url.Values{
+		"page below 1":        {"page": {"0"}},
+		"size above max":      {"size": {"101"}},
+		"size not a number":   {"size": {"ten"}},
+		"unsortable column":   {"sort": {"password"}},
+		"unfilterable column": {"password[eq]": {"x"}},
+		"unknown operator":    {"email[regex]": {".*"}},
+	} {
+		_, err := horizon_services.ParsePageQuery(values, sortable, filterable)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestRepositoryPagination_FiltersAndCursors(t *testing.T) {
+	env := horizon.NewEnvironmentService("../../.env")
+	dsn := env.GetString("DATABASE_URL", "")
+	if dsn == "" {
+		t.Skip("DATABASE_URL environment variable not set")
+	}
+	ctx := context.Background()
+
+	db := horizon.NewGormDatabase(dsn, 5, 10, time.Minute)
+	require.NoError(t, db.Run(ctx))
+	defer db.Stop(ctx)
+	client := db.Client()
+	require.NoError(t, client.Migrator().DropTable(&pageNote{}))
+	require.NoError(t, client.AutoMigrate(&pageNote{}))
+	defer client.Migrator().DropTable(&pageNote{})
+
+	sortable := []string{"id", "email", "archived_at"}
+	filterable := []string{"email", "kind", "archived_at"}
+	repository := horizon_services.NewRepository(horizon_services.RepositoryParams[pageNote, pageNote, pageNote]{
+		Service:    &horizon_services.HorizonService{Database: db},
+		Sortable:   sortable,
+		Filterable: filterable,
+	})
+
+	archived := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	later := archived.Add(time.Hour)
+	require.NoError(t, repository.CreateMany(ctx, []*pageNote{
+		{ID: uuid.New(), Email: "a@example.com", Kind: "bug", ArchivedAt: &archived},
+		{ID: uuid.New(), Email: "50%_off@example.com", Kind: "feature", ArchivedAt: &archived},
+		{ID: uuid.New(), Email: "50xoff@example.com", Kind: "general", ArchivedAt: &later},
+		{ID: uuid.New(), Email: "b@example.com", Kind: "bug"},
+		{ID: uuid.New(), Email: "c@example.com", Kind: "general"},
+	}))
+
+	page := func(values url.Values) *horizon_services.PageResult[pageNote] {
+		t.Helper()
+		query, err := horizon_services.ParsePageQuery(values, sortable, filterable)
+		require.NoError(t, err)
+		result, err := repository.Paginate(ctx, query)
+		require.NoError(t, err)
+		return result
+	}
+	emails := func(result *horizon_services.PageResult[pageNote]) []string {
+		var out []string
+		for _, item := range result.Items {
+			out = append(out, item.Email)
+		}
+		return out
+	}
+
+	// Filters
+	assert.ElementsMatch(t, []string{"a@example.com"}, emails(page(url.Values{"email": {"a@example.com"}})))
+	assert.ElementsMatch(t, []string{"a@example.com", "b@example.com", "50%_off@example.com"},
+		emails(page(url.Values{"kind[in]": {"bug, feature"}})))
+	assert.ElementsMatch(t, []string{"50%_off@example.com"}, emails(page(url.Values{"email[like]": {"50%_off"}})),
+		"like matches % and _ literally")
+	assert.ElementsMatch(t, []string{"b@example.com", "c@example.com"}, emails(page(url.Values{"archived_at[null]": {"true"}})))
+	assert.Len(t, page(url.Values{"archived_at[null]": {"false"}}).Items, 3)
+
+	// Cursors walk a nullable sort column in both directions without gaps or repeats
+	for _, sort := range []string{"archived_at", "-archived_at"} {
+		want := emails(page(url.Values{"sort": {sort}}))
+		require.Len(t, want, 5)
+		var got []string
+		values := url.Values{"sort": {sort}, "size": {"2"}}
+		for range 5 {
+			result := page(values)
+			got = append(got, emails(result)...)
+			if result.NextCursor == "" {
+				break
+			}
+			values.Set("cursor", result.NextCursor)
+		}
+		assert.Equal(t, want, got, sort)
+	}
+
+	// A sort on id is honored, also as the primary sort
+	result := page(url.Values{"sort": {"-id"}})
+	ids := make([]string, 0, len(result.Items))
+	for _, item := range result.Items {
+		ids = append(ids, item.ID.String())
+	}
+	require.Len(t, ids, 5)
+	assert.True(t, slices.IsSortedFunc(ids, func(a, b string) int {
+		return strings.Compare(b, a)
+	}), "ids descending: %v", ids)
+}
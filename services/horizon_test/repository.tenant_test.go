@@ -0,0 +1,124 @@
+package horizon_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	horizon_services "github.com/lands-horizon/horizon-server/services"
+	"github.com/lands-horizon/horizon-server/services/horizon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// go test -v ./services/horizon_test/repository.tenant_test.go
+
+type tenantNote struct {
+	ID             uuid.UUID `gorm:"type:uuid;primaryKey"`
+	OrganizationID uuid.UUID `gorm:"type:uuid"`
+	BranchID       uuid.UUID `gorm:"type:uuid"`
+	Title          string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	DeletedAt      gorm.DeletedAt
+}
+
+type tenantNoteLog struct {
+	ID     uint `gorm:"primaryKey"`
+	NoteID uuid.UUID
+}
+
+func TestRepositoryTenant_Scoping(t *testing.T) {
+	env := horizon.NewEnvironmentService("../../.env")
+	dsn := env.GetString("DATABASE_URL", "")
+	if dsn == "" {
+		t.Skip("DATABASE_URL environment variable not set")
+	}
+
+	db := horizon.NewGormDatabase(dsn, 5, 10, time.Minute)
+	require.NoError(t, db.Run(context.Background()))
+	defer db.Stop(context.Background())
+	client := db.Client()
+	require.NoError(t, client.Migrator().DropTable(&tenantNote{}, &tenantNoteLog{}))
+	require.NoError(t, client.AutoMigrate(&tenantNote{}, &tenantNoteLog{}))
+	defer client.Migrator().DropTable(&tenantNote{}, &tenantNoteLog{})
+
+	repository := horizon_services.NewRepository(horizon_services.RepositoryParams[tenantNote, tenantNote, tenantNote]{
+		Service: &horizon_services.HorizonService{Database: db},
+		Hooks: horizon_services.Hooks[tenantNote]{
+			AfterCreate: func(ctx context.Context, tx *gorm.DB, note *tenantNote) error {
+				// The tenant predicate of notes must not reach the logs, which have no tenant columns
+				var logs []tenantNoteLog
+				if err := tx.Where("note_id = ?", note.ID).Find(&logs).Error; err != nil {
+					return err
+				}
+				return tx.Create(&tenantNoteLog{NoteID: note.ID}).Error
+			},
+		},
+	})
+
+	acme := horizon_services.Tenant{OrganizationID: uuid.New(), BranchID: uuid.New()}
+	globex := horizon_services.Tenant{OrganizationID: uuid.New(), BranchID: uuid.New()}
+	acmeCtx := horizon_services.WithTenant(context.Background(), acme)
+	globexCtx := horizon_services.WithTenant(context.Background(), globex)
+
+	// Without a tenant nothing is read or written
+	_, err := repository.List(context.Background())
+	assert.ErrorIs(t, err, horizon_services.ErrTenantRequired)
+	err = repository.Create(context.Background(), &tenantNote{ID: uuid.New(), Title: "orphan"})
+	assert.ErrorIs(t, err, horizon_services.ErrTenantRequired)
+
+	// Created rows are stamped with the tenant of the context, whatever they claim
+	mine := &tenantNote{ID: uuid.New(), OrganizationID: globex.OrganizationID, Title: "acme"}
+	require.NoError(t, repository.Create(acmeCtx, mine))
+	assert.Equal(t, acme.OrganizationID, mine.OrganizationID)
+	assert.Equal(t, acme.BranchID, mine.BranchID)
+	theirs := &tenantNote{ID: uuid.New(), Title: "globex"}
+	require.NoError(t, repository.Create(globexCtx, theirs))
+	var logs int64
+	require.NoError(t, client.Model(&tenantNoteLog{}).Count(&logs).Error)
+	assert.EqualValues(t, 2, logs)
+
+	// Reads see the rows of their tenant only
+	notes, err := repository.List(acmeCtx)
+	require.NoError(t, err)
+	require.Len(t, notes, 1)
+	assert.Equal(t, mine.ID, notes[0].ID)
+	_, err = repository.GetByID(acmeCtx, theirs.ID)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	page, err := repository.Paginate(acmeCtx, &horizon_services.PageQuery{})
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, page.Total)
+
+	// A branch-less tenant sees every branch of its organization
+	organizationCtx := horizon_services.WithTenant(context.Background(), horizon_services.Tenant{OrganizationID: acme.OrganizationID})
+	notes, err = repository.List(organizationCtx)
+	require.NoError(t, err)
+	assert.Len(t, notes, 1)
+
+	// Writes cannot reach the rows of another tenant
+	err = repository.Update(acmeCtx, &tenantNote{ID: theirs.ID, Title: "hijacked"})
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	err = repository.DeleteByID(acmeCtx, theirs.ID)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	err = repository.Upsert(acmeCtx, &tenantNote{ID: theirs.ID, Title: "hijacked"})
+	assert.Error(t, err, "upsert must not insert over a row of another tenant")
+	stored, err := repository.GetByID(globexCtx, theirs.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "globex", stored.Title)
+	assert.Equal(t, globex.OrganizationID, stored.OrganizationID)
+
+	// Upserts within the tenant update and create as usual
+	require.NoError(t, repository.Upsert(acmeCtx, &tenantNote{ID: mine.ID, Title: "acme renamed"}))
+	require.NoError(t, repository.Upsert(acmeCtx, &tenantNote{ID: uuid.New(), Title: "acme second"}))
+	notes, err = repository.List(acmeCtx)
+	require.NoError(t, err)
+	assert.Len(t, notes, 2)
+
+	// System contexts see every tenant
+	notes, err = repository.List(horizon_services.WithoutTenant(context.Background()))
+	require.NoError(t, err)
+	assert.Len(t, notes, 3)
+}
@@ -2,6 +2,8 @@ package horizon_services
 
 import (
 	"time"
+
+	"github.com/lands-horizon/horizon-server/services/horizon"
 )
 
 type EnvironmentServiceConfig struct {
@@ -33,6 +35,48 @@ type CacheServiceConfig struct {
 type BrokerServiceConfig struct {
 	Host string `env:"NATS_HOST"`
 	Port int    `env:"NATS_CLIENT_PORT"`
+	Name string `env:"APP_NAME"`
+
+	// The first of CredentialsFile, NKeySeedFile, Token and Username with
+	// Password that is set authenticates the connection
+	Token           string `env:"NATS_TOKEN"`
+	Username        string `env:"NATS_USERNAME"`
+	Password        string `env:"NATS_PASSWORD"`
+	NKeySeedFile    string `env:"NATS_NKEY_SEED_FILE"`
+	CredentialsFile string `env:"NATS_CREDENTIALS_FILE"`
+
+	// TLS requires TLS, which a CA or client certificate also imply
+	TLS         bool   `env:"NATS_TLS"`
+	TLSCAFile   string `env:"NATS_TLS_CA_FILE"`
+	TLSCertFile string `env:"NATS_TLS_CERT_FILE"`
+	TLSKeyFile  string `env:"NATS_TLS_KEY_FILE"`
+
+	// MaxReconnects is unlimited when negative; publishes made while reconnecting
+	// are buffered up to ReconnectBufferSize bytes and delays back off from
+	// ReconnectWait to MaxReconnectWait
+	MaxReconnects       int           `env:"NATS_MAX_RECONNECTS"`
+	ReconnectWait       time.Duration `env:"NATS_RECONNECT_WAIT"`
+	MaxReconnectWait    time.Duration `env:"NATS_MAX_RECONNECT_WAIT"`
+	ReconnectBufferSize int           `env:"NATS_RECONNECT_BUFFER_SIZE"`
+
+	// ConnectTimeout bounds the dial of each server and PingInterval is how often
+	// the server is pinged to detect a stale connection
+	ConnectTimeout time.Duration `env:"NATS_CONNECT_TIMEOUT"`
+	PingInterval   time.Duration `env:"NATS_PING_INTERVAL"`
+
+	// Streams switches the broker to JetStream; from the environment each subject
+	// of NATS_STREAMS (e.g. "feedback.>,media.>") becomes a stream kept for NATS_STREAM_MAX_AGE
+	Streams []horizon.BrokerStream
+
+	// Memory replaces NATS with the in-process broker, for single node runs
+	Memory bool `env:"BROKER_MEMORY"`
+}
+
+type OutboxServiceConfig struct {
+	Interval    time.Duration `env:"OUTBOX_INTERVAL"`
+	BatchSize   int           `env:"OUTBOX_BATCH_SIZE"`
+	MaxAttempts int           `env:"OUTBOX_MAX_ATTEMPTS"`
+	Retention   time.Duration `env:"OUTBOX_RETENTION"`
 }
 
 type SecurityServiceConfig struct {
@@ -67,4 +111,6 @@ type RequestServiceConfig struct {
 	MetricsPort int    `env:"APP_METRICS_PORT"`
 	ClientURL   string `env:"APP_CLIENT_URL"`
 	ClientName  string `env:"APP_CLIENT_NAME"`
+
+	RequestTimeout time.Duration `env:"APP_REQUEST_TIMEOUT"`
 }
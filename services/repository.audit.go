@@ -0,0 +1,267 @@
+package horizon_services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/lands-horizon/horizon-server/services/horizon"
+	"github.com/rotisserie/eris"
+	"gorm.io/gorm"
+)
+
+type AuditAction string
+
+const (
+	AuditCreate  AuditAction = "create"
+	AuditUpdate  AuditAction = "update"
+	AuditDelete  AuditAction = "delete"
+	AuditRestore AuditAction = "restore"
+	AuditPurge   AuditAction = "purge"
+)
+
+// AuditRedacted stands in audit logs for the values of RepositoryParams.AuditRedact columns
+const AuditRedacted = "[redacted]"
+
+// AuditChange is the before and after value of a single column
+type AuditChange struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+// AuditLog is one recorded change of a Repository managed entity
+type AuditLog struct {
+	ID uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+
+	CreatedAt time.Time `gorm:"not null;default:now()" json:"created_at"`
+
+	Collection string          `gorm:"type:varchar(255);not null;index:idx_audit_entity,priority:1" json:"collection"`
+	EntityID   uuid.UUID       `gorm:"type:uuid;not null;index:idx_audit_entity,priority:2" json:"entity_id"`
+	Action     AuditAction     `gorm:"type:varchar(20);not null" json:"action"`
+	Actor      string          `gorm:"type:varchar(255)" json:"actor"`
+	Changes    json.RawMessage `gorm:"type:jsonb" json:"changes"`
+}
+
+func (AuditLog) TableName() string {
+	return "horizon_audit"
+}
+
+type actorContextKey struct{}
+
+// WithActor returns a context that attributes repository changes to actor
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorContextKey{}, actor)
+}
+
+// ActorFromContext returns the actor stored by WithActor, or "system"
+func ActorFromContext(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorContextKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	return "system"
+}
+
+// History implements Repository. The history of a purged entity stays readable,
+// ending with its AuditPurge log, as long as that log belongs to the tenant of ctx.
+func (c *CollectionManager[TData, TResponse, TRequest]) History(ctx context.Context, id uuid.UUID) ([]*AuditLog, error) {
+	s, err := c.schema(c.service.Database.Client())
+	if err != nil {
+		return nil, err
+	}
+	db, err := c.session(ctx, c.client(ctx))
+	if err != nil {
+		return nil, err
+	}
+	err = db.Unscoped().Select("id").First(new(TData), "id = ?", id).Error
+	if err != nil && !eris.Is(err, gorm.ErrRecordNotFound) {
+		return nil, eris.Wrapf(err, "failed to find entity with id: %s", id)
+	}
+	purged := err != nil
+	if purged {
+		// A row outside the tenant scope is not purged, only hidden
+		var stored int64
+		if err := c.client(ctx).WithContext(ctx).Unscoped().Model(new(TData)).Where("id = ?", id).Count(&stored).Error; err != nil {
+			return nil, eris.Wrapf(err, "failed to find entity with id: %s", id)
+		}
+		if stored > 0 {
+			return nil, eris.Wrapf(gorm.ErrRecordNotFound, "failed to find entity with id: %s", id)
+		}
+	}
+	var logs []*AuditLog
+	if err := c.client(ctx).WithContext(ctx).
+		Where("collection = ? AND entity_id = ?", s.Table, id).
+		Order("created_at DESC").
+		Find(&logs).Error; err != nil {
+		return nil, eris.Wrapf(err, "failed to load history of entity with id: %s", id)
+	}
+	if purged && (len(logs) == 0 || !auditTenantAllows[TData](ctx, logs[0])) {
+		return nil, eris.Wrapf(gorm.ErrRecordNotFound, "failed to find entity with id: %s", id)
+	}
+	return logs, nil
+}
+
+// RegisterHistoryRoute implements Repository.
+func (c *CollectionManager[TData, TResponse, TRequest]) RegisterHistoryRoute(route string, idParam string, m ...echo.MiddlewareFunc) {
+	c.service.Request.RegisterRoute(horizon.Route{
+		Route:    route,
+		Method:   "GET",
+		Response: "TAuditLog[]",
+		Note:     "change history, newest first",
+	}, func(ctx echo.Context) error {
+		id, err := crudID(ctx, idParam)
+		if err != nil {
+			return err
+		}
+		logs, err := c.History(ctx.Request().Context(), id)
+		if err != nil {
+			return crudError(ctx, err)
+		}
+		return ctx.JSON(http.StatusOK, logs)
+	}, m...)
+}
+
+// auditSnapshot loads the stored row so that updates and deletes can be diffed.
+// It returns nil when auditing is disabled.
+func (c *CollectionManager[TData, TResponse, TRequest]) auditSnapshot(tx *gorm.DB, id uuid.UUID) (*TData, error) {
+	if !c.auditing {
+		return nil, nil
+	}
+	before := new(TData)
+	if err := tx.First(before, "id = ?", id).Error; err != nil {
+		return nil, eris.Wrapf(err, "failed to load entity with id %s for audit", id)
+	}
+	return before, nil
+}
+
+// audit records the column level difference between before and after. Either may be nil.
+func (c *CollectionManager[TData, TResponse, TRequest]) audit(ctx context.Context, tx *gorm.DB, action AuditAction, before *TData, after *TData) error {
+	return c.auditMany(ctx, tx, action, []*TData{before}, []*TData{after})
+}
+
+// auditMany records one audit log per entity in a single insert. befores and afters
+// are matched by index; either slice may be nil.
+func (c *CollectionManager[TData, TResponse, TRequest]) auditMany(ctx context.Context, tx *gorm.DB, action AuditAction, befores []*TData, afters []*TData) error {
+	if !c.auditing {
+		return nil
+	}
+	s, err := c.schema(tx)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	actor := ActorFromContext(ctx)
+	logs := make([]*AuditLog, 0, max(len(befores), len(afters)))
+	for i := range max(len(befores), len(afters)) {
+		var before, after *TData
+		if i < len(befores) {
+			before = befores[i]
+		}
+		if i < len(afters) {
+			after = afters[i]
+		}
+		subject := after
+		if subject == nil {
+			subject = before
+		}
+		if subject == nil {
+			continue
+		}
+		id, err := getID(subject)
+		if err != nil {
+			return eris.Wrap(err, "failed to get entity ID for audit")
+		}
+		changes := map[string]AuditChange{}
+		for _, name := range s.DBNames {
+			field := s.FieldsByDBName[name]
+			var change AuditChange
+			if before != nil {
+				change.Before, _ = field.ValueOf(ctx, reflect.ValueOf(before))
+			}
+			if after != nil {
+				change.After, _ = field.ValueOf(ctx, reflect.ValueOf(after))
+			}
+			if auditEqual(change.Before, change.After) {
+				continue
+			}
+			if slices.Contains(c.redacted, name) {
+				change = AuditChange{Before: redact(change.Before), After: redact(change.After)}
+			}
+			changes[name] = change
+		}
+		if len(changes) == 0 {
+			continue
+		}
+		data, err := json.Marshal(changes)
+		if err != nil {
+			return eris.Wrap(err, "failed to marshal audit changes")
+		}
+		logs = append(logs, &AuditLog{
+			CreatedAt:  now,
+			Collection: s.Table,
+			EntityID:   id,
+			Action:     action,
+			Actor:      actor,
+			Changes:    data,
+		})
+	}
+	if len(logs) == 0 {
+		return nil
+	}
+	if err := tx.CreateInBatches(logs, 500).Error; err != nil {
+		return eris.Wrap(err, "failed to record audit log")
+	}
+	return nil
+}
+
+// auditTenantAllows reports whether the entity log is about, as its columns were
+// recorded before the change, belongs to the tenant of ctx
+func auditTenantAllows[TData any](ctx context.Context, log *AuditLog) bool {
+	if !isTenantScoped[TData]() || isSystemContext(ctx) {
+		return true
+	}
+	tenant, ok := TenantFromContext(ctx)
+	if !ok {
+		return false
+	}
+	var changes map[string]AuditChange
+	if err := json.Unmarshal(log.Changes, &changes); err != nil {
+		return false
+	}
+	recorded := func(column string) string {
+		value, _ := changes[column].Before.(string)
+		if value == "" {
+			value, _ = changes[column].After.(string)
+		}
+		return value
+	}
+	t := reflect.TypeFor[TData]()
+	if _, ok := t.FieldByName("OrganizationID"); ok && recorded(OrganizationColumn) != tenant.OrganizationID.String() {
+		return false
+	}
+	if _, ok := t.FieldByName("BranchID"); ok && tenant.BranchID != uuid.Nil && recorded(BranchColumn) != tenant.BranchID.String() {
+		return false
+	}
+	return true
+}
+
+// redact hides value, keeping nil to tell a set column from an unset one
+func redact(value any) any {
+	if value == nil {
+		return nil
+	}
+	return AuditRedacted
+}
+
+func auditEqual(a, b any) bool {
+	if at, ok := a.(time.Time); ok {
+		if bt, ok := b.(time.Time); ok {
+			return at.Equal(bt)
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,491 @@
+package horizon_services
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lands-horizon/horizon-server/services/horizon"
+	"github.com/rotisserie/eris"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// DefaultBatchSize is the number of rows written per statement by bulk operations
+const DefaultBatchSize = 500
+
+// ErrDuplicateID is returned by bulk updates and upserts given the same ID more
+// than once, which a single INSERT ... ON CONFLICT statement cannot apply
+var ErrDuplicateID = eris.New("entity appears more than once in bulk write")
+
+// UpdateFieldsByIDs implements Repository.
+func (c *CollectionManager[TData, TResponse, TRequest]) UpdateFieldsByIDs(ctx context.Context, ids []uuid.UUID, fields *TData, preloads ...string) error {
+	return c.transaction(ctx, func(tx *gorm.DB) error {
+		return c.UpdateFieldsByIDsWithTx(ctx, tx, ids, fields, preloads...)
+	})
+}
+
+// UpdateFieldsByIDsWithTx implements Repository.
+func (c *CollectionManager[TData, TResponse, TRequest]) UpdateFieldsByIDsWithTx(ctx context.Context, tx *gorm.DB, ids []uuid.UUID, fields *TData, preloads ...string) error {
+	tx, err := c.session(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if err := c.hooks.BeforeUpdate.run(ctx, tx, fields); err != nil {
+		return err
+	}
+	if err := c.stampTenant(ctx, fields); err != nil {
+		return err
+	}
+	versionField, err := c.versionField(tx)
+	if err != nil {
+		return err
+	}
+	if versionField != nil {
+		if err := versionField.Set(ctx, reflect.ValueOf(fields), 0); err != nil {
+			return eris.Wrap(err, "failed to reset entity version")
+		}
+	}
+	preloads = horizon.MergeString(c.preloads, preloads)
+	for _, batch := range chunk(ids, c.batchSize) {
+		stored, err := c.lockRows(tx, batch, false)
+		if err != nil {
+			return err
+		}
+		befores := make([]*TData, len(batch))
+		for i, id := range batch {
+			before, ok := stored[id]
+			if !ok {
+				return eris.Wrapf(gorm.ErrRecordNotFound, "failed to find entity with id %s for update", id)
+			}
+			befores[i] = before
+		}
+		if err := tx.Model(new(TData)).Where("id IN ?", batch).Updates(fields).Error; err != nil {
+			return eris.Wrap(err, "failed to update fields of entities in transaction")
+		}
+		if versionField != nil {
+			if err := tx.Model(new(TData)).Where("id IN ?", batch).
+				UpdateColumn(VersionColumn, gorm.Expr(VersionColumn+" + 1")).Error; err != nil {
+				return eris.Wrap(err, "failed to increment entity versions")
+			}
+		}
+		afters := make([]*TData, len(batch))
+		for i, id := range batch {
+			afters[i] = new(TData)
+			if err := setID(afters[i], id); err != nil {
+				return eris.Wrap(err, "failed to set entity ID for reload")
+			}
+		}
+		if err := c.reloadMany(tx, afters, preloads, true); err != nil {
+			return err
+		}
+		if err := c.hooks.AfterUpdate.run(ctx, tx, afters...); err != nil {
+			return err
+		}
+		if err := c.auditMany(ctx, tx, AuditUpdate, befores, afters); err != nil {
+			return err
+		}
+		if err := c.broadcastMany(ctx, tx, EventUpdated, c.updated, afters); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateMany writes a batch of existing entities with a single INSERT ... ON CONFLICT
+// statement per chunk. Every row must exist and carry its current version, if any.
+func (c *CollectionManager[TData, TResponse, TRequest]) updateMany(ctx context.Context, tx *gorm.DB, entities []*TData, preloads []string) error {
+	s, err := c.schema(tx)
+	if err != nil {
+		return err
+	}
+	preloads = horizon.MergeString(c.preloads, preloads)
+	for _, batch := range chunk(entities, c.batchSize) {
+		ids, err := entityIDs(batch)
+		if err != nil {
+			return err
+		}
+		stored, err := c.lockRows(tx, ids, false)
+		if err != nil {
+			return err
+		}
+		befores := make([]*TData, len(batch))
+		now := time.Now()
+		for i, entity := range batch {
+			before, ok := stored[ids[i]]
+			if !ok {
+				return eris.Wrapf(gorm.ErrRecordNotFound, "failed to find entity with id %s for update", ids[i])
+			}
+			if err := prepareUpdate(ctx, s, ids[i], entity, before, now); err != nil {
+				return err
+			}
+			befores[i] = before
+		}
+		if _, err := upsertBatch(ctx, tx, s, batch); err != nil {
+			return eris.Wrap(err, "failed to update entities in transaction")
+		}
+		if err := c.reloadMany(tx, batch, preloads, false); err != nil {
+			return err
+		}
+		if err := c.hooks.AfterUpdate.run(ctx, tx, batch...); err != nil {
+			return err
+		}
+		if err := c.auditMany(ctx, tx, AuditUpdate, befores, batch); err != nil {
+			return err
+		}
+		if err := c.broadcastMany(ctx, tx, EventUpdated, c.updated, batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// upsertMany inserts new entities and overwrites existing ones with a single
+// INSERT ... ON CONFLICT statement per chunk. Entities without an ID are given one.
+func (c *CollectionManager[TData, TResponse, TRequest]) upsertMany(ctx context.Context, tx *gorm.DB, entities []*TData, preloads []string) error {
+	s, err := c.schema(tx)
+	if err != nil {
+		return err
+	}
+	preloads = horizon.MergeString(c.preloads, preloads)
+	for _, batch := range chunk(entities, c.batchSize) {
+		for _, entity := range batch {
+			if id, err := getID(entity); err == nil && id == uuid.Nil {
+				if err := setID(entity, uuid.New()); err != nil {
+					return eris.Wrap(err, "failed to set entity ID for upsert")
+				}
+			}
+		}
+		ids, err := entityIDs(batch)
+		if err != nil {
+			return err
+		}
+		stored, err := c.lockRows(tx, ids, true)
+		if err != nil {
+			return err
+		}
+		var created, updated, befores []*TData
+		now := time.Now()
+		for i, entity := range batch {
+			before, ok := stored[ids[i]]
+			if !ok {
+				created = append(created, entity)
+				continue
+			}
+			if isTrashed(ctx, s, before) {
+				return eris.Wrapf(gorm.ErrRecordNotFound, "entity with id %s is deleted and must be restored before upsert", ids[i])
+			}
+			if err := prepareUpdate(ctx, s, ids[i], entity, before, now); err != nil {
+				return err
+			}
+			updated = append(updated, entity)
+			befores = append(befores, before)
+		}
+		if err := c.hooks.BeforeCreate.run(ctx, tx, created...); err != nil {
+			return err
+		}
+		if err := c.hooks.BeforeUpdate.run(ctx, tx, updated...); err != nil {
+			return err
+		}
+		if err := c.stampTenant(ctx, batch...); err != nil {
+			return err
+		}
+		affected, err := upsertBatch(ctx, tx, s, batch)
+		if err != nil {
+			return eris.Wrap(err, "failed to upsert entities in transaction")
+		}
+		if affected != int64(len(batch)) {
+			return eris.Wrapf(gorm.ErrRecordNotFound, "failed to upsert %d entities that exist outside the tenant scope", int64(len(batch))-affected)
+		}
+		if err := c.reloadMany(tx, batch, preloads, false); err != nil {
+			return err
+		}
+		if err := c.hooks.AfterCreate.run(ctx, tx, created...); err != nil {
+			return err
+		}
+		if err := c.hooks.AfterUpdate.run(ctx, tx, updated...); err != nil {
+			return err
+		}
+		if err := c.hooks.AfterUpsert.run(ctx, tx, batch...); err != nil {
+			return err
+		}
+		if err := c.auditMany(ctx, tx, AuditCreate, nil, created); err != nil {
+			return err
+		}
+		if err := c.auditMany(ctx, tx, AuditUpdate, befores, updated); err != nil {
+			return err
+		}
+		if err := c.broadcastMany(ctx, tx, EventCreated, c.created, created); err != nil {
+			return err
+		}
+		if err := c.broadcastMany(ctx, tx, EventUpdated, c.updated, updated); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteMany removes a batch of entities with a single DELETE per chunk. Rows that
+// no longer exist are skipped unless the entity carries a version. Hooks get the
+// stored rows rather than the entities given.
+func (c *CollectionManager[TData, TResponse, TRequest]) deleteMany(ctx context.Context, tx *gorm.DB, entities []*TData) error {
+	versionField, err := c.versionField(tx)
+	if err != nil {
+		return err
+	}
+	for _, batch := range chunk(entities, c.batchSize) {
+		ids, err := entityIDs(batch)
+		if err != nil {
+			return err
+		}
+		stored, err := c.lockRows(tx, ids, false)
+		if err != nil {
+			return err
+		}
+		deleted := make([]*TData, 0, len(batch))
+		deletedIDs := make([]uuid.UUID, 0, len(batch))
+		for i, entity := range batch {
+			before, ok := stored[ids[i]]
+			if versionField != nil {
+				current, _ := versionField.ValueOf(ctx, reflect.ValueOf(entity))
+				if expected := versionOf(current); expected != 0 {
+					if !ok {
+						return &ConflictError{ID: ids[i], Version: expected}
+					}
+					if actual, _ := versionField.ValueOf(ctx, reflect.ValueOf(before)); versionOf(actual) != expected {
+						return &ConflictError{ID: ids[i], Version: expected}
+					}
+				}
+			}
+			if ok {
+				deleted = append(deleted, before)
+				deletedIDs = append(deletedIDs, ids[i])
+				delete(stored, ids[i])
+			}
+		}
+		if len(deleted) == 0 {
+			continue
+		}
+		if err := c.hooks.BeforeDelete.run(ctx, tx, deleted...); err != nil {
+			return err
+		}
+		if err := tx.Where("id IN ?", deletedIDs).Delete(new(TData)).Error; err != nil {
+			return eris.Wrap(err, "failed to delete entities in transaction")
+		}
+		if err := c.hooks.AfterDelete.run(ctx, tx, deleted...); err != nil {
+			return err
+		}
+		if err := c.auditMany(ctx, tx, AuditDelete, deleted, nil); err != nil {
+			return err
+		}
+		if err := c.broadcastMany(ctx, tx, EventDeleted, c.deleted, deleted); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lockRows loads the rows with the given ids FOR UPDATE, keyed by id
+func (c *CollectionManager[TData, TResponse, TRequest]) lockRows(tx *gorm.DB, ids []uuid.UUID, unscoped bool) (map[uuid.UUID]*TData, error) {
+	db := tx.Clauses(clause.Locking{Strength: "UPDATE"})
+	if unscoped {
+		db = db.Unscoped()
+	}
+	var rows []*TData
+	if err := db.Where("id IN ?", ids).Find(&rows).Error; err != nil {
+		return nil, eris.Wrap(err, "failed to lock entities in transaction")
+	}
+	stored := make(map[uuid.UUID]*TData, len(rows))
+	for _, row := range rows {
+		id, err := getID(row)
+		if err != nil {
+			return nil, eris.Wrap(err, "failed to get ID of locked entity")
+		}
+		stored[id] = row
+	}
+	return stored, nil
+}
+
+// reloadMany replaces each entity with its stored row and the given preloads. Unless
+// always is set it does nothing when there is nothing to preload.
+func (c *CollectionManager[TData, TResponse, TRequest]) reloadMany(tx *gorm.DB, entities []*TData, preloads []string, always bool) error {
+	if len(entities) == 0 || (len(preloads) == 0 && !always) {
+		return nil
+	}
+	ids, err := entityIDs(entities)
+	if err != nil {
+		return err
+	}
+	db := tx.Unscoped().Model(new(TData))
+	for _, preload := range preloads {
+		db = db.Preload(preload)
+	}
+	var reloaded []*TData
+	if err := db.Where("id IN ?", ids).Find(&reloaded).Error; err != nil {
+		return eris.Wrap(err, "failed to reload entities with preloads in transaction")
+	}
+	reloadedMap := make(map[uuid.UUID]*TData, len(reloaded))
+	for _, e := range reloaded {
+		id, _ := getID(e)
+		reloadedMap[id] = e
+	}
+	for i, entity := range entities {
+		reloadedEntity, ok := reloadedMap[ids[i]]
+		if !ok {
+			return eris.Errorf("failed to find reloaded entity with ID %s in transaction", ids[i])
+		}
+		*entity = *reloadedEntity
+	}
+	return nil
+}
+
+// broadcastMany enqueues the messages of a batch, one per entity and topic, so that
+// subscribers receive the same payload as for a single write
+func (c *CollectionManager[TData, TResponse, TRequest]) broadcastMany(ctx context.Context, tx *gorm.DB, event string, topics func(*TData) []string, entities []*TData) error {
+	if topics == nil || len(entities) == 0 {
+		return nil
+	}
+	if c.service.Outbox == nil {
+		return eris.New("broadcasts require an outbox service")
+	}
+	var entries []horizon.OutboxEntry
+	for _, entity := range entities {
+		envelope, err := c.envelope(ctx, event, c.ToModel(entity), entity)
+		if err != nil {
+			return err
+		}
+		for _, topic := range topics(entity) {
+			entries = append(entries, horizon.OutboxEntry{Topic: topic, Payload: envelope})
+		}
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	if err := c.service.Outbox.EnqueueMany(ctx, tx, entries); err != nil {
+		return eris.Wrap(err, "failed to enqueue broadcast")
+	}
+	return nil
+}
+
+// prepareUpdate readies entity to overwrite the stored row: the version is checked
+// and incremented, update timestamps are refreshed and creation timestamps kept.
+func prepareUpdate[TData any](ctx context.Context, s *schema.Schema, id uuid.UUID, entity *TData, stored *TData, now time.Time) error {
+	value, storedValue := reflect.ValueOf(entity), reflect.ValueOf(stored)
+	if field := s.LookUpField(VersionColumn); field != nil {
+		current, _ := field.ValueOf(ctx, value)
+		actual, _ := field.ValueOf(ctx, storedValue)
+		if expected := versionOf(current); expected != 0 && expected != versionOf(actual) {
+			return &ConflictError{ID: id, Version: expected}
+		}
+		if err := field.Set(ctx, value, versionOf(actual)+1); err != nil {
+			return eris.Wrap(err, "failed to increment entity version")
+		}
+	}
+	for _, field := range s.Fields {
+		switch {
+		case field.AutoUpdateTime > 0:
+			if err := field.Set(ctx, value, now); err != nil {
+				return eris.Wrapf(err, "failed to set %s", field.DBName)
+			}
+		case field.AutoCreateTime > 0:
+			original, _ := field.ValueOf(ctx, storedValue)
+			if err := field.Set(ctx, value, original); err != nil {
+				return eris.Wrapf(err, "failed to keep %s", field.DBName)
+			}
+		}
+	}
+	return nil
+}
+
+// upsertBatch inserts batch, overwriting every column but the primary key,
+// creation timestamp and deletion time of rows that already exist within the
+// tenant of ctx. It returns the number of rows inserted or overwritten, which
+// falls short of the batch when a row exists outside the tenant.
+func upsertBatch[TData any](ctx context.Context, tx *gorm.DB, s *schema.Schema, batch []*TData) (int64, error) {
+	where, err := tenantConditions[TData](ctx)
+	if err != nil {
+		return 0, err
+	}
+	conflict := make([]clause.Column, 0, len(s.PrimaryFieldDBNames))
+	for _, name := range s.PrimaryFieldDBNames {
+		conflict = append(conflict, clause.Column{Name: name})
+	}
+	columns := make([]string, 0, len(s.DBNames))
+	for _, name := range s.DBNames {
+		field := s.FieldsByDBName[name]
+		if field.PrimaryKey || field.AutoCreateTime > 0 || isDeletedAt(field) {
+			continue
+		}
+		columns = append(columns, name)
+	}
+	result := tx.Clauses(clause.OnConflict{
+		Columns:   conflict,
+		DoUpdates: clause.AssignmentColumns(columns),
+		Where:     clause.Where{Exprs: where},
+	}).Create(batch)
+	return result.RowsAffected, result.Error
+}
+
+// isDeletedAt reports whether field holds the soft delete time of its entity
+func isDeletedAt(field *schema.Field) bool {
+	return field.FieldType == reflect.TypeFor[gorm.DeletedAt]()
+}
+
+// isTrashed reports whether entity is soft deleted
+func isTrashed[TData any](ctx context.Context, s *schema.Schema, entity *TData) bool {
+	for _, field := range s.Fields {
+		if !isDeletedAt(field) {
+			continue
+		}
+		value, _ := field.ValueOf(ctx, reflect.ValueOf(entity))
+		deletedAt, ok := value.(gorm.DeletedAt)
+		return ok && deletedAt.Valid
+	}
+	return false
+}
+
+// uniqueIDs returns ErrDuplicateID when two entities share an ID. Entities without
+// an ID are left to be given one.
+func uniqueIDs[TData any](entities []*TData) error {
+	seen := make(map[uuid.UUID]struct{}, len(entities))
+	for _, entity := range entities {
+		id, err := getID(entity)
+		if err != nil {
+			return eris.Wrap(err, "failed to get ID for entity in transaction")
+		}
+		if id == uuid.Nil {
+			continue
+		}
+		if _, ok := seen[id]; ok {
+			return eris.Wrapf(ErrDuplicateID, "entity with id %s appears more than once", id)
+		}
+		seen[id] = struct{}{}
+	}
+	return nil
+}
+
+func entityIDs[TData any](entities []*TData) ([]uuid.UUID, error) {
+	ids := make([]uuid.UUID, len(entities))
+	for i, entity := range entities {
+		id, err := getID(entity)
+		if err != nil {
+			return nil, eris.Wrap(err, "failed to get ID for entity in transaction")
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+// chunk splits items into consecutive slices of at most size elements
+func chunk[T any](items []T, size int) [][]T {
+	if size <= 0 {
+		size = DefaultBatchSize
+	}
+	chunks := make([][]T, 0, (len(items)+size-1)/size)
+	for start := 0; start < len(items); start += size {
+		chunks = append(chunks, items[start:min(start+size, len(items))])
+	}
+	return chunks
+}
@@ -0,0 +1,418 @@
+package horizon_services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rotisserie/eris"
+	"gorm.io/gorm"
+)
+
+// CacheParams configures the read-through cache of a collection
+type CacheParams struct {
+	// TTL of entities cached by GetByID; zero disables entity caching
+	TTL time.Duration
+
+	// ListTTL of List and Paginate results; zero disables list caching
+	ListTTL time.Duration
+
+	// Topics are broker subjects whose messages invalidate the cache, usually the
+	// collection wide topics of Created, Updated, Deleted, Restored and ForceDeleted.
+	// They carry invalidations from other instances and from WithTx writes once committed.
+	Topics []string
+}
+
+// CachedRepository decorates a Repository with a read-through cache backed by
+// CacheService. Entities are cached by ID and lists by query under a collection
+// generation that every write bumps. Reads with explicit preloads, within a
+// unit of work or with a WithoutCache context bypass the cache.
+type CachedRepository[TData any, TResponse any, TRequest any] struct {
+	Repository[TData, TResponse, TRequest]
+
+	service *HorizonService
+	params  CacheParams
+	prefix  string
+}
+
+type cacheBypassContextKey struct{}
+
+// WithoutCache returns a context whose reads skip the cache of CachedRepository
+// and go to the database, e.g. to check a precondition against the stored row
+func WithoutCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cacheBypassContextKey{}, true)
+}
+
+// NewCachedRepository wraps repository with a read-through cache. Broker
+// subscriptions for params.Topics are made when the service runs.
+func NewCachedRepository[TData any, TResponse any, TRequest any](
+	repository Repository[TData, TResponse, TRequest],
+	service *HorizonService,
+	params CacheParams,
+) *CachedRepository[TData, TResponse, TRequest] {
+	r := &CachedRepository[TData, TResponse, TRequest]{
+		Repository: repository,
+		service:    service,
+		params:     params,
+		prefix:     "repository:" + collectionName[TData](),
+	}
+	if len(params.Topics) > 0 {
+		service.OnRun(r.subscribe)
+	}
+	return r
+}
+
+// GetByID implements Repository.
+func (r *CachedRepository[TData, TResponse, TRequest]) GetByID(ctx context.Context, id uuid.UUID, preloads ...string) (*TData, error) {
+	if r.params.TTL <= 0 || len(preloads) > 0 || bypassCache(ctx) {
+		return r.Repository.GetByID(ctx, id, preloads...)
+	}
+	key := r.entityKey(id)
+	entity := new(TData)
+	if r.load(ctx, key, entity) {
+		if !tenantAllows(ctx, entity) {
+			return nil, eris.Wrapf(gorm.ErrRecordNotFound, "failed to find entity with id: %s", id)
+		}
+		return entity, nil
+	}
+	entity, err := r.Repository.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	r.store(ctx, key, entity, r.params.TTL)
+	return entity, nil
+}
+
+// GetByIDRaw implements Repository.
+func (r *CachedRepository[TData, TResponse, TRequest]) GetByIDRaw(ctx context.Context, id uuid.UUID, preloads ...string) (*TResponse, error) {
+	entity, err := r.GetByID(ctx, id, preloads...)
+	if err != nil {
+		return nil, err
+	}
+	return r.ToModel(entity), nil
+}
+
+// List implements Repository.
+func (r *CachedRepository[TData, TResponse, TRequest]) List(ctx context.Context, preloads ...string) ([]*TData, error) {
+	if r.params.ListTTL <= 0 || len(preloads) > 0 || bypassCache(ctx) {
+		return r.Repository.List(ctx, preloads...)
+	}
+	key, ok := r.listKey(ctx, "list")
+	var entities []*TData
+	if ok && r.load(ctx, key, &entities) {
+		return entities, nil
+	}
+	entities, err := r.Repository.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		r.store(ctx, key, entities, r.params.ListTTL)
+	}
+	return entities, nil
+}
+
+// ListRaw implements Repository.
+func (r *CachedRepository[TData, TResponse, TRequest]) ListRaw(ctx context.Context, preloads ...string) ([]*TResponse, error) {
+	entities, err := r.List(ctx, preloads...)
+	if err != nil {
+		return nil, err
+	}
+	return r.ToModels(entities), nil
+}
+
+// Paginate implements Repository.
+func (r *CachedRepository[TData, TResponse, TRequest]) Paginate(ctx context.Context, query *PageQuery, preloads ...string) (*PageResult[TData], error) {
+	if r.params.ListTTL <= 0 || len(preloads) > 0 || bypassCache(ctx) {
+		return r.Repository.Paginate(ctx, query, preloads...)
+	}
+	data, err := json.Marshal(query)
+	if err != nil {
+		return r.Repository.Paginate(ctx, query)
+	}
+	sum := sha256.Sum256(data)
+	key, ok := r.listKey(ctx, "page:"+hex.EncodeToString(sum[:]))
+	result := &PageResult[TData]{}
+	if ok && r.load(ctx, key, result) {
+		return result, nil
+	}
+	result, err = r.Repository.Paginate(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		r.store(ctx, key, result, r.params.ListTTL)
+	}
+	return result, nil
+}
+
+// PaginateRaw implements Repository.
+func (r *CachedRepository[TData, TResponse, TRequest]) PaginateRaw(ctx context.Context, query *PageQuery, preloads ...string) (*PageResult[TResponse], error) {
+	result, err := r.Paginate(ctx, query, preloads...)
+	if err != nil {
+		return nil, err
+	}
+	return &PageResult[TResponse]{
+		Items:      r.ToModels(result.Items),
+		Total:      result.Total,
+		Page:       result.Page,
+		Size:       result.Size,
+		NextCursor: result.NextCursor,
+	}, nil
+}
+
+// Search implements Repository. Without text it is a page of the collection and
+// served by Paginate from the list cache.
+func (r *CachedRepository[TData, TResponse, TRequest]) Search(ctx context.Context, text string, query *PageQuery, preloads ...string) (*PageResult[TData], error) {
+	if strings.TrimSpace(text) == "" {
+		return r.Paginate(ctx, query, preloads...)
+	}
+	return r.Repository.Search(ctx, text, query, preloads...)
+}
+
+// SearchRaw implements Repository.
+func (r *CachedRepository[TData, TResponse, TRequest]) SearchRaw(ctx context.Context, text string, query *PageQuery, preloads ...string) (*PageResult[TResponse], error) {
+	result, err := r.Search(ctx, text, query, preloads...)
+	if err != nil {
+		return nil, err
+	}
+	return &PageResult[TResponse]{
+		Items:      r.ToModels(result.Items),
+		Total:      result.Total,
+		Page:       result.Page,
+		Size:       result.Size,
+		NextCursor: result.NextCursor,
+	}, nil
+}
+
+// Import implements Repository.
+func (r *CachedRepository[TData, TResponse, TRequest]) Import(ctx context.Context, reader io.Reader, format ExportFormat) (*ImportResult, error) {
+	result, err := r.Repository.Import(ctx, reader, format)
+	r.invalidate(ctx)
+	return result, err
+}
+
+// Create implements Repository.
+func (r *CachedRepository[TData, TResponse, TRequest]) Create(ctx context.Context, entity *TData, preloads ...string) error {
+	return r.invalidateAfter(ctx, r.Repository.Create(ctx, entity, preloads...))
+}
+
+// CreateMany implements Repository.
+func (r *CachedRepository[TData, TResponse, TRequest]) CreateMany(ctx context.Context, entities []*TData, preloads ...string) error {
+	return r.invalidateAfter(ctx, r.Repository.CreateMany(ctx, entities, preloads...))
+}
+
+// Update implements Repository.
+func (r *CachedRepository[TData, TResponse, TRequest]) Update(ctx context.Context, entity *TData, preloads ...string) error {
+	return r.invalidateAfter(ctx, r.Repository.Update(ctx, entity, preloads...), entity)
+}
+
+// UpdateByID implements Repository.
+func (r *CachedRepository[TData, TResponse, TRequest]) UpdateByID(ctx context.Context, id uuid.UUID, entity *TData, preloads ...string) error {
+	return r.invalidateAfter(ctx, r.Repository.UpdateByID(ctx, id, entity, preloads...), entity)
+}
+
+// UpdateFields implements Repository.
+func (r *CachedRepository[TData, TResponse, TRequest]) UpdateFields(ctx context.Context, id uuid.UUID, fields *TData, preloads ...string) error {
+	err := r.Repository.UpdateFields(ctx, id, fields, preloads...)
+	r.invalidate(ctx, id)
+	return err
+}
+
+// UpdateFieldsByIDs implements Repository.
+func (r *CachedRepository[TData, TResponse, TRequest]) UpdateFieldsByIDs(ctx context.Context, ids []uuid.UUID, fields *TData, preloads ...string) error {
+	err := r.Repository.UpdateFieldsByIDs(ctx, ids, fields, preloads...)
+	r.invalidate(ctx, ids...)
+	return err
+}
+
+// UpdateMany implements Repository.
+func (r *CachedRepository[TData, TResponse, TRequest]) UpdateMany(ctx context.Context, entities []*TData, preloads ...string) error {
+	return r.invalidateAfter(ctx, r.Repository.UpdateMany(ctx, entities, preloads...), entities...)
+}
+
+// Upsert implements Repository.
+func (r *CachedRepository[TData, TResponse, TRequest]) Upsert(ctx context.Context, entity *TData, preloads ...string) error {
+	return r.invalidateAfter(ctx, r.Repository.Upsert(ctx, entity, preloads...), entity)
+}
+
+// UpsertMany implements Repository.
+func (r *CachedRepository[TData, TResponse, TRequest]) UpsertMany(ctx context.Context, entities []*TData, preloads ...string) error {
+	return r.invalidateAfter(ctx, r.Repository.UpsertMany(ctx, entities, preloads...), entities...)
+}
+
+// Delete implements Repository.
+func (r *CachedRepository[TData, TResponse, TRequest]) Delete(ctx context.Context, entity *TData) error {
+	return r.invalidateAfter(ctx, r.Repository.Delete(ctx, entity), entity)
+}
+
+// DeleteByID implements Repository.
+func (r *CachedRepository[TData, TResponse, TRequest]) DeleteByID(ctx context.Context, id uuid.UUID) error {
+	err := r.Repository.DeleteByID(ctx, id)
+	r.invalidate(ctx, id)
+	return err
+}
+
+// DeleteMany implements Repository.
+func (r *CachedRepository[TData, TResponse, TRequest]) DeleteMany(ctx context.Context, entities []*TData) error {
+	return r.invalidateAfter(ctx, r.Repository.DeleteMany(ctx, entities), entities...)
+}
+
+// Restore implements Repository.
+func (r *CachedRepository[TData, TResponse, TRequest]) Restore(ctx context.Context, entity *TData, preloads ...string) error {
+	return r.invalidateAfter(ctx, r.Repository.Restore(ctx, entity, preloads...), entity)
+}
+
+// RestoreByID implements Repository.
+func (r *CachedRepository[TData, TResponse, TRequest]) RestoreByID(ctx context.Context, id uuid.UUID) error {
+	err := r.Repository.RestoreByID(ctx, id)
+	r.invalidate(ctx, id)
+	return err
+}
+
+// ForceDelete implements Repository.
+func (r *CachedRepository[TData, TResponse, TRequest]) ForceDelete(ctx context.Context, entity *TData) error {
+	return r.invalidateAfter(ctx, r.Repository.ForceDelete(ctx, entity), entity)
+}
+
+// PurgeDeleted implements Repository.
+func (r *CachedRepository[TData, TResponse, TRequest]) PurgeDeleted(ctx context.Context, retention time.Duration) (int64, error) {
+	purged, err := r.Repository.PurgeDeleted(ctx, retention)
+	if purged > 0 {
+		r.invalidate(ctx)
+	}
+	return purged, err
+}
+
+// Invalidate drops the cached entities with the given ids and every cached list
+func (r *CachedRepository[TData, TResponse, TRequest]) Invalidate(ctx context.Context, ids ...uuid.UUID) {
+	r.invalidate(ctx, ids...)
+}
+
+// invalidateAfter invalidates entities and lists once a write has returned, also
+// when it failed since a conflict usually means the cached copy is stale. It
+// returns err unchanged.
+func (r *CachedRepository[TData, TResponse, TRequest]) invalidateAfter(ctx context.Context, err error, entities ...*TData) error {
+	ids := make([]uuid.UUID, 0, len(entities))
+	for _, entity := range entities {
+		if entity == nil {
+			continue
+		}
+		if id, idErr := getID(entity); idErr == nil && id != uuid.Nil {
+			ids = append(ids, id)
+		}
+	}
+	r.invalidate(ctx, ids...)
+	return err
+}
+
+// invalidate runs detached from the cancellation of ctx: a write that committed
+// must not leave stale entries behind because its request went away. Within a
+// unit of work it runs again on commit, since readers may refill the cache from
+// the old rows until then.
+func (r *CachedRepository[TData, TResponse, TRequest]) invalidate(ctx context.Context, ids ...uuid.UUID) {
+	ctx = context.WithoutCancel(ctx)
+	r.evict(ctx, ids...)
+	if uow, ok := UnitOfWorkFromContext(ctx); ok {
+		uow.AfterCommit(func() { r.evict(ctx, ids...) })
+	}
+}
+
+func (r *CachedRepository[TData, TResponse, TRequest]) evict(ctx context.Context, ids ...uuid.UUID) {
+	for _, id := range ids {
+		if err := r.service.Cache.Delete(ctx, r.entityKey(id)); err != nil {
+			r.service.ReportError("", eris.Wrapf(err, "failed to invalidate cached %s", r.entityKey(id)))
+		}
+	}
+	generation := strconv.FormatInt(time.Now().UnixNano(), 10)
+	if err := r.service.Cache.Set(ctx, r.prefix+":generation", generation, 0); err != nil {
+		r.service.ReportError("", eris.Wrapf(err, "failed to invalidate cached lists of %s", r.prefix))
+	}
+}
+
+// subscribe invalidates the cache on every message of params.Topics. The
+// subscriptions outlive ctx, which only covers startup, and end with the broker.
+func (r *CachedRepository[TData, TResponse, TRequest]) subscribe(ctx context.Context) error {
+	if r.service.Broker == nil {
+		return eris.New("cached repository requires a broker service for invalidation topics")
+	}
+	for _, topic := range r.params.Topics {
+		if _, err := r.service.Broker.Subscribe(context.WithoutCancel(ctx), topic, func(payload any) error {
+			r.invalidate(context.Background(), payloadIDs(payload)...)
+			return nil
+		}); err != nil {
+			return eris.Wrapf(err, "failed to subscribe %s cache to %s", r.prefix, topic)
+		}
+	}
+	return nil
+}
+
+func (r *CachedRepository[TData, TResponse, TRequest]) entityKey(id uuid.UUID) string {
+	return r.prefix + ":id:" + id.String()
+}
+
+// listKey scopes name to the current list generation and the tenant of ctx. It reports false when the
+// generation cannot be read, in which case the result must not be cached.
+func (r *CachedRepository[TData, TResponse, TRequest]) listKey(ctx context.Context, name string) (string, bool) {
+	generation, err := r.service.Cache.Get(ctx, r.prefix+":generation")
+	if err != nil {
+		return "", false
+	}
+	if generation == nil {
+		generation = "0"
+	}
+	return fmt.Sprintf("%s:%v:%s:%s", r.prefix, generation, tenantKey(ctx), name), true
+}
+
+// load decodes the cached value of key into target and reports whether it was found
+func (r *CachedRepository[TData, TResponse, TRequest]) load(ctx context.Context, key string, target any) bool {
+	value, err := r.service.Cache.Get(ctx, key)
+	if err != nil || value == nil {
+		return false
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(data, target) == nil
+}
+
+func (r *CachedRepository[TData, TResponse, TRequest]) store(ctx context.Context, key string, value any, ttl time.Duration) {
+	if err := r.service.Cache.Set(ctx, key, value, ttl); err != nil {
+		r.service.ReportError("", eris.Wrapf(err, "failed to cache %s", key))
+	}
+}
+
+// payloadIDs extracts the "id" of a broadcast payload
+func payloadIDs(payload any) []uuid.UUID {
+	value, ok := payload.(map[string]any)
+	if !ok {
+		return nil
+	}
+	raw, ok := value["id"].(string)
+	if !ok {
+		return nil
+	}
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		return nil
+	}
+	return []uuid.UUID{id}
+}
+
+// bypassCache reports whether reads of ctx must go to the database: within a
+// unit of work, which may see its own uncommitted rows, and for WithoutCache
+func bypassCache(ctx context.Context) bool {
+	if _, ok := UnitOfWorkFromContext(ctx); ok {
+		return true
+	}
+	bypass, _ := ctx.Value(cacheBypassContextKey{}).(bool)
+	return bypass
+}
@@ -0,0 +1,210 @@
+package horizon_services
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/rotisserie/eris"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// VersionColumn enables optimistic concurrency control when present on an entity:
+//
+//	Version int64 `gorm:"not null;default:1"`
+const VersionColumn = "version"
+
+// ConflictError is returned when an update or delete targets a version of the
+// entity that is no longer current.
+type ConflictError struct {
+	ID      uuid.UUID
+	Version int64
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("entity with id %s was modified by another request (expected version %d)", e.ID, e.Version)
+}
+
+// IsConflict reports whether err is or wraps a ConflictError
+func IsConflict(err error) bool {
+	var conflict *ConflictError
+	return eris.As(err, &conflict)
+}
+
+// ETag implements Repository.
+func (c *CollectionManager[TData, TResponse, TRequest]) ETag(entity *TData) string {
+	if entity == nil {
+		return ""
+	}
+	s, err := c.schema(c.service.Database.Client())
+	if err != nil {
+		return ""
+	}
+	value := reflect.ValueOf(entity)
+	if field := s.LookUpField(VersionColumn); field != nil {
+		version, _ := field.ValueOf(context.Background(), value)
+		return fmt.Sprintf(`"v%d"`, versionOf(version))
+	}
+	if field := s.LookUpField("updated_at"); field != nil {
+		if updatedAt, zero := field.ValueOf(context.Background(), value); !zero {
+			if t, ok := updatedAt.(time.Time); ok {
+				return fmt.Sprintf(`"t%d"`, t.UnixNano())
+			}
+		}
+	}
+	return ""
+}
+
+// Precondition implements Repository.
+func (c *CollectionManager[TData, TResponse, TRequest]) Precondition(ctx echo.Context, entity *TData) error {
+	ifMatch := strings.TrimSpace(ctx.Request().Header.Get("If-Match"))
+	if ifMatch == "" || ifMatch == "*" {
+		return nil
+	}
+	etag := c.ETag(entity)
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == etag {
+			return nil
+		}
+	}
+	id, _ := getID(entity)
+	conflict := &ConflictError{ID: id}
+	if version, err := strconv.ParseInt(strings.Trim(strings.TrimPrefix(ifMatch, "W/"), `"v`), 10, 64); err == nil {
+		conflict.Version = version
+	}
+	return conflict
+}
+
+// versionField returns the version column of TData, or nil when the entity is not versioned
+func (c *CollectionManager[TData, TResponse, TRequest]) versionField(tx *gorm.DB) (*schema.Field, error) {
+	s, err := c.schema(tx)
+	if err != nil {
+		return nil, err
+	}
+	return s.LookUpField(VersionColumn), nil
+}
+
+// save writes every column of entity. Versioned entities are only written when
+// the stored version still matches, and leave with their version incremented.
+// A zero version means the caller does not know it and the stored one is used.
+func (c *CollectionManager[TData, TResponse, TRequest]) save(ctx context.Context, tx *gorm.DB, entity *TData) error {
+	field, err := c.versionField(tx)
+	if err != nil {
+		return err
+	}
+	if field == nil && !isTenantScoped[TData]() {
+		return tx.Save(entity).Error
+	}
+	id, err := getID(entity)
+	if err != nil {
+		return eris.Wrap(err, "failed to get entity ID for update")
+	}
+	if field == nil {
+		// Save inserts when no row matched, which must not happen across tenants
+		result := tx.Model(entity).Select("*").Updates(entity)
+		if result.Error == nil && result.RowsAffected == 0 {
+			result.Error = eris.Wrapf(gorm.ErrRecordNotFound, "failed to find entity with id %s", id)
+		}
+		return result.Error
+	}
+	value := reflect.ValueOf(entity)
+	current, _ := field.ValueOf(ctx, value)
+	expected := versionOf(current)
+	if expected == 0 {
+		result := tx.Model(new(TData)).Select(VersionColumn).Where("id = ?", id).Scan(&expected)
+		if result.Error == nil && result.RowsAffected == 0 {
+			result.Error = gorm.ErrRecordNotFound
+		}
+		if result.Error != nil {
+			return eris.Wrapf(result.Error, "failed to load version of entity with id %s", id)
+		}
+	}
+	if err := field.Set(ctx, value, expected+1); err != nil {
+		return eris.Wrap(err, "failed to increment entity version")
+	}
+	result := tx.Model(entity).Select("*").Where(versionCondition(expected)).Updates(entity)
+	if result.Error == nil && result.RowsAffected == 0 {
+		result.Error = &ConflictError{ID: id, Version: expected}
+	}
+	if result.Error != nil {
+		_ = field.Set(ctx, value, expected)
+		return result.Error
+	}
+	return nil
+}
+
+// updateFields applies the non-zero fields for the given id. A non-zero version
+// on fields is treated as the expected version.
+func (c *CollectionManager[TData, TResponse, TRequest]) updateFields(ctx context.Context, tx *gorm.DB, id uuid.UUID, fields *TData) error {
+	field, err := c.versionField(tx)
+	if err != nil {
+		return err
+	}
+	if field == nil {
+		return tx.Model(new(TData)).Where("id = ?", id).Updates(fields).Error
+	}
+	value := reflect.ValueOf(fields)
+	current, _ := field.ValueOf(ctx, value)
+	expected := versionOf(current)
+
+	db := tx.Model(new(TData)).Where("id = ?", id)
+	if expected != 0 {
+		db = db.Where(versionCondition(expected))
+	}
+	if err := field.Set(ctx, value, 0); err != nil {
+		return eris.Wrap(err, "failed to reset entity version")
+	}
+	result := db.Updates(fields)
+	if result.Error == nil && result.RowsAffected == 1 {
+		result = tx.Model(new(TData)).Where("id = ?", id).UpdateColumn(VersionColumn, gorm.Expr(VersionColumn+" + 1"))
+	}
+	if result.Error == nil && result.RowsAffected == 0 && expected != 0 {
+		result.Error = &ConflictError{ID: id, Version: expected}
+	}
+	return result.Error
+}
+
+// deleteVersioned removes entity, failing with a ConflictError when it carries
+// a version that is no longer current.
+func (c *CollectionManager[TData, TResponse, TRequest]) deleteVersioned(ctx context.Context, tx *gorm.DB, entity *TData) error {
+	field, err := c.versionField(tx)
+	if err != nil {
+		return err
+	}
+	if field == nil {
+		return tx.Delete(entity).Error
+	}
+	current, _ := field.ValueOf(ctx, reflect.ValueOf(entity))
+	expected := versionOf(current)
+	if expected == 0 {
+		return tx.Delete(entity).Error
+	}
+	result := tx.Where(versionCondition(expected)).Delete(entity)
+	if result.Error == nil && result.RowsAffected == 0 {
+		id, _ := getID(entity)
+		result.Error = &ConflictError{ID: id, Version: expected}
+	}
+	return result.Error
+}
+
+func versionCondition(version int64) clause.Expression {
+	return clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: VersionColumn}, Value: version}
+}
+
+func versionOf(value any) int64 {
+	v := reflect.Indirect(reflect.ValueOf(value))
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint())
+	}
+	return 0
+}
@@ -0,0 +1,104 @@
+package horizon_services
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/google/uuid"
+	"github.com/lands-horizon/horizon-server/services/horizon"
+)
+
+// Events broadcast by a Repository. Their envelopes are typed
+// <collection>.<event>, e.g. feedback.created.
+const (
+	EventCreated      = "created"
+	EventUpdated      = "updated"
+	EventDeleted      = "deleted"
+	EventRestored     = "restored"
+	EventForceDeleted = "force_deleted"
+)
+
+// envelope wraps the broadcast payload of event on entities, traced by ctx and
+// tagged with their tenant
+func (c *CollectionManager[TData, TResponse, TRequest]) envelope(ctx context.Context, event string, payload any, entities ...*TData) (*horizon.Envelope, error) {
+	envelope, err := horizon.NewEnvelope(ctx, collectionName[TData]()+"."+event, payload)
+	if err != nil {
+		return nil, err
+	}
+	envelope.SchemaVersion = c.eventVersion
+	envelope.Tenant = eventTenant(ctx, entities)
+	return envelope, nil
+}
+
+// eventTenant identifies the tenant shared by entities as organization:branch,
+// falling back to the tenant of ctx. It is empty for entities that are not
+// tenant scoped and for batches spanning several tenants.
+func eventTenant[TData any](ctx context.Context, entities []*TData) string {
+	if !isTenantScoped[TData]() {
+		return ""
+	}
+	tenant := ""
+	for _, entity := range entities {
+		v := reflect.ValueOf(entity).Elem()
+		organization, _ := tenantFieldValue(v.FieldByName("OrganizationID"))
+		branch, _ := tenantFieldValue(v.FieldByName("BranchID"))
+		key := organization.String() + ":" + branch.String()
+		if tenant != "" && tenant != key {
+			return ""
+		}
+		tenant = key
+	}
+	if tenant == "" {
+		if scope, ok := TenantFromContext(ctx); ok {
+			tenant = scope.OrganizationID.String() + ":" + scope.BranchID.String()
+		}
+	}
+	return tenant
+}
+
+// Topics scoped to a tenant read tenant.<organization>.<branch>.<topic> and those
+// scoped to a user user.<user>.<topic>, which a horizon.TopicPolicy restricts to
+// the clients whose claims match with TenantTopicPattern and UserTopicPattern.
+const (
+	TenantTopicPrefix = "tenant"
+	UserTopicPrefix   = "user"
+)
+
+// TenantTopic scopes topic to tenant. A zero BranchID scopes it to the organization.
+func TenantTopic(tenant Tenant, topic string) string {
+	return TenantTopicPrefix + "." + tenant.OrganizationID.String() + "." + tenant.BranchID.String() + "." + topic
+}
+
+// TenantTopics scopes topics to the tenant of entity, for the broadcast topics
+// of tenant scoped repositories. Topics of entities that are not tenant scoped
+// are returned as is.
+func TenantTopics[TData any](entity *TData, topics ...string) []string {
+	if !isTenantScoped[TData]() || entity == nil {
+		return topics
+	}
+	v := reflect.ValueOf(entity).Elem()
+	organization, _ := tenantFieldValue(v.FieldByName("OrganizationID"))
+	branch, _ := tenantFieldValue(v.FieldByName("BranchID"))
+	scoped := make([]string, len(topics))
+	for i, topic := range topics {
+		scoped[i] = TenantTopic(Tenant{OrganizationID: organization, BranchID: branch}, topic)
+	}
+	return scoped
+}
+
+// UserTopic scopes topic to the user identified by userID
+func UserTopic(userID uuid.UUID, topic string) string {
+	return UserTopicPrefix + "." + userID.String() + "." + topic
+}
+
+// TenantTopicPattern is the horizon.TopicRule pattern covering the tenant scoped
+// topics matching topic of the client's own tenant
+func TenantTopicPattern(topic string) string {
+	return TenantTopicPrefix + ".{organization}.{branch}." + topic
+}
+
+// UserTopicPattern is the horizon.TopicRule pattern covering the user scoped
+// topics matching topic of the client itself
+func UserTopicPattern(topic string) string {
+	return UserTopicPrefix + ".{user}." + topic
+}
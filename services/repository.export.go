@@ -0,0 +1,313 @@
+package horizon_services
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rotisserie/eris"
+	"github.com/xuri/excelize/v2"
+)
+
+/*
+GET /feedback/export?format=xlsx&sort=-created_at&feedback_type=bug
+
+POST /feedback/import (multipart/form-data, file=feedback.csv)
+*/
+
+// ExportFormat is the spreadsheet format of Export and Import
+type ExportFormat string
+
+const (
+	ExportCSV  ExportFormat = "csv"
+	ExportXLSX ExportFormat = "xlsx"
+)
+
+// exportSheet is the worksheet XLSX exports are written to and imports read when present
+const exportSheet = "Sheet1"
+
+// ParseExportFormat accepts a format name or a file name with a .csv or .xlsx extension
+func ParseExportFormat(value string) (ExportFormat, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if i := strings.LastIndex(value, "."); i >= 0 {
+		value = value[i+1:]
+	}
+	switch ExportFormat(value) {
+	case ExportCSV, ExportXLSX:
+		return ExportFormat(value), nil
+	}
+	return "", echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unsupported spreadsheet format: %s", value))
+}
+
+// ContentType returns the MIME type of the format
+func (f ExportFormat) ContentType() string {
+	if f == ExportXLSX {
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// Export implements Repository.
+func (c *CollectionManager[TData, TResponse, TRequest]) Export(ctx context.Context, w io.Writer, format ExportFormat, query *PageQuery, preloads ...string) error {
+	columns := spreadsheetColumns(reflect.TypeFor[TResponse]())
+	if len(columns) == 0 {
+		return eris.Errorf("%s has no exportable fields", reflect.TypeFor[TResponse]())
+	}
+	writer, err := newRowWriter(w, format)
+	if err != nil {
+		return err
+	}
+	if err := c.exportRows(ctx, writer, columns, query, preloads); err != nil {
+		writer.Discard()
+		return err
+	}
+	return writer.Close()
+}
+
+// exportRows writes the header and pages through the query by cursor, flushing each page
+func (c *CollectionManager[TData, TResponse, TRequest]) exportRows(ctx context.Context, writer rowWriter, columns []spreadsheetColumn, query *PageQuery, preloads []string) error {
+	header := make([]any, len(columns))
+	for i, column := range columns {
+		header[i] = column.name
+	}
+	if err := writer.WriteRow(header); err != nil {
+		return err
+	}
+
+	page := PageQuery{Size: MaxPageSize}
+	if query != nil {
+		page.Sort, page.Filters = query.Sort, query.Filters
+	}
+	for {
+		result, err := c.Paginate(ctx, &page, preloads...)
+		if err != nil {
+			return err
+		}
+		for _, model := range c.ToModels(result.Items) {
+			v := reflect.ValueOf(model).Elem()
+			row := make([]any, len(columns))
+			for i, column := range columns {
+				row[i] = exportValue(v.FieldByIndex(column.index))
+			}
+			if err := writer.WriteRow(row); err != nil {
+				return err
+			}
+		}
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+		if result.NextCursor == "" {
+			return nil
+		}
+		page.Cursor = result.NextCursor
+	}
+}
+
+// spreadsheetColumn is a scalar struct field addressed by its json name
+type spreadsheetColumn struct {
+	name  string
+	field string
+	index []int
+}
+
+// spreadsheetColumns lists the exported scalar fields of t that are not hidden
+// from json. Nested structs, slices and maps are left out.
+func spreadsheetColumns(t reflect.Type) []spreadsheetColumn {
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	var columns []spreadsheetColumn
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() || field.Anonymous {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if !isSpreadsheetScalar(field.Type) {
+			continue
+		}
+		columns = append(columns, spreadsheetColumn{name: name, field: field.Name, index: field.Index})
+	}
+	return columns
+}
+
+func isSpreadsheetScalar(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == reflect.TypeFor[time.Time]() || t.Implements(reflect.TypeFor[fmt.Stringer]()) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// exportValue converts a field to a cell value: nil, a string, a number or a bool
+func exportValue(v reflect.Value) any {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	switch value := v.Interface().(type) {
+	case time.Time:
+		if value.IsZero() {
+			return nil
+		}
+		return value.UTC().Format(time.RFC3339)
+	case fmt.Stringer:
+		return value.String()
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint()
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	}
+	return v.String()
+}
+
+// formulaPrefixes are the leading characters that make a spreadsheet application
+// evaluate a cell as a formula
+const formulaPrefixes = "=+-@\t\r"
+
+// spreadsheetText prefixes a string that would be evaluated as a formula with a
+// quote, so that it is shown as text. Other values are returned as they are.
+func spreadsheetText(value any) any {
+	text, ok := value.(string)
+	if !ok || text == "" || !strings.ContainsRune(formulaPrefixes, rune(text[0])) {
+		return value
+	}
+	return "'" + text
+}
+
+// rowWriter writes spreadsheet rows to an io.Writer
+type rowWriter interface {
+	WriteRow(values []any) error
+
+	// Flush hands the rows written so far to the underlying writer where the format allows it
+	Flush() error
+
+	// Close completes the file
+	Close() error
+
+	// Discard releases the resources of an export that failed
+	Discard()
+}
+
+func newRowWriter(w io.Writer, format ExportFormat) (rowWriter, error) {
+	switch format {
+	case ExportCSV:
+		return &csvRowWriter{w: w, csv: csv.NewWriter(w)}, nil
+	case ExportXLSX:
+		file := excelize.NewFile()
+		stream, err := file.NewStreamWriter(exportSheet)
+		if err != nil {
+			return nil, eris.Wrap(err, "failed to start xlsx export")
+		}
+		return &xlsxRowWriter{w: w, file: file, stream: stream}, nil
+	}
+	return nil, eris.Errorf("unsupported spreadsheet format: %s", format)
+}
+
+type csvRowWriter struct {
+	w   io.Writer
+	csv *csv.Writer
+}
+
+func (c *csvRowWriter) WriteRow(values []any) error {
+	record := make([]string, len(values))
+	for i, value := range values {
+		if value != nil {
+			record[i] = fmt.Sprint(spreadsheetText(value))
+		}
+	}
+	if err := c.csv.Write(record); err != nil {
+		return eris.Wrap(err, "failed to write csv row")
+	}
+	return nil
+}
+
+func (c *csvRowWriter) Flush() error {
+	c.csv.Flush()
+	if err := c.csv.Error(); err != nil {
+		return eris.Wrap(err, "failed to flush csv rows")
+	}
+	if flusher, ok := c.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
+func (c *csvRowWriter) Close() error {
+	return c.Flush()
+}
+
+func (c *csvRowWriter) Discard() {}
+
+// xlsxRowWriter streams rows into a worksheet buffered by excelize, which spills
+// to a temporary file for large exports. The workbook is written out on Close.
+type xlsxRowWriter struct {
+	w      io.Writer
+	file   *excelize.File
+	stream *excelize.StreamWriter
+	row    int
+}
+
+func (x *xlsxRowWriter) WriteRow(values []any) error {
+	x.row++
+	cell, err := excelize.CoordinatesToCellName(1, x.row)
+	if err != nil {
+		return eris.Wrap(err, "failed to address xlsx row")
+	}
+	cells := make([]any, len(values))
+	for i, value := range values {
+		cells[i] = spreadsheetText(value)
+	}
+	if err := x.stream.SetRow(cell, cells); err != nil {
+		return eris.Wrapf(err, "failed to write xlsx row %d", x.row)
+	}
+	return nil
+}
+
+func (x *xlsxRowWriter) Flush() error {
+	return nil
+}
+
+func (x *xlsxRowWriter) Discard() {
+	_ = x.file.Close()
+}
+
+func (x *xlsxRowWriter) Close() error {
+	defer x.file.Close()
+	if err := x.stream.Flush(); err != nil {
+		return eris.Wrap(err, "failed to complete xlsx worksheet")
+	}
+	if err := x.file.Write(x.w); err != nil {
+		return eris.Wrap(err, "failed to write xlsx export")
+	}
+	return nil
+}
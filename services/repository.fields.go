@@ -0,0 +1,178 @@
+package horizon_services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+/*
+GET /media?fields=id,file_name,status
+
+GET /media/:media_id?fields=id,download_url
+*/
+
+// Fields is a sparse fieldset: the json names of the TResponse fields a caller
+// asked for with ?fields=. An empty Fields stands for every field.
+type Fields []string
+
+// Has reports whether name was requested
+func (f Fields) Has(name string) bool {
+	return len(f) == 0 || slices.Contains(f, name)
+}
+
+// splitList splits a comma separated query parameter, dropping blanks and duplicates
+func splitList(raw string) []string {
+	var names []string
+	for _, name := range strings.Split(raw, ",") {
+		if name = strings.TrimSpace(name); name != "" && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Fieldset implements Repository.
+func (c *CollectionManager[TData, TResponse, TRequest]) Fieldset(ctx echo.Context) (Fields, error) {
+	fields := Fields(splitList(ctx.QueryParam("fields")))
+	if err := c.checkFields(fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// Sparse implements Repository.
+func (c *CollectionManager[TData, TResponse, TRequest]) Sparse(data *TData, fields Fields) map[string]any {
+	if data == nil {
+		return nil
+	}
+	response := c.resource(data)
+	for name, compute := range c.computed {
+		if fields.Has(name) {
+			compute(data, response)
+		}
+	}
+	encoded, err := json.Marshal(response)
+	if err != nil {
+		return nil
+	}
+	var values map[string]any
+	if err := json.Unmarshal(encoded, &values); err != nil {
+		return nil
+	}
+	if len(fields) > 0 {
+		for name := range values {
+			if !fields.Has(name) {
+				delete(values, name)
+			}
+		}
+	}
+	return values
+}
+
+// SparsePage implements Repository.
+func (c *CollectionManager[TData, TResponse, TRequest]) SparsePage(result *PageResult[TData], fields Fields) *PageResult[map[string]any] {
+	items := make([]*map[string]any, len(result.Items))
+	for i, item := range result.Items {
+		values := c.Sparse(item, fields)
+		items[i] = &values
+	}
+	return &PageResult[map[string]any]{
+		Items:      items,
+		Total:      result.Total,
+		Page:       result.Page,
+		Size:       result.Size,
+		NextCursor: result.NextCursor,
+	}
+}
+
+// checkFields rejects names that are not json fields of TResponse
+func (c *CollectionManager[TData, TResponse, TRequest]) checkFields(fields Fields) error {
+	known := responseFields[TResponse]()
+	for _, name := range fields {
+		if _, ok := known[name]; !ok {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown field: %s", name))
+		}
+	}
+	return nil
+}
+
+// selectFields limits db to the columns backing fields, plus the keys, version,
+// tenant, sort and foreign key columns the repository relies on. Every column is
+// selected when a requested field has no column of its own, such as a computed
+// field or a relation.
+func (c *CollectionManager[TData, TResponse, TRequest]) selectFields(db *gorm.DB, fields Fields, sorts []Sort) (*gorm.DB, error) {
+	if len(fields) == 0 {
+		return db, nil
+	}
+	s, err := c.schema(db)
+	if err != nil {
+		return nil, err
+	}
+	known := responseFields[TResponse]()
+	var columns []string
+	add := func(field *schema.Field) {
+		if field != nil && field.DBName != "" && !slices.Contains(columns, field.DBName) {
+			columns = append(columns, field.DBName)
+		}
+	}
+	for _, name := range fields {
+		field := s.LookUpField(name)
+		if field == nil || field.DBName == "" {
+			field = s.LookUpField(known[name])
+		}
+		if field == nil || field.DBName == "" {
+			return db, nil
+		}
+		add(field)
+	}
+	for _, field := range s.PrimaryFields {
+		add(field)
+	}
+	for _, name := range []string{VersionColumn, "updated_at", OrganizationColumn, BranchColumn} {
+		add(s.LookUpField(name))
+	}
+	for _, sort := range sorts {
+		add(s.LookUpField(sort.Field))
+	}
+	for _, relation := range s.Relationships.Relations {
+		if relation.Type != schema.BelongsTo {
+			continue
+		}
+		for _, reference := range relation.References {
+			add(reference.ForeignKey)
+		}
+	}
+	return db.Select(columns), nil
+}
+
+// responseFields maps the json names of the fields of TResponse to their Go names
+func responseFields[TResponse any]() map[string]string {
+	t := reflect.TypeFor[TResponse]()
+	fields := map[string]string{}
+	if t.Kind() != reflect.Struct {
+		return fields
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field.Name
+	}
+	return fields
+}
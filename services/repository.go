@@ -2,14 +2,18 @@ package horizon_services
 
 import (
 	"context"
+	"io"
 	"net/http"
 	"reflect"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"github.com/lands-horizon/horizon-server/services/horizon"
 	"github.com/rotisserie/eris"
 	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
 )
 
 type Repository[TData any, TResponse any, TRequest any] interface {
@@ -17,12 +21,23 @@ type Repository[TData any, TResponse any, TRequest any] interface {
 	// Validate
 	Validate(ctx echo.Context) (*TRequest, error)
 
-	// Models
+	// ToModel converts data to its TResponse without the Computed fields, which
+	// only Sparse fills when they are asked for
 	ToModel(data *TData) *TResponse
 
 	// Convert data to anything
 	ToModels(data []*TData) []*TResponse
 
+	// Includes resolves the whitelisted relations named by ?include= to preloads.
+	Includes(ctx echo.Context) ([]string, error)
+
+	// Fieldset parses and validates the ?fields= sparse fieldset against the json fields of TResponse.
+	Fieldset(ctx echo.Context) (Fields, error)
+
+	// Sparse converts data to the requested fields of its TResponse, computing only those.
+	Sparse(data *TData, fields Fields) map[string]any
+	SparsePage(result *PageResult[TData], fields Fields) *PageResult[map[string]any]
+
 	// --- Retrieval ---
 	// List retrieves all entities of type T, optionally with related entities specified in preloads.
 	List(ctx context.Context, preloads ...string) ([]*TData, error)
@@ -42,6 +57,54 @@ type Repository[TData any, TResponse any, TRequest any] interface {
 	FindOne(ctx context.Context, fields *TData, preloads ...string) (*TData, error)
 	FindOneRaw(ctx context.Context, fields *TData, preloads ...string) (*TResponse, error)
 
+	// --- Pagination ---
+
+	// Query parses page, size, cursor, sort and filter query parameters against the collection whitelist.
+	Query(ctx echo.Context) (*PageQuery, error)
+
+	// Paginate retrieves a single page of entities matching the query filters, with the total count.
+	// A query with a cursor continues from the previous page instead of using page offsets.
+	Paginate(ctx context.Context, query *PageQuery, preloads ...string) (*PageResult[TData], error)
+	PaginateRaw(ctx context.Context, query *PageQuery, preloads ...string) (*PageResult[TResponse], error)
+
+	// --- Search ---
+
+	// Search retrieves a page of entities whose searchable columns match text, best matches first.
+	// An explicit sort or cursor in the query takes precedence over ranking; empty text behaves like Paginate.
+	Search(ctx context.Context, text string, query *PageQuery, preloads ...string) (*PageResult[TData], error)
+	SearchRaw(ctx context.Context, text string, query *PageQuery, preloads ...string) (*PageResult[TResponse], error)
+
+	// Migrate creates or refreshes the full-text search column and index of the collection.
+	Migrate(ctx context.Context) error
+
+	// --- Export ---
+
+	// Export streams every entity matching the query filters and sort to w as CSV or XLSX, with
+	// one column per scalar field of TResponse headed by its json name.
+	Export(ctx context.Context, w io.Writer, format ExportFormat, query *PageQuery, preloads ...string) error
+
+	// Import reads a CSV or XLSX file whose header row names TRequest json fields, validates each
+	// row and creates the valid ones in batches. Rejected rows are reported in the result.
+	// Requires Entity in RepositoryParams.
+	Import(ctx context.Context, r io.Reader, format ExportFormat) (*ImportResult, error)
+
+	// --- Audit ---
+
+	// History returns the recorded changes of an entity, newest first. Requires Audit in RepositoryParams.
+	History(ctx context.Context, id uuid.UUID) ([]*AuditLog, error)
+
+	// RegisterHistoryRoute registers a GET route that returns the History of the entity in idParam.
+	RegisterHistoryRoute(route string, idParam string, m ...echo.MiddlewareFunc)
+
+	// --- Concurrency ---
+
+	// ETag returns the entity tag of the entity, derived from its version column or updated_at.
+	ETag(entity *TData) string
+
+	// Precondition checks the If-Match request header against the entity and returns a *ConflictError on mismatch.
+	// Updates of entities with a version column fail with a *ConflictError when the stored version has moved on.
+	Precondition(ctx echo.Context, entity *TData) error
+
 	// --- Aggregation ---
 
 	// Count returns the number of records matching the given fields.
@@ -85,7 +148,15 @@ type Repository[TData any, TResponse any, TRequest any] interface {
 	// UpdateFieldsWithTx performs UpdateFields within the provided transaction.
 	UpdateFieldsWithTx(ctx context.Context, tx *gorm.DB, id uuid.UUID, fields *TData, preloads ...string) error
 
-	// UpdateMany performs a batch update on multiple entities.
+	// UpdateFieldsByIDs applies the non-zero fields to every entity with the given UUIDs
+	// using one UPDATE ... WHERE id IN per batch.
+	UpdateFieldsByIDs(ctx context.Context, ids []uuid.UUID, fields *TData, preloads ...string) error
+
+	// UpdateFieldsByIDsWithTx performs UpdateFieldsByIDs within the provided transaction.
+	UpdateFieldsByIDsWithTx(ctx context.Context, tx *gorm.DB, ids []uuid.UUID, fields *TData, preloads ...string) error
+
+	// UpdateMany performs a batch update on multiple entities. It returns
+	// ErrDuplicateID when an ID is given more than once.
 	UpdateMany(ctx context.Context, entities []*TData, preloads ...string) error
 
 	// UpdateManyWithTx performs UpdateMany within the provided transaction.
@@ -99,7 +170,8 @@ type Repository[TData any, TResponse any, TRequest any] interface {
 	// UpsertWithTx performs Upsert within the provided transaction.
 	UpsertWithTx(ctx context.Context, tx *gorm.DB, entity *TData, preloads ...string) error
 
-	// UpsertMany performs batch upsert for multiple entities.
+	// UpsertMany performs batch upsert for multiple entities. It returns
+	// ErrDuplicateID when an ID is given more than once.
 	UpsertMany(ctx context.Context, entities []*TData, preloads ...string) error
 
 	// UpsertManyWithTx performs UpsertMany within the provided transaction.
@@ -124,16 +196,96 @@ type Repository[TData any, TResponse any, TRequest any] interface {
 
 	// DeleteManyWithTx performs DeleteMany within the provided transaction.
 	DeleteManyWithTx(ctx context.Context, tx *gorm.DB, entities []*TData) error
+
+	// --- Trash ---
+
+	// ListDeleted returns a page of soft-deleted entities
+	ListDeleted(ctx context.Context, query *PageQuery, preloads ...string) (*PageResult[TData], error)
+
+	// Restore brings back a soft-deleted entity and reloads it
+	Restore(ctx context.Context, entity *TData, preloads ...string) error
+
+	// RestoreWithTx performs Restore within the provided transaction.
+	RestoreWithTx(ctx context.Context, tx *gorm.DB, entity *TData, preloads ...string) error
+
+	// RestoreByID brings back the soft-deleted entity with the given UUID.
+	RestoreByID(ctx context.Context, id uuid.UUID) error
+
+	// RestoreByIDWithTx performs RestoreByID within the provided transaction.
+	RestoreByIDWithTx(ctx context.Context, tx *gorm.DB, id uuid.UUID) error
+
+	// ForceDelete permanently removes the entity, whether or not it is soft-deleted.
+	ForceDelete(ctx context.Context, entity *TData) error
+
+	// ForceDeleteWithTx performs ForceDelete within the provided transaction.
+	ForceDeleteWithTx(ctx context.Context, tx *gorm.DB, entity *TData) error
+
+	// PurgeDeleted permanently removes entities soft-deleted longer than retention ago
+	// and returns how many were removed.
+	PurgeDeleted(ctx context.Context, retention time.Duration) (int64, error)
 }
 
 // RepositoryParams groups the constructor parameters for NewRepository
 type RepositoryParams[TData any, TResponse any, TRequest any] struct {
-	Service  *HorizonService
+	Service *HorizonService
+
+	// Created, Updated and Deleted are the broadcast topics of the writes. Tenant
+	// scoped repositories should wrap them with TenantTopics so that only clients
+	// of the tenant may follow them.
 	Created  func(*TData) []string
 	Updated  func(*TData) []string
 	Deleted  func(*TData) []string
 	Resource func(*TData) *TResponse
 	Preloads []string
+
+	// Computed fills expensive TResponse fields, keyed by json name, after Resource.
+	// Only Sparse runs them, for the requested fields; ToModel and broadcasts skip them.
+	Computed map[string]func(data *TData, response *TResponse)
+
+	// Entity builds a new entity from a validated request, for Import
+	Entity func(*TRequest) (*TData, error)
+
+	// Restored and ForceDeleted are the broadcast topics of Restore and ForceDelete
+	Restored     func(*TData) []string
+	ForceDeleted func(*TData) []string
+
+	// EventVersion is the schema version of the broadcast payloads, carried by
+	// their envelopes; defaults to 1
+	EventVersion int
+
+	// Retention schedules PurgeDeleted on PurgeSchedule (default "@daily") when positive
+	Retention     time.Duration
+	PurgeSchedule string
+
+	// Sortable and Filterable whitelist the columns accepted by Query
+	Sortable   []string
+	Filterable []string
+
+	// Includable whitelists the relations accepted by ?include=, named in snake case
+	// and dotted when nested, e.g. "media" or "media.owner"
+	Includable []string
+
+	// Searchable lists the columns indexed for Search, most relevant first, using the
+	// SearchLanguage text search configuration (default DefaultSearchLanguage)
+	Searchable     []string
+	SearchLanguage string
+
+	// Cache wraps the repository in a read-through CachedRepository when set
+	Cache *CacheParams
+
+	// BatchSize is the number of rows written per statement and broadcast by bulk
+	// operations; defaults to DefaultBatchSize
+	BatchSize int
+
+	// Audit records actor, action and a column diff of every create, update and delete
+	Audit bool
+
+	// AuditRedact lists the columns, such as personal data, whose values audit logs
+	// replace with AuditRedacted. Their changes are still recorded.
+	AuditRedact []string
+
+	// Hooks run before and after creates, updates, deletes and upserts within their transaction
+	Hooks Hooks[TData]
 }
 
 // CollectionManager is a generic implementation of Repository
@@ -144,18 +296,70 @@ type CollectionManager[TData any, TResponse any, TRequest any] struct {
 	deleted  func(*TData) []string
 	resource func(*TData) *TResponse
 	preloads []string
+	entity   func(*TRequest) (*TData, error)
+	computed map[string]func(*TData, *TResponse)
+
+	restored     func(*TData) []string
+	forceDeleted func(*TData) []string
+	eventVersion int
+
+	sortable   []string
+	filterable []string
+	includable []string
+	auditing   bool
+	redacted   []string
+	batchSize  int
+
+	searchable     []string
+	searchLanguage string
+
+	hooks Hooks[TData]
 }
 
 // NewRepository creates a new CollectionManager instance with the given parameters
 func NewRepository[TData any, TResponse any, TRequest any](params RepositoryParams[TData, TResponse, TRequest]) Repository[TData, TResponse, TRequest] {
-	return &CollectionManager[TData, TResponse, TRequest]{
+	manager := &CollectionManager[TData, TResponse, TRequest]{
 		service:  params.Service,
 		created:  params.Created,
 		updated:  params.Updated,
 		deleted:  params.Deleted,
 		resource: params.Resource,
 		preloads: params.Preloads,
+		entity:   params.Entity,
+		computed: params.Computed,
+
+		sortable:   params.Sortable,
+		filterable: params.Filterable,
+		includable: params.Includable,
+		auditing:   params.Audit,
+		redacted:   params.AuditRedact,
+		batchSize:  params.BatchSize,
+
+		restored:     params.Restored,
+		forceDeleted: params.ForceDeleted,
+		eventVersion: max(params.EventVersion, 1),
+
+		searchable:     params.Searchable,
+		searchLanguage: params.SearchLanguage,
+
+		hooks: params.Hooks,
+	}
+	if manager.searchLanguage == "" {
+		manager.searchLanguage = DefaultSearchLanguage
+	}
+	if manager.auditing && manager.service != nil {
+		manager.service.auditing = true
+	}
+	if manager.batchSize <= 0 {
+		manager.batchSize = DefaultBatchSize
 	}
+	if params.Retention > 0 {
+		manager.schedulePurge(params.Retention, params.PurgeSchedule)
+	}
+	if params.Cache != nil && params.Service != nil && params.Service.Cache != nil {
+		return NewCachedRepository(manager, params.Service, *params.Cache)
+	}
+	return manager
 }
 
 // ToModel implements Repository.
@@ -194,8 +398,12 @@ func (c *CollectionManager[TData, TResponse, TRequest]) Validate(ctx echo.Contex
 
 // Count implements Repository.
 func (c *CollectionManager[TData, TResponse, TRequest]) Count(ctx context.Context, fields *TData) (int64, error) {
+	db, err := c.session(ctx, c.client(ctx))
+	if err != nil {
+		return 0, err
+	}
 	var count int64
-	if err := c.service.Database.Client().Model(fields).Where(fields).Count(&count).Error; err != nil {
+	if err := db.Model(fields).Where(fields).Count(&count).Error; err != nil {
 		return 0, eris.Wrap(err, "failed to count entities")
 	}
 	return count, nil
@@ -203,6 +411,10 @@ func (c *CollectionManager[TData, TResponse, TRequest]) Count(ctx context.Contex
 
 // CountWithTx implements Repository.
 func (c *CollectionManager[TData, TResponse, TRequest]) CountWithTx(ctx context.Context, tx *gorm.DB, fields *TData) (int64, error) {
+	tx, err := c.session(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
 	var count int64
 	if err := tx.Model(fields).Where(fields).Count(&count).Error; err != nil {
 		return 0, eris.Wrap(err, "failed to count entities in transaction")
@@ -212,102 +424,46 @@ func (c *CollectionManager[TData, TResponse, TRequest]) CountWithTx(ctx context.
 
 // Create implements Repository.
 func (c *CollectionManager[TData, TResponse, TRequest]) Create(ctx context.Context, entity *TData, preloads ...string) error {
-	if err := c.service.Database.Client().Create(entity).Error; err != nil {
-		return eris.Wrap(err, "failed to create entity")
-	}
-	preloads = horizon.MergeString(c.preloads, preloads)
-	if len(preloads) > 0 {
-		id, err := getID(entity)
-		if err != nil {
-			return eris.Wrap(err, "failed to get entity ID for preload")
-		}
-		db := c.service.Database.Client().Model(entity)
-		for _, preload := range preloads {
-			db = db.Preload(preload)
-		}
-		if err := db.First(entity, "id = ?", id).Error; err != nil {
-			return eris.Wrap(err, "failed to reload entity with preloads")
-		}
-	}
-	c.CreatedBroadcast(ctx, entity)
-	return nil
+	return c.transaction(ctx, func(tx *gorm.DB) error {
+		return c.CreateWithTx(ctx, tx, entity, preloads...)
+	})
 }
 
 // CreateMany implements Repository.
 func (c *CollectionManager[TData, TResponse, TRequest]) CreateMany(ctx context.Context, entities []*TData, preloads ...string) error {
-	if err := c.service.Database.Client().Create(entities).Error; err != nil {
-		return eris.Wrap(err, "failed to create entities")
-	}
-	preloads = horizon.MergeString(c.preloads, preloads)
-	if len(preloads) > 0 {
-		ids := make([]uuid.UUID, len(entities))
-		for i, entity := range entities {
-			id, err := getID(entity)
-			if err != nil {
-				return eris.Wrap(err, "failed to get ID for entity")
-			}
-			ids[i] = id
-		}
-		var reloaded []*TData
-		db := c.service.Database.Client().Model(new(TData))
-		for _, preload := range preloads {
-			db = db.Preload(preload)
-		}
-		if err := db.Where("id IN (?)", ids).Find(&reloaded).Error; err != nil {
-			return eris.Wrap(err, "failed to reload entities with preloads")
-		}
-		reloadedMap := make(map[uuid.UUID]*TData)
-		for _, e := range reloaded {
-			id, _ := getID(e)
-			reloadedMap[id] = e
-		}
-		for _, entity := range entities {
-			id, _ := getID(entity)
-			if reloadedEntity, ok := reloadedMap[id]; ok {
-				*entity = *reloadedEntity
-			} else {
-				return eris.Errorf("failed to find reloaded entity with ID %s", id)
-			}
-		}
-	}
-	return nil
+	return c.transaction(ctx, func(tx *gorm.DB) error {
+		return c.CreateManyWithTx(ctx, tx, entities, preloads...)
+	})
 }
 
 // CreateManyWithTx implements Repository.
 func (c *CollectionManager[TData, TResponse, TRequest]) CreateManyWithTx(ctx context.Context, tx *gorm.DB, entities []*TData, preloads ...string) error {
-	if err := tx.Create(entities).Error; err != nil {
+	tx, err := c.session(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if err := c.hooks.BeforeCreate.run(ctx, tx, entities...); err != nil {
+		return err
+	}
+	if err := c.stampTenant(ctx, entities...); err != nil {
+		return err
+	}
+	if err := tx.CreateInBatches(entities, c.batchSize).Error; err != nil {
 		return eris.Wrap(err, "failed to create entities in transaction")
 	}
 	preloads = horizon.MergeString(c.preloads, preloads)
-	if len(preloads) > 0 {
-		ids := make([]uuid.UUID, len(entities))
-		for i, entity := range entities {
-			id, err := getID(entity)
-			if err != nil {
-				return eris.Wrap(err, "failed to get ID for entity in transaction")
-			}
-			ids[i] = id
-		}
-		var reloaded []*TData
-		db := tx.Model(new(TData))
-		for _, preload := range preloads {
-			db = db.Preload(preload)
+	for _, batch := range chunk(entities, c.batchSize) {
+		if err := c.reloadMany(tx, batch, preloads, false); err != nil {
+			return err
 		}
-		if err := db.Where("id IN (?)", ids).Find(&reloaded).Error; err != nil {
-			return eris.Wrap(err, "failed to reload entities with preloads in transaction")
+		if err := c.hooks.AfterCreate.run(ctx, tx, batch...); err != nil {
+			return err
 		}
-		reloadedMap := make(map[uuid.UUID]*TData)
-		for _, e := range reloaded {
-			id, _ := getID(e)
-			reloadedMap[id] = e
+		if err := c.auditMany(ctx, tx, AuditCreate, nil, batch); err != nil {
+			return err
 		}
-		for _, entity := range entities {
-			id, _ := getID(entity)
-			if reloadedEntity, ok := reloadedMap[id]; ok {
-				*entity = *reloadedEntity
-			} else {
-				return eris.Errorf("failed to find reloaded entity with ID %s in transaction", id)
-			}
+		if err := c.broadcastMany(ctx, tx, EventCreated, c.created, batch); err != nil {
+			return err
 		}
 	}
 	return nil
@@ -315,6 +471,16 @@ func (c *CollectionManager[TData, TResponse, TRequest]) CreateManyWithTx(ctx con
 
 // CreateWithTx implements Repository.
 func (c *CollectionManager[TData, TResponse, TRequest]) CreateWithTx(ctx context.Context, tx *gorm.DB, entity *TData, preloads ...string) error {
+	tx, err := c.session(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if err := c.hooks.BeforeCreate.run(ctx, tx, entity); err != nil {
+		return err
+	}
+	if err := c.stampTenant(ctx, entity); err != nil {
+		return err
+	}
 	if err := tx.Create(entity).Error; err != nil {
 		return eris.Wrap(err, "failed to create entity in transaction")
 	}
@@ -332,81 +498,116 @@ func (c *CollectionManager[TData, TResponse, TRequest]) CreateWithTx(ctx context
 			return eris.Wrap(err, "failed to reload entity with preloads in transaction")
 		}
 	}
+	if err := c.hooks.AfterCreate.run(ctx, tx, entity); err != nil {
+		return err
+	}
+	if err := c.audit(ctx, tx, AuditCreate, nil, entity); err != nil {
+		return err
+	}
+	if err := c.CreatedBroadcast(ctx, tx, entity); err != nil {
+		return err
+	}
 	return nil
 }
 
 // Delete implements Repository.
 func (c *CollectionManager[TData, TResponse, TRequest]) Delete(ctx context.Context, entity *TData) error {
-	if err := c.service.Database.Client().Delete(entity).Error; err != nil {
-		return eris.Wrap(err, "failed to delete entity")
-	}
-	c.DeletedBroadcast(ctx, entity)
-	return nil
+	return c.transaction(ctx, func(tx *gorm.DB) error {
+		return c.DeleteWithTx(ctx, tx, entity)
+	})
 }
 
 // DeleteByID implements Repository.
 func (c *CollectionManager[TData, TResponse, TRequest]) DeleteByID(ctx context.Context, id uuid.UUID) error {
-	entity := new(TData)
-
-	if err := c.service.Database.Client().First(entity, "id = ?", id).Error; err != nil {
-		return eris.Wrapf(err, "failed to load entity with id %s before deletion", id)
-	}
-
-	if err := c.service.Database.Client().Delete(entity).Error; err != nil {
-		return eris.Wrapf(err, "failed to delete entity with id %s", id)
-	}
-
-	c.DeletedBroadcast(ctx, entity)
-	return nil
-
+	return c.transaction(ctx, func(tx *gorm.DB) error {
+		return c.DeleteByIDWithTx(ctx, tx, id)
+	})
 }
 
 // DeleteByIDWithTx implements Repository.
 func (c *CollectionManager[TData, TResponse, TRequest]) DeleteByIDWithTx(ctx context.Context, tx *gorm.DB, id uuid.UUID) error {
+	tx, err := c.session(ctx, tx)
+	if err != nil {
+		return err
+	}
 	entity := new(TData)
 	if err := tx.First(entity, "id = ?", id).Error; err != nil {
 		return eris.Wrapf(err, "failed to load entity with id %s before deletion in transaction", id)
 	}
-	if err := tx.Delete(entity).Error; err != nil {
+	if err := c.hooks.BeforeDelete.run(ctx, tx, entity); err != nil {
+		return err
+	}
+	if err := c.deleteVersioned(ctx, tx, entity); err != nil {
 		return eris.Wrapf(err, "failed to delete entity with id %s in transaction", id)
 	}
-	c.DeletedBroadcast(ctx, entity)
+	if err := c.hooks.AfterDelete.run(ctx, tx, entity); err != nil {
+		return err
+	}
+	if err := c.audit(ctx, tx, AuditDelete, entity, nil); err != nil {
+		return err
+	}
+	if err := c.DeletedBroadcast(ctx, tx, entity); err != nil {
+		return err
+	}
 	return nil
 }
 
 // DeleteMany implements Repository.
 func (c *CollectionManager[TData, TResponse, TRequest]) DeleteMany(ctx context.Context, entities []*TData) error {
-	for _, entity := range entities {
-		if err := c.Delete(ctx, entity); err != nil {
-			return eris.Wrapf(err, "failed to delete entity: %+v", entity)
-		}
-	}
-	return nil
+	return c.transaction(ctx, func(tx *gorm.DB) error {
+		return c.DeleteManyWithTx(ctx, tx, entities)
+	})
 }
 
 // DeleteManyWithTx implements Repository.
 func (c *CollectionManager[TData, TResponse, TRequest]) DeleteManyWithTx(ctx context.Context, tx *gorm.DB, entities []*TData) error {
-	for _, entity := range entities {
-		if err := c.DeleteWithTx(ctx, tx, entity); err != nil {
-			return err
-		}
+	tx, err := c.session(ctx, tx)
+	if err != nil {
+		return err
 	}
-	return nil
+	return c.deleteMany(ctx, tx, entities)
 }
 
 // DeleteWithTx implements Repository.
 func (c *CollectionManager[TData, TResponse, TRequest]) DeleteWithTx(ctx context.Context, tx *gorm.DB, entity *TData) error {
-	if err := tx.Delete(entity).Error; err != nil {
+	tx, err := c.session(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if err := c.hooks.BeforeDelete.run(ctx, tx, entity); err != nil {
+		return err
+	}
+	id, err := getID(entity)
+	if err != nil {
+		return eris.Wrap(err, "failed to get entity ID for deletion in transaction")
+	}
+	before, err := c.auditSnapshot(tx, id)
+	if err != nil {
+		return err
+	}
+	if err := c.deleteVersioned(ctx, tx, entity); err != nil {
 		return eris.Wrap(err, "failed to delete entity in transaction")
 	}
-	c.DeletedBroadcast(ctx, entity)
+	if err := c.hooks.AfterDelete.run(ctx, tx, entity); err != nil {
+		return err
+	}
+	if err := c.audit(ctx, tx, AuditDelete, before, nil); err != nil {
+		return err
+	}
+	if err := c.DeletedBroadcast(ctx, tx, entity); err != nil {
+		return err
+	}
 	return nil
 }
 
 // Find implements Repository.
 func (c *CollectionManager[TData, TResponse, TRequest]) Find(ctx context.Context, fields *TData, preloads ...string) ([]*TData, error) {
 	var entities []*TData
-	db := c.service.Database.Client().Model(fields).Where(fields)
+	db, err := c.session(ctx, c.client(ctx))
+	if err != nil {
+		return nil, err
+	}
+	db = db.Model(fields).Where(fields)
 	preloads = horizon.MergeString(c.preloads, preloads)
 	for _, preload := range preloads {
 		db = db.Preload(preload)
@@ -420,7 +621,11 @@ func (c *CollectionManager[TData, TResponse, TRequest]) Find(ctx context.Context
 // FindOne implements Repository.
 func (c *CollectionManager[TData, TResponse, TRequest]) FindOne(ctx context.Context, fields *TData, preloads ...string) (*TData, error) {
 	var entity TData
-	db := c.service.Database.Client().Model(fields).Where(fields)
+	db, err := c.session(ctx, c.client(ctx))
+	if err != nil {
+		return nil, err
+	}
+	db = db.Model(fields).Where(fields)
 	preloads = horizon.MergeString(c.preloads, preloads)
 	for _, preload := range preloads {
 		db = db.Preload(preload)
@@ -452,7 +657,11 @@ func (c *CollectionManager[TData, TResponse, TRequest]) FindRaw(ctx context.Cont
 // GetByID implements Repository.
 func (c *CollectionManager[TData, TResponse, TRequest]) GetByID(ctx context.Context, id uuid.UUID, preloads ...string) (*TData, error) {
 	var entity TData
-	db := c.service.Database.Client().Model(new(TData))
+	db, err := c.session(ctx, c.client(ctx))
+	if err != nil {
+		return nil, err
+	}
+	db = db.Model(new(TData))
 	preloads = horizon.MergeString(c.preloads, preloads)
 	for _, preload := range preloads {
 		db = db.Preload(preload)
@@ -475,7 +684,11 @@ func (c *CollectionManager[TData, TResponse, TRequest]) GetByIDRaw(ctx context.C
 // List implements Repository.
 func (c *CollectionManager[TData, TResponse, TRequest]) List(ctx context.Context, preloads ...string) ([]*TData, error) {
 	var entities []*TData
-	db := c.service.Database.Client().Model(new(TData))
+	db, err := c.session(ctx, c.client(ctx))
+	if err != nil {
+		return nil, err
+	}
+	db = db.Model(new(TData))
 	preloads = horizon.MergeString(c.preloads, preloads)
 	for _, preload := range preloads {
 		db = db.Preload(preload)
@@ -497,55 +710,38 @@ func (c *CollectionManager[TData, TResponse, TRequest]) ListRaw(ctx context.Cont
 
 // Update implements Repository.
 func (c *CollectionManager[TData, TResponse, TRequest]) Update(ctx context.Context, entity *TData, preloads ...string) error {
-	if err := c.service.Database.Client().Save(entity).Error; err != nil {
-		return eris.Wrap(err, "failed to update entity")
-	}
-	preloads = horizon.MergeString(c.preloads, preloads)
-	if len(preloads) > 0 {
-		id, err := getID(entity)
-		if err != nil {
-			return eris.Wrap(err, "failed to get entity ID for preload after update")
-		}
-		db := c.service.Database.Client().Model(entity)
-		for _, preload := range preloads {
-			db = db.Preload(preload)
-		}
-		if err := db.First(entity, "id = ?", id).Error; err != nil {
-			return eris.Wrap(err, "failed to reload entity with preloads after update")
-		}
-	}
-	c.UpdatedBroadcast(ctx, entity)
-	return nil
+	return c.transaction(ctx, func(tx *gorm.DB) error {
+		return c.UpdateWithTx(ctx, tx, entity, preloads...)
+	})
 }
 
 // UpdateByID implements Repository.
 func (c *CollectionManager[TData, TResponse, TRequest]) UpdateByID(ctx context.Context, id uuid.UUID, entity *TData, preloads ...string) error {
-	if err := setID(entity, id); err != nil {
-		return eris.Wrap(err, "failed to set entity ID")
-	}
-	if err := c.service.Database.Client().Save(entity).Error; err != nil {
-		return eris.Wrap(err, "failed to update entity by ID")
-	}
-	preloads = horizon.MergeString(c.preloads, preloads)
-	if len(preloads) > 0 {
-		db := c.service.Database.Client().Model(entity)
-		for _, preload := range preloads {
-			db = db.Preload(preload)
-		}
-		if err := db.First(entity, "id = ?", id).Error; err != nil {
-			return eris.Wrap(err, "failed to reload entity after update by ID")
-		}
-	}
-	c.UpdatedBroadcast(ctx, entity)
-	return nil
+	return c.transaction(ctx, func(tx *gorm.DB) error {
+		return c.UpdateByIDWithTx(ctx, tx, id, entity, preloads...)
+	})
 }
 
 // UpdateByIDWithTx implements Repository.
 func (c *CollectionManager[TData, TResponse, TRequest]) UpdateByIDWithTx(ctx context.Context, tx *gorm.DB, id uuid.UUID, entity *TData, preloads ...string) error {
+	tx, err := c.session(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if err := c.hooks.BeforeUpdate.run(ctx, tx, entity); err != nil {
+		return err
+	}
+	if err := c.stampTenant(ctx, entity); err != nil {
+		return err
+	}
 	if err := setID(entity, id); err != nil {
 		return eris.Wrap(err, "failed to set entity ID in transaction")
 	}
-	if err := tx.Save(entity).Error; err != nil {
+	before, err := c.auditSnapshot(tx, id)
+	if err != nil {
+		return err
+	}
+	if err := c.save(ctx, tx, entity); err != nil {
 		return eris.Wrap(err, "failed to update entity by ID in transaction")
 	}
 	preloads = horizon.MergeString(c.preloads, preloads)
@@ -558,30 +754,42 @@ func (c *CollectionManager[TData, TResponse, TRequest]) UpdateByIDWithTx(ctx con
 			return eris.Wrap(err, "failed to reload entity after update by ID in transaction")
 		}
 	}
-	c.UpdatedBroadcast(ctx, entity)
+	if err := c.hooks.AfterUpdate.run(ctx, tx, entity); err != nil {
+		return err
+	}
+	if err := c.audit(ctx, tx, AuditUpdate, before, entity); err != nil {
+		return err
+	}
+	if err := c.UpdatedBroadcast(ctx, tx, entity); err != nil {
+		return err
+	}
 	return nil
 }
 
 // UpdateFields implements Repository.
 func (c *CollectionManager[TData, TResponse, TRequest]) UpdateFields(ctx context.Context, id uuid.UUID, fields *TData, preloads ...string) error {
-	if err := c.service.Database.Client().Model(new(TData)).Where("id = ?", id).Updates(fields).Error; err != nil {
-		return eris.Wrap(err, "failed to update fields")
-	}
-	preloads = horizon.MergeString(c.preloads, preloads)
-	db := c.service.Database.Client().Model(new(TData)).Where("id = ?", id)
-	for _, preload := range preloads {
-		db = db.Preload(preload)
-	}
-	if err := db.First(fields).Error; err != nil {
-		return eris.Wrap(err, "failed to reload entity after updating fields")
-	}
-	c.UpdatedBroadcast(ctx, fields)
-	return nil
+	return c.transaction(ctx, func(tx *gorm.DB) error {
+		return c.UpdateFieldsWithTx(ctx, tx, id, fields, preloads...)
+	})
 }
 
 // UpdateFieldsWithTx implements Repository.
 func (c *CollectionManager[TData, TResponse, TRequest]) UpdateFieldsWithTx(ctx context.Context, tx *gorm.DB, id uuid.UUID, fields *TData, preloads ...string) error {
-	if err := tx.Model(new(TData)).Where("id = ?", id).Updates(fields).Error; err != nil {
+	tx, err := c.session(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if err := c.hooks.BeforeUpdate.run(ctx, tx, fields); err != nil {
+		return err
+	}
+	if err := c.stampTenant(ctx, fields); err != nil {
+		return err
+	}
+	before, err := c.auditSnapshot(tx, id)
+	if err != nil {
+		return err
+	}
+	if err := c.updateFields(ctx, tx, id, fields); err != nil {
 		return eris.Wrap(err, "failed to update fields in transaction")
 	}
 	preloads = horizon.MergeString(c.preloads, preloads)
@@ -592,41 +800,68 @@ func (c *CollectionManager[TData, TResponse, TRequest]) UpdateFieldsWithTx(ctx c
 	if err := db.First(fields).Error; err != nil {
 		return eris.Wrap(err, "failed to reload entity after updating fields in transaction")
 	}
-	c.UpdatedBroadcast(ctx, fields)
+	if err := c.hooks.AfterUpdate.run(ctx, tx, fields); err != nil {
+		return err
+	}
+	if err := c.audit(ctx, tx, AuditUpdate, before, fields); err != nil {
+		return err
+	}
+	if err := c.UpdatedBroadcast(ctx, tx, fields); err != nil {
+		return err
+	}
 	return nil
 }
 
 // UpdateMany implements Repository.
 func (c *CollectionManager[TData, TResponse, TRequest]) UpdateMany(ctx context.Context, entities []*TData, preloads ...string) error {
-	for _, entity := range entities {
-		if err := c.Update(ctx, entity, preloads...); err != nil {
-			return err
-		}
-	}
-	return nil
+	return c.transaction(ctx, func(tx *gorm.DB) error {
+		return c.UpdateManyWithTx(ctx, tx, entities, preloads...)
+	})
 }
 
 // UpdateManyWithTx implements Repository.
 func (c *CollectionManager[TData, TResponse, TRequest]) UpdateManyWithTx(ctx context.Context, tx *gorm.DB, entities []*TData, preloads ...string) error {
-	for _, entity := range entities {
-		if err := c.UpdateWithTx(ctx, tx, entity, preloads...); err != nil {
-			return err
-		}
+	tx, err := c.session(ctx, tx)
+	if err != nil {
+		return err
 	}
-	return nil
+	if err := uniqueIDs(entities); err != nil {
+		return err
+	}
+	if err := c.hooks.BeforeUpdate.run(ctx, tx, entities...); err != nil {
+		return err
+	}
+	if err := c.stampTenant(ctx, entities...); err != nil {
+		return err
+	}
+	return c.updateMany(ctx, tx, entities, preloads)
 }
 
 // UpdateWithTx implements Repository.
 func (c *CollectionManager[TData, TResponse, TRequest]) UpdateWithTx(ctx context.Context, tx *gorm.DB, entity *TData, preloads ...string) error {
-	if err := tx.Save(entity).Error; err != nil {
+	tx, err := c.session(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if err := c.hooks.BeforeUpdate.run(ctx, tx, entity); err != nil {
+		return err
+	}
+	if err := c.stampTenant(ctx, entity); err != nil {
+		return err
+	}
+	id, err := getID(entity)
+	if err != nil {
+		return eris.Wrap(err, "failed to get entity ID for update in transaction")
+	}
+	before, err := c.auditSnapshot(tx, id)
+	if err != nil {
+		return err
+	}
+	if err := c.save(ctx, tx, entity); err != nil {
 		return eris.Wrap(err, "failed to update entity in transaction")
 	}
 	preloads = horizon.MergeString(c.preloads, preloads)
 	if len(preloads) > 0 {
-		id, err := getID(entity)
-		if err != nil {
-			return eris.Wrap(err, "failed to get entity ID for preload after update in transaction")
-		}
 		db := tx.Model(entity)
 		for _, preload := range preloads {
 			db = db.Preload(preload)
@@ -635,92 +870,160 @@ func (c *CollectionManager[TData, TResponse, TRequest]) UpdateWithTx(ctx context
 			return eris.Wrap(err, "failed to reload entity with preloads after update in transaction")
 		}
 	}
-	c.UpdatedBroadcast(ctx, entity)
+	if err := c.hooks.AfterUpdate.run(ctx, tx, entity); err != nil {
+		return err
+	}
+	if err := c.audit(ctx, tx, AuditUpdate, before, entity); err != nil {
+		return err
+	}
+	if err := c.UpdatedBroadcast(ctx, tx, entity); err != nil {
+		return err
+	}
 	return nil
 }
 
 // Upsert implements Repository.
 func (c *CollectionManager[TData, TResponse, TRequest]) Upsert(ctx context.Context, entity *TData, preloads ...string) error {
-	preloads = horizon.MergeString(c.preloads, preloads)
-	id, err := getID(entity)
-	if err != nil {
-		return eris.Wrap(err, "failed to get ID for upsert")
-	}
-	if id == uuid.Nil {
-		return c.Create(ctx, entity, preloads...)
-	}
-	var existing TData
-	if err := c.service.Database.Client().Where("id = ?", id).First(&existing).Error; err != nil {
-		if eris.Is(err, gorm.ErrRecordNotFound) {
-			return c.Create(ctx, entity, preloads...)
-		}
-		return eris.Wrap(err, "failed to check existing entity for upsert")
-	}
-	return c.Update(ctx, entity, preloads...)
+	return c.transaction(ctx, func(tx *gorm.DB) error {
+		return c.UpsertWithTx(ctx, tx, entity, preloads...)
+	})
 }
 
 // UpsertMany implements Repository.
 func (c *CollectionManager[TData, TResponse, TRequest]) UpsertMany(ctx context.Context, entities []*TData, preloads ...string) error {
-	for _, entity := range entities {
-		if err := c.Upsert(ctx, entity, preloads...); err != nil {
-			return err
-		}
-	}
-	return nil
+	return c.transaction(ctx, func(tx *gorm.DB) error {
+		return c.UpsertManyWithTx(ctx, tx, entities, preloads...)
+	})
 }
 
 // UpsertManyWithTx implements Repository.
 func (c *CollectionManager[TData, TResponse, TRequest]) UpsertManyWithTx(ctx context.Context, tx *gorm.DB, entities []*TData, preloads ...string) error {
-	for _, entity := range entities {
-		if err := c.UpsertWithTx(ctx, tx, entity, preloads...); err != nil {
-			return err
-		}
+	tx, err := c.session(ctx, tx)
+	if err != nil {
+		return err
 	}
-	return nil
+	if err := uniqueIDs(entities); err != nil {
+		return err
+	}
+	if err := c.hooks.BeforeUpsert.run(ctx, tx, entities...); err != nil {
+		return err
+	}
+	if err := c.stampTenant(ctx, entities...); err != nil {
+		return err
+	}
+	return c.upsertMany(ctx, tx, entities, preloads)
 }
 
 // UpsertWithTx implements Repository.
 func (c *CollectionManager[TData, TResponse, TRequest]) UpsertWithTx(ctx context.Context, tx *gorm.DB, entity *TData, preloads ...string) error {
+	tx, err := c.session(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if err := c.hooks.BeforeUpsert.run(ctx, tx, entity); err != nil {
+		return err
+	}
 	id, err := getID(entity)
 	if err != nil {
 		return eris.Wrap(err, "failed to get ID for upsert in transaction")
 	}
 	preloads = horizon.MergeString(c.preloads, preloads)
-	if id == uuid.Nil {
-		return c.CreateWithTx(ctx, tx, entity, preloads...)
-	}
-	var existing TData
-	if err := tx.Where("id = ?", id).First(&existing).Error; err != nil {
-		if eris.Is(err, gorm.ErrRecordNotFound) {
-			return c.CreateWithTx(ctx, tx, entity, preloads...)
+	exists := id != uuid.Nil
+	if exists {
+		var existing TData
+		if err := tx.Where("id = ?", id).First(&existing).Error; err != nil {
+			if !eris.Is(err, gorm.ErrRecordNotFound) {
+				return eris.Wrap(err, "failed to check existing entity for upsert in transaction")
+			}
+			exists = false
 		}
-		return eris.Wrap(err, "failed to check existing entity for upsert in transaction")
 	}
-	return c.UpdateWithTx(ctx, tx, entity, preloads...)
+	if exists {
+		err = c.UpdateWithTx(ctx, tx, entity, preloads...)
+	} else {
+		err = c.CreateWithTx(ctx, tx, entity, preloads...)
+	}
+	if err != nil {
+		return err
+	}
+	return c.hooks.AfterUpsert.run(ctx, tx, entity)
+}
+
+// CreatedBroadcast enqueues the created topics in the outbox using the given transaction.
+func (c *CollectionManager[TData, TResponse, TRequest]) CreatedBroadcast(ctx context.Context, tx *gorm.DB, entity *TData) error {
+	return c.broadcast(ctx, tx, EventCreated, c.created, entity)
+}
+
+// DeletedBroadcast enqueues the deleted topics in the outbox using the given transaction.
+func (c *CollectionManager[TData, TResponse, TRequest]) DeletedBroadcast(ctx context.Context, tx *gorm.DB, entity *TData) error {
+	return c.broadcast(ctx, tx, EventDeleted, c.deleted, entity)
 }
 
-func (c *CollectionManager[TData, TResponse, TRequest]) CreatedBroadcast(ctx context.Context, entity *TData) {
-	go func() {
-		topics := c.created(entity)
-		payload := c.ToModel(entity)
-		c.service.Broker.Dispatch(ctx, topics, payload)
-	}()
+// UpdatedBroadcast enqueues the updated topics in the outbox using the given transaction.
+func (c *CollectionManager[TData, TResponse, TRequest]) UpdatedBroadcast(ctx context.Context, tx *gorm.DB, entity *TData) error {
+	return c.broadcast(ctx, tx, EventUpdated, c.updated, entity)
 }
 
-func (c *CollectionManager[TData, TResponse, TRequest]) DeletedBroadcast(ctx context.Context, entity *TData) {
-	go func() {
-		topics := c.updated(entity)
-		payload := c.ToModel(entity)
-		c.service.Broker.Dispatch(ctx, topics, payload)
-	}()
+func (c *CollectionManager[TData, TResponse, TRequest]) broadcast(ctx context.Context, tx *gorm.DB, event string, topics func(*TData) []string, entity *TData) error {
+	if topics == nil {
+		return nil
+	}
+	if c.service.Outbox == nil {
+		return eris.New("broadcasts require an outbox service")
+	}
+	envelope, err := c.envelope(ctx, event, c.ToModel(entity), entity)
+	if err != nil {
+		return err
+	}
+	if err := c.service.Outbox.Enqueue(ctx, tx, topics(entity), envelope); err != nil {
+		return eris.Wrap(err, "failed to enqueue broadcast")
+	}
+	return nil
+}
+
+// transaction runs fn in a new transaction bound to ctx and wakes the outbox relay once it commits.
+// The relay publishes with its own context, so broadcasts survive the request that caused them.
+// Within a unit of work fn runs under a savepoint and the relay is woken when the unit commits.
+func (c *CollectionManager[TData, TResponse, TRequest]) transaction(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	if uow, ok := UnitOfWorkFromContext(ctx); ok {
+		return uow.Tx().WithContext(ctx).Transaction(fn)
+	}
+	if err := c.service.Database.Client().WithContext(ctx).Transaction(fn); err != nil {
+		return err
+	}
+	if c.service.Outbox != nil {
+		c.service.Outbox.Notify()
+	}
+	return nil
+}
+
+// client returns the transaction of the unit of work of ctx, if any, so that reads
+// see its uncommitted writes, or the database client otherwise
+func (c *CollectionManager[TData, TResponse, TRequest]) client(ctx context.Context) *gorm.DB {
+	if uow, ok := UnitOfWorkFromContext(ctx); ok {
+		return uow.Tx()
+	}
+	return c.service.Database.Client()
+}
+
+// session binds db to ctx, so cancellation and deadlines reach the query, and
+// restricts it to the tenant of ctx
+func (c *CollectionManager[TData, TResponse, TRequest]) session(ctx context.Context, db *gorm.DB) (*gorm.DB, error) {
+	return c.tenant(ctx, db.WithContext(ctx))
+}
+
+// schema returns the parsed GORM schema of TData
+func (c *CollectionManager[TData, TResponse, TRequest]) schema(db *gorm.DB) (*schema.Schema, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(new(TData)); err != nil {
+		return nil, eris.Wrap(err, "failed to parse entity schema")
+	}
+	return stmt.Schema, nil
 }
 
-func (c *CollectionManager[TData, TResponse, TRequest]) UpdatedBroadcast(ctx context.Context, entity *TData) {
-	go func() {
-		topics := c.updated(entity)
-		payload := c.ToModel(entity)
-		c.service.Broker.Dispatch(ctx, topics, payload)
-	}()
+// collectionName is the lower-cased type name of TData, used to name jobs and cache keys
+func collectionName[TData any]() string {
+	return strings.ToLower(reflect.TypeFor[TData]().Name())
 }
 
 func getID[T any](entity *T) (uuid.UUID, error) {
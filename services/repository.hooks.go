@@ -0,0 +1,69 @@
+package horizon_services
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+/*
+Hooks: horizon_services.Hooks[model.Feedback]{
+	BeforeCreate: func(ctx context.Context, tx *gorm.DB, feedback *model.Feedback) error {
+		feedback.Email = strings.ToLower(feedback.Email)
+		return nil
+	},
+	BeforeDelete: func(ctx context.Context, tx *gorm.DB, feedback *model.Feedback) error {
+		return echo.NewHTTPError(http.StatusForbidden, "feedback cannot be deleted")
+	},
+},
+*/
+
+// Hook runs inside the transaction of a repository operation. It may mutate the
+// entity, write through tx or enqueue outbox messages with it, and aborts the
+// operation, rolling back the transaction, by returning an error.
+type Hook[TData any] func(ctx context.Context, tx *gorm.DB, entity *TData) error
+
+// Hooks are the lifecycle hooks of a repository. Before hooks receive the entity
+// as passed by the caller, before the tenant is stamped and the row is written;
+// after hooks receive the stored entity, reloaded with its preloads, before it is
+// audited and broadcast. Bulk operations run the hooks once per entity.
+//
+// UpdateFields runs the update hooks with the partial fields before and the
+// reloaded entity after. Upsert runs the upsert hooks around the create or update
+// hooks of the path it takes. Restore runs the restore hooks with the deleted row
+// before and the restored entity after; ForceDelete and PurgeDeleted run the
+// force delete hooks with the removed row, which is the place to release what
+// the row refers to, such as a stored file. They run in a unit of work, so such
+// releases belong in an AfterCommit callback of UnitOfWorkFromContext(ctx) and
+// are skipped when the deletion rolls back.
+type Hooks[TData any] struct {
+	BeforeCreate Hook[TData]
+	AfterCreate  Hook[TData]
+	BeforeUpdate Hook[TData]
+	AfterUpdate  Hook[TData]
+	BeforeDelete Hook[TData]
+	AfterDelete  Hook[TData]
+	BeforeUpsert Hook[TData]
+	AfterUpsert  Hook[TData]
+
+	BeforeRestore     Hook[TData]
+	AfterRestore      Hook[TData]
+	BeforeForceDelete Hook[TData]
+	AfterForceDelete  Hook[TData]
+}
+
+// run calls hook for each entity, stopping at the first error. Hooks get a fresh
+// session of tx: the tenant predicate of the collection must not leak into their
+// queries on other tables.
+func (hook Hook[TData]) run(ctx context.Context, tx *gorm.DB, entities ...*TData) error {
+	if hook == nil {
+		return nil
+	}
+	tx = tx.Session(&gorm.Session{NewDB: true})
+	for _, entity := range entities {
+		if err := hook(ctx, tx, entity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
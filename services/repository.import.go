@@ -0,0 +1,248 @@
+package horizon_services
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/rotisserie/eris"
+	"github.com/xuri/excelize/v2"
+)
+
+// ImportError is a problem with a single row of an imported file. Row counts
+// from 1 at the header, as spreadsheets number them.
+type ImportError struct {
+	Row     int    `json:"row"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// ImportResult reports how many rows were created and why the others were skipped
+type ImportResult struct {
+	Rows    int            `json:"rows"`
+	Created int            `json:"created"`
+	Errors  []*ImportError `json:"errors"`
+}
+
+// Import implements Repository.
+func (c *CollectionManager[TData, TResponse, TRequest]) Import(ctx context.Context, r io.Reader, format ExportFormat) (*ImportResult, error) {
+	if c.entity == nil {
+		return nil, eris.Errorf("%s does not support import: Entity is not set", collectionName[TData]())
+	}
+	rows, err := readRows(r, format)
+	if err != nil {
+		return nil, err
+	}
+	result := &ImportResult{Errors: []*ImportError{}}
+	if len(rows) == 0 {
+		return result, nil
+	}
+
+	if len(rows[0]) > 0 {
+		rows[0][0] = strings.TrimPrefix(rows[0][0], "\ufeff")
+	}
+	columns := spreadsheetColumns(reflect.TypeFor[TRequest]())
+	indexes := make([]int, len(columns))
+	for i, column := range columns {
+		indexes[i] = slices.IndexFunc(rows[0], func(header string) bool {
+			return strings.EqualFold(strings.TrimSpace(header), column.name)
+		})
+	}
+
+	entities := make([]*TData, 0, len(rows)-1)
+	for i, row := range rows[1:] {
+		number := i + 2
+		if isBlankRow(row) {
+			continue
+		}
+		result.Rows++
+		req := new(TRequest)
+		v := reflect.ValueOf(req).Elem()
+		valid := true
+		for j, column := range columns {
+			if indexes[j] < 0 || indexes[j] >= len(row) {
+				continue
+			}
+			if err := importValue(v.FieldByIndex(column.index), row[indexes[j]]); err != nil {
+				result.Errors = append(result.Errors, &ImportError{Row: number, Field: column.name, Message: err.Error()})
+				valid = false
+			}
+		}
+		if !valid {
+			continue
+		}
+		if err := c.service.Validator.Struct(req); err != nil {
+			result.Errors = append(result.Errors, validationErrors(number, columns, err)...)
+			continue
+		}
+		entity, err := c.entity(req)
+		if err != nil {
+			result.Errors = append(result.Errors, &ImportError{Row: number, Message: err.Error()})
+			continue
+		}
+		entities = append(entities, entity)
+	}
+	if len(entities) == 0 {
+		return result, nil
+	}
+	if err := c.CreateMany(ctx, entities); err != nil {
+		return nil, eris.Wrap(err, "failed to create imported entities")
+	}
+	result.Created = len(entities)
+	return result, nil
+}
+
+// readRows reads every row of a CSV file or of the first worksheet of an XLSX file
+func readRows(r io.Reader, format ExportFormat) ([][]string, error) {
+	switch format {
+	case ExportCSV:
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+		rows, err := reader.ReadAll()
+		if err != nil {
+			return nil, eris.Wrap(err, "failed to read csv file")
+		}
+		return rows, nil
+	case ExportXLSX:
+		file, err := excelize.OpenReader(r)
+		if err != nil {
+			return nil, eris.Wrap(err, "failed to open xlsx file")
+		}
+		defer file.Close()
+		sheets := file.GetSheetList()
+		if len(sheets) == 0 {
+			return nil, nil
+		}
+		sheet := sheets[0]
+		if slices.Contains(sheets, exportSheet) {
+			sheet = exportSheet
+		}
+		iterator, err := file.Rows(sheet)
+		if err != nil {
+			return nil, eris.Wrapf(err, "failed to read worksheet %s", sheet)
+		}
+		defer iterator.Close()
+		var rows [][]string
+		for iterator.Next() {
+			row, err := iterator.Columns()
+			if err != nil {
+				return nil, eris.Wrapf(err, "failed to read row %d of worksheet %s", len(rows)+1, sheet)
+			}
+			rows = append(rows, row)
+		}
+		if err := iterator.Error(); err != nil {
+			return nil, eris.Wrapf(err, "failed to read worksheet %s", sheet)
+		}
+		return rows, nil
+	}
+	return nil, eris.Errorf("unsupported spreadsheet format: %s", format)
+}
+
+// importValue parses a cell into field. Empty cells leave the field unset.
+func importValue(field reflect.Value, cell string) error {
+	cell = strings.TrimSpace(cell)
+	if cell == "" {
+		return nil
+	}
+	if field.Kind() == reflect.Pointer {
+		value := reflect.New(field.Type().Elem())
+		if err := importValue(value.Elem(), cell); err != nil {
+			return err
+		}
+		field.Set(value)
+		return nil
+	}
+	switch field.Interface().(type) {
+	case uuid.UUID:
+		id, err := uuid.Parse(cell)
+		if err != nil {
+			return fmt.Errorf("invalid uuid %q", cell)
+		}
+		field.Set(reflect.ValueOf(id))
+		return nil
+	case time.Time:
+		t, err := time.Parse(time.RFC3339, cell)
+		if err != nil {
+			if t, err = time.Parse(time.DateOnly, cell); err != nil {
+				return fmt.Errorf("invalid time %q, expected RFC 3339 or YYYY-MM-DD", cell)
+			}
+		}
+		field.Set(reflect.ValueOf(t))
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.String:
+		if len(cell) > 1 && cell[0] == '\'' && strings.ContainsRune(formulaPrefixes, rune(cell[1])) {
+			cell = cell[1:]
+		}
+		field.SetString(cell)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(cell)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", cell)
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(cell, 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", cell)
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(cell, 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid unsigned integer %q", cell)
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(cell, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid number %q", cell)
+		}
+		field.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported column type %s", field.Type())
+	}
+	return nil
+}
+
+// validationErrors reports each failed validation rule of a row against the json name of its field
+func validationErrors(row int, columns []spreadsheetColumn, err error) []*ImportError {
+	var failures validator.ValidationErrors
+	if !eris.As(err, &failures) {
+		return []*ImportError{{Row: row, Message: err.Error()}}
+	}
+	problems := make([]*ImportError, 0, len(failures))
+	for _, failure := range failures {
+		name := failure.Field()
+		for _, column := range columns {
+			if column.field == failure.StructField() {
+				name = column.name
+			}
+		}
+		message := "failed " + failure.Tag() + " validation"
+		if failure.Param() != "" {
+			message += " (" + failure.Param() + ")"
+		}
+		problems = append(problems, &ImportError{Row: row, Field: name, Message: message})
+	}
+	return problems
+}
+
+func isBlankRow(row []string) bool {
+	for _, cell := range row {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,85 @@
+package horizon_services
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rotisserie/eris"
+	"gorm.io/gorm/schema"
+)
+
+/*
+GET /feedback?include=media
+
+GET /feedback/:feedback_id?include=media
+*/
+
+const (
+	// MaxIncludeDepth bounds how many relations deep an include may reach, e.g. media.owner is 2
+	MaxIncludeDepth = 3
+
+	// MaxIncludes bounds how many relations a single request may include
+	MaxIncludes = 5
+)
+
+// includeNamer names relations in includes the way GORM names columns: Media becomes media
+var includeNamer = schema.NamingStrategy{}
+
+// Includes implements Repository.
+func (c *CollectionManager[TData, TResponse, TRequest]) Includes(ctx echo.Context) ([]string, error) {
+	return c.includePreloads(splitList(ctx.QueryParam("include")))
+}
+
+// includePreloads resolves include names such as media or media.owner to GORM
+// preloads such as Media or Media.Owner. Only names listed in Includable are accepted.
+func (c *CollectionManager[TData, TResponse, TRequest]) includePreloads(names []string) ([]string, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	if len(names) > MaxIncludes {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("at most %d relations can be included", MaxIncludes))
+	}
+	s, err := c.schema(c.service.Database.Client())
+	if err != nil {
+		return nil, err
+	}
+	preloads := make([]string, 0, len(names))
+	for _, name := range names {
+		if !slices.Contains(c.includable, name) {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("including %s is not allowed", name))
+		}
+		segments := strings.Split(name, ".")
+		if len(segments) > MaxIncludeDepth {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("%s is nested deeper than %d relations", name, MaxIncludeDepth))
+		}
+		preload, err := relationPath(s, segments)
+		if err != nil {
+			return nil, err
+		}
+		preloads = append(preloads, preload)
+	}
+	return preloads, nil
+}
+
+// relationPath walks segments through the relations of s and returns their Go field path
+func relationPath(s *schema.Schema, segments []string) (string, error) {
+	path := make([]string, 0, len(segments))
+	for _, segment := range segments {
+		var found *schema.Relationship
+		for _, relation := range s.Relationships.Relations {
+			if includeNamer.ColumnName("", relation.Name) == segment {
+				found = relation
+				break
+			}
+		}
+		if found == nil {
+			return "", eris.Errorf("relation %s not found on %s", segment, s.Name)
+		}
+		path = append(path, found.Name)
+		s = found.FieldSchema
+	}
+	return strings.Join(path, "."), nil
+}
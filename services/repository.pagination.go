@@ -0,0 +1,451 @@
+package horizon_services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/lands-horizon/horizon-server/services/horizon"
+	"github.com/rotisserie/eris"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+/*
+GET /feedback?page=2&size=10&sort=-created_at,email&feedback_type[in]=bug,feature&email[like]=gmail
+
+GET /feedback?size=10&cursor=<next_cursor from the previous page>
+*/
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+type FilterOperator string
+
+const (
+	FilterEqual          FilterOperator = "eq"
+	FilterNotEqual       FilterOperator = "ne"
+	FilterIn             FilterOperator = "in"
+	FilterNotIn          FilterOperator = "nin"
+	FilterGreaterThan    FilterOperator = "gt"
+	FilterGreaterOrEqual FilterOperator = "gte"
+	FilterLessThan       FilterOperator = "lt"
+	FilterLessOrEqual    FilterOperator = "lte"
+	FilterLike           FilterOperator = "like"
+	FilterIsNull         FilterOperator = "null"
+)
+
+var filterOperators = []FilterOperator{
+	FilterEqual, FilterNotEqual, FilterIn, FilterNotIn,
+	FilterGreaterThan, FilterGreaterOrEqual, FilterLessThan, FilterLessOrEqual,
+	FilterLike, FilterIsNull,
+}
+
+type SortDirection string
+
+const (
+	SortAscending  SortDirection = "asc"
+	SortDescending SortDirection = "desc"
+)
+
+// Filter is a single typed predicate on a whitelisted column
+type Filter struct {
+	Field    string
+	Operator FilterOperator
+	Value    string
+}
+
+// Sort orders the result by a whitelisted column
+type Sort struct {
+	Field     string
+	Direction SortDirection
+}
+
+// PageQuery describes a page of a collection. When Cursor is set the
+// page is resolved by keyset instead of Page/Size offset. Fields, when set,
+// limits the columns loaded to those backing the requested response fields.
+// Include names the whitelisted relations to preload.
+type PageQuery struct {
+	Page    int
+	Size    int
+	Cursor  string
+	Sort    []Sort
+	Filters []Filter
+	Fields  Fields
+	Include []string
+}
+
+// PageResult is a single page of items with the total count of matching rows
+type PageResult[T any] struct {
+	Items      []*T   `json:"items"`
+	Total      int64  `json:"total"`
+	Page       int    `json:"page"`
+	Size       int    `json:"size"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+var filterParamPattern = regexp.MustCompile(`^([a-z0-9_]+)\[([a-z]+)\]$`)
+
+// ParsePageQuery reads page, size, cursor, sort and filter parameters from
+// url query values. Only columns listed in sortable and filterable are accepted.
+func ParsePageQuery(values url.Values, sortable []string, filterable []string) (*PageQuery, error) {
+	query := &PageQuery{
+		Page:    1,
+		Size:    DefaultPageSize,
+		Cursor:  values.Get("cursor"),
+		Fields:  splitList(values.Get("fields")),
+		Include: splitList(values.Get("include")),
+	}
+	if raw := values.Get("page"); raw != "" {
+		page, err := strconv.Atoi(raw)
+		if err != nil || page < 1 {
+			return nil, eris.Errorf("invalid page: %s", raw)
+		}
+		query.Page = page
+	}
+	if raw := values.Get("size"); raw != "" {
+		size, err := strconv.Atoi(raw)
+		if err != nil || size < 1 || size > MaxPageSize {
+			return nil, eris.Errorf("invalid size: %s (must be between 1 and %d)", raw, MaxPageSize)
+		}
+		query.Size = size
+	}
+	if raw := values.Get("sort"); raw != "" {
+		for _, field := range strings.Split(raw, ",") {
+			field = strings.TrimSpace(field)
+			direction := SortAscending
+			if strings.HasPrefix(field, "-") {
+				direction = SortDescending
+				field = field[1:]
+			}
+			if !slices.Contains(sortable, field) {
+				return nil, eris.Errorf("sorting by %s is not allowed", field)
+			}
+			query.Sort = append(query.Sort, Sort{Field: field, Direction: direction})
+		}
+	}
+	for key, raw := range values {
+		field, operator := key, FilterEqual
+		if match := filterParamPattern.FindStringSubmatch(key); match != nil {
+			field, operator = match[1], FilterOperator(match[2])
+		}
+		if !slices.Contains(filterable, field) {
+			if key != field {
+				return nil, eris.Errorf("filtering by %s is not allowed", field)
+			}
+			continue
+		}
+		if !slices.Contains(filterOperators, operator) {
+			return nil, eris.Errorf("unknown filter operator %s for %s", operator, field)
+		}
+		for _, value := range raw {
+			query.Filters = append(query.Filters, Filter{Field: field, Operator: operator, Value: value})
+		}
+	}
+	slices.SortFunc(query.Filters, func(a, b Filter) int {
+		return strings.Compare(a.Field+string(a.Operator), b.Field+string(b.Operator))
+	})
+	return query, nil
+}
+
+// Query implements Repository.
+func (c *CollectionManager[TData, TResponse, TRequest]) Query(ctx echo.Context) (*PageQuery, error) {
+	query, err := ParsePageQuery(ctx.QueryParams(), c.sortable, c.filterable)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := c.checkFields(query.Fields); err != nil {
+		return nil, err
+	}
+	if _, err := c.includePreloads(query.Include); err != nil {
+		return nil, err
+	}
+	return query, nil
+}
+
+// Paginate implements Repository.
+func (c *CollectionManager[TData, TResponse, TRequest]) Paginate(ctx context.Context, query *PageQuery, preloads ...string) (*PageResult[TData], error) {
+	return c.paginate(ctx, nil, query, preloads...)
+}
+
+// paginate pages through the rows selected by scope, or all live rows when scope is nil
+func (c *CollectionManager[TData, TResponse, TRequest]) paginate(ctx context.Context, scope func(*gorm.DB) *gorm.DB, query *PageQuery, preloads ...string) (*PageResult[TData], error) {
+	if scope == nil {
+		scope = func(db *gorm.DB) *gorm.DB { return db }
+	}
+	if query == nil {
+		query = &PageQuery{}
+	}
+	page, size := max(query.Page, 1), query.Size
+	if size < 1 || size > MaxPageSize {
+		size = DefaultPageSize
+	}
+	sorts := c.pageSorts(query.Sort)
+
+	client, err := c.session(ctx, c.client(ctx))
+	if err != nil {
+		return nil, err
+	}
+	var total int64
+	if err := client.Model(new(TData)).Scopes(scope, filterScope(query.Filters)).Count(&total).Error; err != nil {
+		return nil, eris.Wrap(err, "failed to count entities for page")
+	}
+
+	db, err := c.selectFields(client.Model(new(TData)).Scopes(scope, filterScope(query.Filters)), query.Fields, sorts)
+	if err != nil {
+		return nil, err
+	}
+	if query.Cursor != "" {
+		values, err := decodeCursor(query.Cursor, len(sorts))
+		if err != nil {
+			return nil, err
+		}
+		db = db.Where(keysetCondition(sorts, values))
+	} else {
+		db = db.Offset((page - 1) * size)
+	}
+	for _, s := range sorts {
+		db = db.Order(clause.OrderByColumn{Column: clause.Column{Name: s.Field}, Desc: s.Direction == SortDescending})
+	}
+	includes, err := c.includePreloads(query.Include)
+	if err != nil {
+		return nil, err
+	}
+	preloads = horizon.MergeString(horizon.MergeString(c.preloads, preloads), includes)
+	for _, preload := range preloads {
+		db = db.Preload(preload)
+	}
+	var entities []*TData
+	if err := db.Limit(size + 1).Find(&entities).Error; err != nil {
+		return nil, eris.Wrap(err, "failed to paginate entities")
+	}
+
+	result := &PageResult[TData]{Total: total, Page: page, Size: size}
+	if len(entities) > size {
+		entities = entities[:size]
+		cursor, err := c.encodeCursor(ctx, entities[size-1], sorts)
+		if err != nil {
+			return nil, err
+		}
+		result.NextCursor = cursor
+	}
+	result.Items = entities
+	return result, nil
+}
+
+// PaginateRaw implements Repository.
+func (c *CollectionManager[TData, TResponse, TRequest]) PaginateRaw(ctx context.Context, query *PageQuery, preloads ...string) (*PageResult[TResponse], error) {
+	result, err := c.Paginate(ctx, query, preloads...)
+	if err != nil {
+		return nil, err
+	}
+	return c.rawPage(result), nil
+}
+
+// rawPage converts a page of entities into a page of response models
+func (c *CollectionManager[TData, TResponse, TRequest]) rawPage(result *PageResult[TData]) *PageResult[TResponse] {
+	return &PageResult[TResponse]{
+		Items:      c.ToModels(result.Items),
+		Total:      result.Total,
+		Page:       result.Page,
+		Size:       result.Size,
+		NextCursor: result.NextCursor,
+	}
+}
+
+// pageSorts returns the requested sort (or updated_at DESC) with id appended
+// as a tie-breaker so that keyset cursors are stable. A requested sort on id ends
+// the sort where it stands, since no later column could break a tie.
+func (c *CollectionManager[TData, TResponse, TRequest]) pageSorts(requested []Sort) []Sort {
+	sorts := make([]Sort, 0, len(requested)+1)
+	for _, s := range requested {
+		sorts = append(sorts, s)
+		if s.Field == "id" {
+			return sorts
+		}
+	}
+	if len(sorts) == 0 {
+		sorts = append(sorts, Sort{Field: "updated_at", Direction: SortDescending})
+	}
+	return append(sorts, Sort{Field: "id", Direction: sorts[len(sorts)-1].Direction})
+}
+
+func (c *CollectionManager[TData, TResponse, TRequest]) encodeCursor(ctx context.Context, entity *TData, sorts []Sort) (string, error) {
+	schema, err := c.schema(c.service.Database.Client())
+	if err != nil {
+		return "", err
+	}
+	values := make([]*string, len(sorts))
+	for i, s := range sorts {
+		field := schema.LookUpField(s.Field)
+		if field == nil {
+			return "", eris.Errorf("sort field %s not found in entity", s.Field)
+		}
+		value, _ := field.ValueOf(ctx, reflect.ValueOf(entity))
+		if encoded, ok := cursorValue(value); ok {
+			values[i] = &encoded
+		}
+	}
+	data, err := json.Marshal(values)
+	if err != nil {
+		return "", eris.Wrap(err, "failed to encode cursor")
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// cursorValue encodes a sort value of a cursor; it reports false for NULL, which
+// the cursor keeps as a JSON null
+func cursorValue(value any) (string, bool) {
+	switch v := value.(type) {
+	case nil:
+		return "", false
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano), true
+	case *time.Time:
+		if v != nil {
+			return v.UTC().Format(time.RFC3339Nano), true
+		}
+	case uuid.UUID:
+		return v.String(), true
+	case *uuid.UUID:
+		if v != nil {
+			return v.String(), true
+		}
+	case gorm.DeletedAt:
+		if v.Valid {
+			return v.Time.UTC().Format(time.RFC3339Nano), true
+		}
+	default:
+		rv := reflect.ValueOf(value)
+		if rv.Kind() == reflect.Pointer {
+			if rv.IsNil() {
+				return "", false
+			}
+			return fmt.Sprint(rv.Elem().Interface()), true
+		}
+		return fmt.Sprint(value), true
+	}
+	return "", false
+}
+
+func decodeCursor(cursor string, length int) ([]*string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "invalid cursor")
+	}
+	var values []*string
+	if err := json.Unmarshal(data, &values); err != nil || len(values) != length {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "invalid cursor")
+	}
+	return values, nil
+}
+
+// keysetCondition builds (a > x) OR (a = x AND b > y) OR ... honoring each
+// column's direction. A nil value stands for NULL, which sorts after every value
+// as PostgreSQL does by default: last ascending and first descending.
+func keysetCondition(sorts []Sort, values []*string) clause.Expression {
+	ors := make([]clause.Expression, 0, len(sorts))
+	for i, s := range sorts {
+		after := keysetAfter(s, values[i])
+		if after == nil {
+			continue
+		}
+		ands := make([]clause.Expression, 0, i+1)
+		for j := 0; j < i; j++ {
+			ands = append(ands, keysetEqual(sorts[j], values[j]))
+		}
+		ors = append(ors, clause.And(append(ands, after)...))
+	}
+	if len(ors) == 0 {
+		return clause.Expr{SQL: "FALSE"}
+	}
+	return clause.Or(ors...)
+}
+
+// keysetEqual matches the rows whose column s holds value
+func keysetEqual(s Sort, value *string) clause.Expression {
+	column := clause.Column{Name: s.Field}
+	if value == nil {
+		return clause.Eq{Column: column, Value: nil}
+	}
+	return clause.Eq{Column: column, Value: *value}
+}
+
+// keysetAfter matches the rows whose column s sorts after value, or returns nil
+// when none can
+func keysetAfter(s Sort, value *string) clause.Expression {
+	column := clause.Column{Name: s.Field}
+	switch {
+	case s.Direction == SortDescending && value == nil:
+		return clause.Neq{Column: column, Value: nil}
+	case s.Direction == SortDescending:
+		return clause.Lt{Column: column, Value: *value}
+	case value == nil:
+		return nil
+	default:
+		return clause.Or(clause.Gt{Column: column, Value: *value}, clause.Eq{Column: column, Value: nil})
+	}
+}
+
+// likeEscaper escapes the wildcards of a LIKE pattern so that they match literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func filterScope(filters []Filter) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		for _, f := range filters {
+			if expr := filterExpression(f); expr != nil {
+				db = db.Where(expr)
+			}
+		}
+		return db
+	}
+}
+
+func filterExpression(f Filter) clause.Expression {
+	column := clause.Column{Name: f.Field}
+	switch f.Operator {
+	case FilterEqual:
+		return clause.Eq{Column: column, Value: f.Value}
+	case FilterNotEqual:
+		return clause.Neq{Column: column, Value: f.Value}
+	case FilterIn, FilterNotIn:
+		parts := strings.Split(f.Value, ",")
+		values := make([]any, len(parts))
+		for i, p := range parts {
+			values[i] = strings.TrimSpace(p)
+		}
+		if f.Operator == FilterNotIn {
+			return clause.Not(clause.IN{Column: column, Values: values})
+		}
+		return clause.IN{Column: column, Values: values}
+	case FilterGreaterThan:
+		return clause.Gt{Column: column, Value: f.Value}
+	case FilterGreaterOrEqual:
+		return clause.Gte{Column: column, Value: f.Value}
+	case FilterLessThan:
+		return clause.Lt{Column: column, Value: f.Value}
+	case FilterLessOrEqual:
+		return clause.Lte{Column: column, Value: f.Value}
+	case FilterLike:
+		return clause.Expr{SQL: `? ILIKE ? ESCAPE '\'`, Vars: []any{column, "%" + likeEscaper.Replace(f.Value) + "%"}}
+	case FilterIsNull:
+		if isNull, _ := strconv.ParseBool(f.Value); !isNull {
+			return clause.Neq{Column: column, Value: nil}
+		}
+		return clause.Eq{Column: column, Value: nil}
+	}
+	return nil
+}
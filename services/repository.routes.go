@@ -0,0 +1,325 @@
+package horizon_services
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/lands-horizon/horizon-server/services/horizon"
+	"github.com/rotisserie/eris"
+	"gorm.io/gorm"
+)
+
+/*
+horizon_services.RegisterCRUDRoutes(req, c.feedback.Manager, horizon_services.CRUDRoutes[model.Feedback, model.FeedbackRequest]{
+	Route:    "/feedback",
+	Param:    "feedback_id",
+	Resource: "TFeedback",
+	Map: func(ctx echo.Context, req *model.FeedbackRequest, feedback *model.Feedback) error {
+		feedback.Email = req.Email
+		return nil
+	},
+	Delete: horizon_services.CRUDRoute{Middleware: []echo.MiddlewareFunc{adminOnly}},
+})
+*/
+
+// CRUDRoute configures a single generated route
+type CRUDRoute struct {
+	// Disabled skips the route so that it can be written by hand
+	Disabled bool
+	Note     string
+
+	// Middleware runs after the middleware shared by every route of the collection
+	Middleware []echo.MiddlewareFunc
+}
+
+// CRUDRoutes describes the list, get, create, update and delete routes generated
+// by RegisterCRUDRoutes for a collection
+type CRUDRoutes[TData any, TRequest any] struct {
+	// Route is the collection path; single entities live at Route + "/:" + Param
+	Route string
+	Param string
+
+	// Resource names the response type in the route list, e.g. "TFeedback"
+	Resource string
+
+	// Map copies a validated request onto a new entity on create and onto the
+	// stored entity on update
+	Map func(ctx echo.Context, req *TRequest, entity *TData) error
+
+	// Middleware runs on every generated route
+	Middleware []echo.MiddlewareFunc
+
+	List   CRUDRoute
+	Get    CRUDRoute
+	Create CRUDRoute
+	Update CRUDRoute
+	Delete CRUDRoute
+
+	// Export and Import exchange the collection as CSV or XLSX; Import requires Entity in RepositoryParams
+	Export CRUDRoute
+	Import CRUDRoute
+}
+
+// RegisterCRUDRoutes registers the routes described by routes on service, backed by repository.
+//
+//	GET    Route         200 page of resources; supports q, fields, include, page, size, cursor, sort and filters
+//	GET    Route/:Param  200 resource with ETag, 304 when If-None-Match matches; supports fields and include
+//	POST   Route         201 created resource
+//	PUT    Route/:Param  200 updated resource, 409 when If-Match or the version is stale
+//	DELETE Route/:Param  204, 409 when If-Match or the version is stale
+//	GET    Route/export  200 CSV or XLSX file (format=csv|xlsx) of the rows matching the list filters and sort
+//	POST   Route/import  200 ImportResult of a CSV or XLSX file uploaded as the multipart field "file"
+//
+// Invalid ids and requests are answered with 400 and unknown ids with 404.
+func RegisterCRUDRoutes[TData any, TResponse any, TRequest any](
+	service horizon.APIService,
+	repository Repository[TData, TResponse, TRequest],
+	routes CRUDRoutes[TData, TRequest],
+) {
+	item := routes.Route + "/:" + routes.Param
+	middleware := func(route CRUDRoute) []echo.MiddlewareFunc {
+		return append(append([]echo.MiddlewareFunc{}, routes.Middleware...), route.Middleware...)
+	}
+
+	if !routes.List.Disabled {
+		service.RegisterRoute(horizon.Route{
+			Route:    routes.Route,
+			Method:   "GET",
+			Response: "Paginated<" + routes.Resource + ">",
+			Note:     crudNote(routes.List, "supports q (full-text search), fields, include, page, size, cursor, sort and filter query parameters"),
+		}, func(ctx echo.Context) error {
+			query, err := repository.Query(ctx)
+			if err != nil {
+				return err
+			}
+			result, err := repository.Search(ctx.Request().Context(), ctx.QueryParam("q"), query)
+			if err != nil {
+				return crudError(ctx, err)
+			}
+			if len(query.Fields) > 0 {
+				return ctx.JSON(http.StatusOK, repository.SparsePage(result, query.Fields))
+			}
+			return ctx.JSON(http.StatusOK, &PageResult[TResponse]{
+				Items:      repository.ToModels(result.Items),
+				Total:      result.Total,
+				Page:       result.Page,
+				Size:       result.Size,
+				NextCursor: result.NextCursor,
+			})
+		}, middleware(routes.List)...)
+	}
+
+	if !routes.Export.Disabled {
+		service.RegisterRoute(horizon.Route{
+			Route:    routes.Route + "/export",
+			Method:   "GET",
+			Response: "File - text/csv or xlsx",
+			Note:     crudNote(routes.Export, "format=csv|xlsx; supports the sort and filter query parameters of the list"),
+		}, func(ctx echo.Context) error {
+			format, err := ParseExportFormat(cmp.Or(ctx.QueryParam("format"), string(ExportCSV)))
+			if err != nil {
+				return err
+			}
+			query, err := repository.Query(ctx)
+			if err != nil {
+				return err
+			}
+			name := strings.Trim(path.Base(routes.Route), "/") + "." + string(format)
+			ctx.Response().Header().Set(echo.HeaderContentType, format.ContentType())
+			ctx.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", name))
+			// The status is sent with the first rows, once the first page is read
+			err = repository.Export(ctx.Request().Context(), ctx.Response(), format, query)
+			if err != nil && !ctx.Response().Committed {
+				ctx.Response().Header().Del(echo.HeaderContentDisposition)
+				return crudError(ctx, err)
+			}
+			return err
+		}, middleware(routes.Export)...)
+	}
+
+	if !routes.Import.Disabled {
+		service.RegisterRoute(horizon.Route{
+			Route:    routes.Route + "/import",
+			Method:   "POST",
+			Request:  "File - multipart/form-data",
+			Response: "TImportResult",
+			Note:     crudNote(routes.Import, "creates the valid rows of a csv or xlsx file and reports the rejected ones"),
+		}, func(ctx echo.Context) error {
+			header, err := ctx.FormFile("file")
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "missing file")
+			}
+			format, err := ParseExportFormat(cmp.Or(ctx.FormValue("format"), header.Filename))
+			if err != nil {
+				return err
+			}
+			file, err := header.Open()
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "unreadable file")
+			}
+			defer file.Close()
+			result, err := repository.Import(ctx.Request().Context(), file, format)
+			if err != nil {
+				return crudError(ctx, err)
+			}
+			return ctx.JSON(http.StatusOK, result)
+		}, middleware(routes.Import)...)
+	}
+
+	if !routes.Get.Disabled {
+		service.RegisterRoute(horizon.Route{
+			Route:    item,
+			Method:   "GET",
+			Response: routes.Resource,
+			Note:     crudNote(routes.Get, "supports the fields and include query parameters"),
+		}, func(ctx echo.Context) error {
+			id, err := crudID(ctx, routes.Param)
+			if err != nil {
+				return err
+			}
+			fields, err := repository.Fieldset(ctx)
+			if err != nil {
+				return err
+			}
+			includes, err := repository.Includes(ctx)
+			if err != nil {
+				return err
+			}
+			entity, err := repository.GetByID(ctx.Request().Context(), id, includes...)
+			if err != nil {
+				return crudError(ctx, err)
+			}
+			etag := repository.ETag(entity)
+			ctx.Response().Header().Set("ETag", etag)
+			if etag != "" && ctx.Request().Header.Get("If-None-Match") == etag {
+				return ctx.NoContent(http.StatusNotModified)
+			}
+			if len(fields) > 0 {
+				return ctx.JSON(http.StatusOK, repository.Sparse(entity, fields))
+			}
+			return ctx.JSON(http.StatusOK, repository.ToModel(entity))
+		}, middleware(routes.Get)...)
+	}
+
+	if !routes.Create.Disabled {
+		service.RegisterRoute(horizon.Route{
+			Route:    routes.Route,
+			Method:   "POST",
+			Request:  routes.Resource,
+			Response: routes.Resource,
+			Note:     routes.Create.Note,
+		}, func(ctx echo.Context) error {
+			req, err := repository.Validate(ctx)
+			if err != nil {
+				return err
+			}
+			entity := new(TData)
+			if err := routes.Map(ctx, req, entity); err != nil {
+				return crudError(ctx, err)
+			}
+			if err := repository.Create(ctx.Request().Context(), entity); err != nil {
+				return crudError(ctx, err)
+			}
+			ctx.Response().Header().Set("ETag", repository.ETag(entity))
+			return ctx.JSON(http.StatusCreated, repository.ToModel(entity))
+		}, middleware(routes.Create)...)
+	}
+
+	if !routes.Update.Disabled {
+		service.RegisterRoute(horizon.Route{
+			Route:    item,
+			Method:   "PUT",
+			Request:  routes.Resource,
+			Response: routes.Resource,
+			Note:     routes.Update.Note,
+		}, func(ctx echo.Context) error {
+			id, err := crudID(ctx, routes.Param)
+			if err != nil {
+				return err
+			}
+			req, err := repository.Validate(ctx)
+			if err != nil {
+				return err
+			}
+			// The precondition holds against the stored row, never a cached copy
+			entity, err := repository.GetByID(WithoutCache(ctx.Request().Context()), id)
+			if err != nil {
+				return crudError(ctx, err)
+			}
+			if err := repository.Precondition(ctx, entity); err != nil {
+				return crudError(ctx, err)
+			}
+			if err := routes.Map(ctx, req, entity); err != nil {
+				return crudError(ctx, err)
+			}
+			if err := repository.Update(ctx.Request().Context(), entity); err != nil {
+				return crudError(ctx, err)
+			}
+			ctx.Response().Header().Set("ETag", repository.ETag(entity))
+			return ctx.JSON(http.StatusOK, repository.ToModel(entity))
+		}, middleware(routes.Update)...)
+	}
+
+	if !routes.Delete.Disabled {
+		service.RegisterRoute(horizon.Route{
+			Route:  item,
+			Method: "DELETE",
+			Note:   routes.Delete.Note,
+		}, func(ctx echo.Context) error {
+			id, err := crudID(ctx, routes.Param)
+			if err != nil {
+				return err
+			}
+			// The precondition holds against the stored row, never a cached copy
+			entity, err := repository.GetByID(WithoutCache(ctx.Request().Context()), id)
+			if err != nil {
+				return crudError(ctx, err)
+			}
+			if err := repository.Precondition(ctx, entity); err != nil {
+				return crudError(ctx, err)
+			}
+			if err := repository.Delete(ctx.Request().Context(), entity); err != nil {
+				return crudError(ctx, err)
+			}
+			return ctx.NoContent(http.StatusNoContent)
+		}, middleware(routes.Delete)...)
+	}
+}
+
+func crudNote(route CRUDRoute, fallback string) string {
+	if route.Note != "" {
+		return route.Note
+	}
+	return fallback
+}
+
+func crudID(ctx echo.Context, param string) (uuid.UUID, error) {
+	id, err := uuid.Parse(ctx.Param(param))
+	if err != nil {
+		return uuid.Nil, echo.NewHTTPError(http.StatusBadRequest, "invalid "+param)
+	}
+	return id, nil
+}
+
+// crudError answers err with the status code matching its cause
+func crudError(ctx echo.Context, err error) error {
+	var httpError *echo.HTTPError
+	switch {
+	case eris.As(err, &httpError):
+		return httpError
+	case IsConflict(err):
+		return ctx.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	case eris.Is(err, gorm.ErrRecordNotFound):
+		return ctx.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case eris.Is(err, ErrTenantRequired):
+		return ctx.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	case eris.Is(err, ErrDuplicateID):
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+}
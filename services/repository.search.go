@@ -0,0 +1,157 @@
+package horizon_services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/lands-horizon/horizon-server/services/horizon"
+	"github.com/rotisserie/eris"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// SearchColumn is the generated tsvector column maintained by Migrate
+	SearchColumn = "search_vector"
+
+	// DefaultSearchLanguage is the text search configuration used when none is set
+	DefaultSearchLanguage = "simple"
+)
+
+// searchWeights ranks the searchable columns in the order they are declared
+var searchWeights = []string{"A", "B", "C", "D"}
+
+// Migrate implements Repository.
+func (c *CollectionManager[TData, TResponse, TRequest]) Migrate(ctx context.Context) error {
+	if len(c.searchable) == 0 {
+		return nil
+	}
+	db := c.service.Database.Client().WithContext(ctx)
+	s, err := c.schema(db)
+	if err != nil {
+		return err
+	}
+	columns := make([]string, len(c.searchable))
+	for i, column := range c.searchable {
+		field := s.LookUpField(column)
+		if field == nil || field.DBName == "" {
+			return eris.Errorf("searchable column %s does not exist on %s", column, s.Table)
+		}
+		columns[i] = field.DBName
+	}
+	table := quoteIdentifier(s.Table)
+	signature := c.searchLanguage + ":" + strings.Join(columns, ",")
+
+	var comments []sql.NullString
+	if err := db.Raw(
+		"SELECT col_description(a.attrelid, a.attnum) FROM pg_attribute a WHERE a.attrelid = ?::regclass AND a.attname = ? AND NOT a.attisdropped",
+		s.Table, SearchColumn,
+	).Scan(&comments).Error; err != nil {
+		return eris.Wrapf(err, "failed to inspect search column of %s", s.Table)
+	}
+	if len(comments) > 0 && comments[0].String == signature {
+		return nil
+	}
+
+	parts := make([]string, len(columns))
+	for i, column := range columns {
+		parts[i] = fmt.Sprintf("setweight(to_tsvector(%s::regconfig, coalesce(%s::text, '')), '%s')",
+			quoteLiteral(c.searchLanguage), quoteIdentifier(column), searchWeights[min(i, len(searchWeights)-1)])
+	}
+	statements := []string{
+		fmt.Sprintf("ALTER TABLE %s DROP COLUMN IF EXISTS %s", table, quoteIdentifier(SearchColumn)),
+		fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s tsvector GENERATED ALWAYS AS (%s) STORED",
+			table, quoteIdentifier(SearchColumn), strings.Join(parts, " || ")),
+		fmt.Sprintf("COMMENT ON COLUMN %s.%s IS %s", table, quoteIdentifier(SearchColumn), quoteLiteral(signature)),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s USING GIN (%s)",
+			quoteIdentifier("idx_"+s.Table+"_"+SearchColumn), table, quoteIdentifier(SearchColumn)),
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return eris.Wrapf(err, "failed to migrate search column of %s", s.Table)
+			}
+		}
+		return nil
+	})
+}
+
+// Search implements Repository.
+func (c *CollectionManager[TData, TResponse, TRequest]) Search(ctx context.Context, text string, query *PageQuery, preloads ...string) (*PageResult[TData], error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return c.Paginate(ctx, query, preloads...)
+	}
+	if len(c.searchable) == 0 {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "collection is not searchable")
+	}
+	tsquery := clause.Expr{SQL: "websearch_to_tsquery(?::regconfig, ?)", Vars: []any{c.searchLanguage, text}}
+	scope := func(db *gorm.DB) *gorm.DB {
+		return db.Where("? @@ ?", clause.Column{Table: clause.CurrentTable, Name: SearchColumn}, tsquery)
+	}
+	if query == nil {
+		query = &PageQuery{}
+	}
+	if len(query.Sort) > 0 || query.Cursor != "" {
+		return c.paginate(ctx, scope, query, preloads...)
+	}
+
+	page, size := max(query.Page, 1), query.Size
+	if size < 1 || size > MaxPageSize {
+		size = DefaultPageSize
+	}
+	client, err := c.session(ctx, c.client(ctx))
+	if err != nil {
+		return nil, err
+	}
+	var total int64
+	if err := client.Model(new(TData)).Scopes(scope, filterScope(query.Filters)).Count(&total).Error; err != nil {
+		return nil, eris.Wrap(err, "failed to count search results")
+	}
+	db, err := c.selectFields(client.Model(new(TData)).Scopes(scope, filterScope(query.Filters)), query.Fields, nil)
+	if err != nil {
+		return nil, err
+	}
+	db = db.Order(clause.OrderBy{Expression: clause.Expr{
+		SQL: "ts_rank(?, ?) DESC, ?",
+		Vars: []any{
+			clause.Column{Table: clause.CurrentTable, Name: SearchColumn},
+			tsquery,
+			clause.Column{Table: clause.CurrentTable, Name: "id"},
+		},
+	}})
+	includes, err := c.includePreloads(query.Include)
+	if err != nil {
+		return nil, err
+	}
+	preloads = horizon.MergeString(horizon.MergeString(c.preloads, preloads), includes)
+	for _, preload := range preloads {
+		db = db.Preload(preload)
+	}
+	var entities []*TData
+	if err := db.Offset((page - 1) * size).Limit(size).Find(&entities).Error; err != nil {
+		return nil, eris.Wrap(err, "failed to search entities")
+	}
+	return &PageResult[TData]{Items: entities, Total: total, Page: page, Size: size}, nil
+}
+
+// SearchRaw implements Repository.
+func (c *CollectionManager[TData, TResponse, TRequest]) SearchRaw(ctx context.Context, text string, query *PageQuery, preloads ...string) (*PageResult[TResponse], error) {
+	result, err := c.Search(ctx, text, query, preloads...)
+	if err != nil {
+		return nil, err
+	}
+	return c.rawPage(result), nil
+}
+
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func quoteLiteral(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
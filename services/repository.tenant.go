@@ -0,0 +1,190 @@
+package horizon_services
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/google/uuid"
+	"github.com/rotisserie/eris"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Entities with an OrganizationID and/or BranchID field (uuid.UUID or *uuid.UUID)
+// are tenant scoped: every read and write is restricted to the tenant of the
+// context and created rows are stamped with it.
+const (
+	OrganizationColumn = "organization_id"
+	BranchColumn       = "branch_id"
+)
+
+// ErrTenantRequired is returned when a tenant scoped entity is accessed with a
+// context that carries neither a tenant nor WithoutTenant
+var ErrTenantRequired = eris.New("tenant scoped repository requires a tenant in context")
+
+// Tenant identifies the organization and branch a request acts on. A zero
+// BranchID grants access to every branch of the organization.
+type Tenant struct {
+	OrganizationID uuid.UUID
+	BranchID       uuid.UUID
+}
+
+type tenantContextKey struct{}
+
+type systemContextKey struct{}
+
+const tenantScopedKey = "horizon:tenant_scoped"
+
+// WithTenant returns a context that scopes repository access to tenant
+func WithTenant(ctx context.Context, tenant Tenant) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant stored by WithTenant
+func TenantFromContext(ctx context.Context) (Tenant, bool) {
+	tenant, ok := ctx.Value(tenantContextKey{}).(Tenant)
+	return tenant, ok
+}
+
+// WithoutTenant returns a context that bypasses tenant scoping. It is meant for
+// system jobs such as purges and migrations, never for request handling.
+func WithoutTenant(ctx context.Context) context.Context {
+	return context.WithValue(ctx, systemContextKey{}, true)
+}
+
+// tenant restricts db to the tenant of ctx. It is a no-op for entities that are
+// not tenant scoped, for WithoutTenant contexts and for an already scoped db.
+func (c *CollectionManager[TData, TResponse, TRequest]) tenant(ctx context.Context, db *gorm.DB) (*gorm.DB, error) {
+	if _, scoped := db.Get(tenantScopedKey); scoped {
+		return db, nil
+	}
+	conditions, err := tenantConditions[TData](ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(conditions) == 0 {
+		return db, nil
+	}
+	return db.Scopes(func(db *gorm.DB) *gorm.DB {
+		return db.Where(clause.And(conditions...))
+	}).Set(tenantScopedKey, true).Session(&gorm.Session{}), nil
+}
+
+// stampTenant assigns the organization and branch of ctx to each entity so that
+// writes cannot move rows into another tenant
+func (c *CollectionManager[TData, TResponse, TRequest]) stampTenant(ctx context.Context, entities ...*TData) error {
+	if !isTenantScoped[TData]() || isSystemContext(ctx) {
+		return nil
+	}
+	tenant, ok := TenantFromContext(ctx)
+	if !ok {
+		return ErrTenantRequired
+	}
+	for _, entity := range entities {
+		v := reflect.ValueOf(entity).Elem()
+		setTenantField(v.FieldByName("OrganizationID"), tenant.OrganizationID)
+		if tenant.BranchID != uuid.Nil {
+			setTenantField(v.FieldByName("BranchID"), tenant.BranchID)
+		}
+	}
+	return nil
+}
+
+// tenantConditions returns the predicates restricting TData to the tenant of ctx
+func tenantConditions[TData any](ctx context.Context) ([]clause.Expression, error) {
+	if !isTenantScoped[TData]() || isSystemContext(ctx) {
+		return nil, nil
+	}
+	tenant, ok := TenantFromContext(ctx)
+	if !ok {
+		return nil, ErrTenantRequired
+	}
+	t := reflect.TypeFor[TData]()
+	var conditions []clause.Expression
+	if _, ok := t.FieldByName("OrganizationID"); ok {
+		conditions = append(conditions, clause.Eq{
+			Column: clause.Column{Table: clause.CurrentTable, Name: OrganizationColumn},
+			Value:  tenant.OrganizationID,
+		})
+	}
+	if _, ok := t.FieldByName("BranchID"); ok && tenant.BranchID != uuid.Nil {
+		conditions = append(conditions, clause.Eq{
+			Column: clause.Column{Table: clause.CurrentTable, Name: BranchColumn},
+			Value:  tenant.BranchID,
+		})
+	}
+	return conditions, nil
+}
+
+// tenantAllows reports whether entity belongs to the tenant of ctx
+func tenantAllows[TData any](ctx context.Context, entity *TData) bool {
+	if !isTenantScoped[TData]() || isSystemContext(ctx) {
+		return true
+	}
+	tenant, ok := TenantFromContext(ctx)
+	if !ok {
+		return false
+	}
+	v := reflect.ValueOf(entity).Elem()
+	if id, ok := tenantFieldValue(v.FieldByName("OrganizationID")); ok && id != tenant.OrganizationID {
+		return false
+	}
+	if id, ok := tenantFieldValue(v.FieldByName("BranchID")); ok && tenant.BranchID != uuid.Nil && id != tenant.BranchID {
+		return false
+	}
+	return true
+}
+
+// tenantKey identifies the tenant of ctx in cache keys
+func tenantKey(ctx context.Context) string {
+	if isSystemContext(ctx) {
+		return "system"
+	}
+	if tenant, ok := TenantFromContext(ctx); ok {
+		return tenant.OrganizationID.String() + ":" + tenant.BranchID.String()
+	}
+	return "public"
+}
+
+func isTenantScoped[TData any]() bool {
+	t := reflect.TypeFor[TData]()
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	_, org := t.FieldByName("OrganizationID")
+	_, branch := t.FieldByName("BranchID")
+	return org || branch
+}
+
+func isSystemContext(ctx context.Context) bool {
+	system, _ := ctx.Value(systemContextKey{}).(bool)
+	return system
+}
+
+func setTenantField(field reflect.Value, id uuid.UUID) {
+	if !field.IsValid() || !field.CanSet() {
+		return
+	}
+	switch field.Interface().(type) {
+	case uuid.UUID:
+		field.Set(reflect.ValueOf(id))
+	case *uuid.UUID:
+		field.Set(reflect.ValueOf(&id))
+	}
+}
+
+func tenantFieldValue(field reflect.Value) (uuid.UUID, bool) {
+	if !field.IsValid() {
+		return uuid.Nil, false
+	}
+	switch id := field.Interface().(type) {
+	case uuid.UUID:
+		return id, true
+	case *uuid.UUID:
+		if id == nil {
+			return uuid.Nil, true
+		}
+		return *id, true
+	}
+	return uuid.Nil, false
+}
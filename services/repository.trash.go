@@ -0,0 +1,198 @@
+package horizon_services
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lands-horizon/horizon-server/services/horizon"
+	"github.com/rotisserie/eris"
+	"gorm.io/gorm"
+)
+
+// purgeBatchSize bounds how many rows PurgeDeleted removes per transaction
+const purgeBatchSize = 100
+
+// ListDeleted implements Repository.
+func (c *CollectionManager[TData, TResponse, TRequest]) ListDeleted(ctx context.Context, query *PageQuery, preloads ...string) (*PageResult[TData], error) {
+	return c.paginate(ctx, trashScope, query, preloads...)
+}
+
+// Restore implements Repository.
+func (c *CollectionManager[TData, TResponse, TRequest]) Restore(ctx context.Context, entity *TData, preloads ...string) error {
+	return c.transaction(ctx, func(tx *gorm.DB) error {
+		return c.RestoreWithTx(ctx, tx, entity, preloads...)
+	})
+}
+
+// RestoreWithTx implements Repository.
+func (c *CollectionManager[TData, TResponse, TRequest]) RestoreWithTx(ctx context.Context, tx *gorm.DB, entity *TData, preloads ...string) error {
+	tx, err := c.session(ctx, tx)
+	if err != nil {
+		return err
+	}
+	id, err := getID(entity)
+	if err != nil {
+		return eris.Wrap(err, "failed to get entity ID for restore in transaction")
+	}
+	before := new(TData)
+	if err := tx.Scopes(trashScope).First(before, "id = ?", id).Error; err != nil {
+		return eris.Wrapf(err, "failed to load deleted entity with id %s", id)
+	}
+	if err := c.hooks.BeforeRestore.run(ctx, tx, before); err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Model(new(TData)).Where("id = ?", id).UpdateColumn("deleted_at", nil).Error; err != nil {
+		return eris.Wrapf(err, "failed to restore entity with id %s", id)
+	}
+	db := tx
+	preloads = horizon.MergeString(c.preloads, preloads)
+	for _, preload := range preloads {
+		db = db.Preload(preload)
+	}
+	if err := db.First(entity, "id = ?", id).Error; err != nil {
+		return eris.Wrapf(err, "failed to reload entity with id %s after restore", id)
+	}
+	if err := c.hooks.AfterRestore.run(ctx, tx, entity); err != nil {
+		return err
+	}
+	if err := c.audit(ctx, tx, AuditRestore, before, entity); err != nil {
+		return err
+	}
+	if err := c.broadcast(ctx, tx, EventRestored, c.restored, entity); err != nil {
+		return err
+	}
+	return nil
+}
+
+// RestoreByID implements Repository.
+func (c *CollectionManager[TData, TResponse, TRequest]) RestoreByID(ctx context.Context, id uuid.UUID) error {
+	return c.transaction(ctx, func(tx *gorm.DB) error {
+		return c.RestoreByIDWithTx(ctx, tx, id)
+	})
+}
+
+// RestoreByIDWithTx implements Repository.
+func (c *CollectionManager[TData, TResponse, TRequest]) RestoreByIDWithTx(ctx context.Context, tx *gorm.DB, id uuid.UUID) error {
+	tx, err := c.session(ctx, tx)
+	if err != nil {
+		return err
+	}
+	entity := new(TData)
+	if err := setID(entity, id); err != nil {
+		return eris.Wrap(err, "failed to set entity ID for restore in transaction")
+	}
+	return c.RestoreWithTx(ctx, tx, entity)
+}
+
+// ForceDelete implements Repository.
+func (c *CollectionManager[TData, TResponse, TRequest]) ForceDelete(ctx context.Context, entity *TData) error {
+	// A unit of work lets the force delete hooks defer the release of files and
+	// other resources outside the database until the row is gone for good
+	return c.service.Transaction(ctx, func(uow *UnitOfWork) error {
+		return c.ForceDeleteWithTx(uow.Context(), uow.Tx(), entity)
+	})
+}
+
+// ForceDeleteWithTx implements Repository.
+func (c *CollectionManager[TData, TResponse, TRequest]) ForceDeleteWithTx(ctx context.Context, tx *gorm.DB, entity *TData) error {
+	tx, err := c.session(ctx, tx)
+	if err != nil {
+		return err
+	}
+	id, err := getID(entity)
+	if err != nil {
+		return eris.Wrap(err, "failed to get entity ID for force deletion in transaction")
+	}
+	before := new(TData)
+	if err := tx.Unscoped().First(before, "id = ?", id).Error; err != nil {
+		return eris.Wrapf(err, "failed to load entity with id %s before force deletion", id)
+	}
+	if err := c.hooks.BeforeForceDelete.run(ctx, tx, before); err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Delete(new(TData), "id = ?", id).Error; err != nil {
+		return eris.Wrapf(err, "failed to force delete entity with id %s", id)
+	}
+	if err := c.hooks.AfterForceDelete.run(ctx, tx, before); err != nil {
+		return err
+	}
+	if err := c.audit(ctx, tx, AuditPurge, before, nil); err != nil {
+		return err
+	}
+	if err := c.broadcast(ctx, tx, EventForceDeleted, c.forceDeleted, before); err != nil {
+		return err
+	}
+	return nil
+}
+
+// PurgeDeleted implements Repository.
+func (c *CollectionManager[TData, TResponse, TRequest]) PurgeDeleted(ctx context.Context, retention time.Duration) (int64, error) {
+	db, err := c.session(ctx, c.client(ctx))
+	if err != nil {
+		return 0, err
+	}
+	cutoff := time.Now().UTC().Add(-retention)
+	name := collectionName[TData]()
+	var purged, failed int64
+	after := uuid.Nil
+	for {
+		var entities []*TData
+		if err := db.
+			Scopes(trashScope).
+			Where("deleted_at < ? AND id > ?", cutoff, after).
+			Order("id").
+			Limit(purgeBatchSize).
+			Find(&entities).Error; err != nil {
+			return purged, eris.Wrap(err, "failed to load expired deleted entities")
+		}
+		for _, entity := range entities {
+			id, err := getID(entity)
+			if err != nil {
+				return purged, eris.Wrap(err, "failed to get ID of expired deleted entity")
+			}
+			after = id
+			// Each row has its own transaction so that one failure does not hold back the others
+			err = c.ForceDelete(ctx, entity)
+			switch {
+			case err == nil:
+				purged++
+			case eris.Is(err, gorm.ErrRecordNotFound):
+				// purged meanwhile, e.g. by the job of another instance
+			default:
+				failed++
+				c.service.ReportError("", eris.Wrapf(err, "failed to purge deleted %s %s", name, id))
+			}
+		}
+		if len(entities) < purgeBatchSize {
+			break
+		}
+	}
+	if failed > 0 {
+		return purged, eris.Errorf("failed to purge %d expired deleted %s", failed, name)
+	}
+	return purged, nil
+}
+
+// schedulePurge registers a cron job that purges rows soft-deleted longer than retention ago
+func (c *CollectionManager[TData, TResponse, TRequest]) schedulePurge(retention time.Duration, schedule string) {
+	if c.service == nil || c.service.Cron == nil {
+		return
+	}
+	if schedule == "" {
+		schedule = "@daily"
+	}
+	name := collectionName[TData]()
+	if err := c.service.Cron.CreateJob(context.Background(), "purge-"+name, schedule, func() {
+		if _, err := c.PurgeDeleted(WithoutTenant(context.Background()), retention); err != nil {
+			c.service.ReportError("", eris.Wrapf(err, "failed to purge deleted %s", name))
+		}
+	}); err != nil {
+		c.service.ReportError("", eris.Wrapf(err, "failed to schedule purge of deleted %s", name))
+	}
+}
+
+// trashScope selects only soft-deleted rows
+func trashScope(db *gorm.DB) *gorm.DB {
+	return db.Unscoped().Where("deleted_at IS NOT NULL")
+}
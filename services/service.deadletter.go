@@ -0,0 +1,155 @@
+package horizon_services
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/lands-horizon/horizon-server/services/horizon"
+)
+
+/*
+horizon_services.RegisterDeadLetterRoutes(req, provider.Service.DeadLetters, adminOnly)
+
+GET /admin/dead-letters?topic=feedback.>&replayed=false&page=1&size=20
+*/
+
+// DeadLetterResponse is a stored dead letter as returned by the admin routes
+type DeadLetterResponse struct {
+	ID           uuid.UUID       `json:"id"`
+	Topic        string          `json:"topic"`
+	Subscription string          `json:"subscription,omitempty"`
+	EventID      *uuid.UUID      `json:"event_id,omitempty"`
+	EventType    string          `json:"event_type,omitempty"`
+	Payload      json.RawMessage `json:"payload"`
+	Error        string          `json:"error"`
+	Attempts     int             `json:"attempts"`
+	Replays      int             `json:"replays"`
+	FailedAt     time.Time       `json:"failed_at"`
+	ReplayedAt   *time.Time      `json:"replayed_at,omitempty"`
+	CreatedAt    time.Time       `json:"created_at"`
+}
+
+// RegisterDeadLetterRoutes registers the admin routes of deadLetters on service,
+// each guarded by middleware.
+//
+//	GET    /admin/dead-letters                         200 page of dead letters; supports topic, subscription, replayed, page and size
+//	GET    /admin/dead-letters/:dead_letter_id         200 dead letter
+//	POST   /admin/dead-letters/:dead_letter_id/replay  200 dead letter, after publishing it again to its topic
+//	DELETE /admin/dead-letters/:dead_letter_id         204
+//
+// Invalid ids and queries are answered with 400 and unknown ids with 404.
+func RegisterDeadLetterRoutes(service horizon.APIService, deadLetters horizon.DeadLetterService, middleware ...echo.MiddlewareFunc) {
+	service.RegisterRoute(horizon.Route{
+		Route:    "/admin/dead-letters",
+		Method:   "GET",
+		Response: "Paginated<DeadLetter>",
+		Note:     "topic (a trailing > matches the topics below it), subscription, replayed=true|false, page and size",
+	}, func(ctx echo.Context) error {
+		query := horizon.DeadLetterQuery{
+			Topic:        ctx.QueryParam("topic"),
+			Subscription: ctx.QueryParam("subscription"),
+		}
+		if raw := ctx.QueryParam("replayed"); raw != "" {
+			replayed, err := strconv.ParseBool(raw)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "invalid replayed")
+			}
+			query.Replayed = &replayed
+		}
+		for name, target := range map[string]*int{"page": &query.Page, "size": &query.Size} {
+			if raw := ctx.QueryParam(name); raw != "" {
+				value, err := strconv.Atoi(raw)
+				if err != nil || value < 1 {
+					return echo.NewHTTPError(http.StatusBadRequest, "invalid "+name)
+				}
+				*target = value
+			}
+		}
+		if query.Size == 0 {
+			query.Size = DefaultPageSize
+		}
+		query.Size = min(query.Size, MaxPageSize)
+		messages, total, err := deadLetters.List(ctx.Request().Context(), query)
+		if err != nil {
+			return crudError(ctx, err)
+		}
+		items := make([]*DeadLetterResponse, len(messages))
+		for i, message := range messages {
+			items[i] = deadLetterResponse(message)
+		}
+		return ctx.JSON(http.StatusOK, &PageResult[DeadLetterResponse]{
+			Items: items,
+			Total: total,
+			Page:  max(query.Page, 1),
+			Size:  query.Size,
+		})
+	}, middleware...)
+
+	service.RegisterRoute(horizon.Route{
+		Route:    "/admin/dead-letters/:dead_letter_id",
+		Method:   "GET",
+		Response: "DeadLetter",
+	}, func(ctx echo.Context) error {
+		id, err := crudID(ctx, "dead_letter_id")
+		if err != nil {
+			return err
+		}
+		message, err := deadLetters.Get(ctx.Request().Context(), id)
+		if err != nil {
+			return crudError(ctx, err)
+		}
+		return ctx.JSON(http.StatusOK, deadLetterResponse(message))
+	}, middleware...)
+
+	service.RegisterRoute(horizon.Route{
+		Route:    "/admin/dead-letters/:dead_letter_id/replay",
+		Method:   "POST",
+		Response: "DeadLetter",
+		Note:     "publishes the failed message again to its original topic",
+	}, func(ctx echo.Context) error {
+		id, err := crudID(ctx, "dead_letter_id")
+		if err != nil {
+			return err
+		}
+		message, err := deadLetters.Replay(ctx.Request().Context(), id)
+		if err != nil {
+			return crudError(ctx, err)
+		}
+		return ctx.JSON(http.StatusOK, deadLetterResponse(message))
+	}, middleware...)
+
+	service.RegisterRoute(horizon.Route{
+		Route:  "/admin/dead-letters/:dead_letter_id",
+		Method: "DELETE",
+	}, func(ctx echo.Context) error {
+		id, err := crudID(ctx, "dead_letter_id")
+		if err != nil {
+			return err
+		}
+		if err := deadLetters.Delete(ctx.Request().Context(), id); err != nil {
+			return crudError(ctx, err)
+		}
+		return ctx.NoContent(http.StatusNoContent)
+	}, middleware...)
+}
+
+func deadLetterResponse(message *horizon.DeadLetterMessage) *DeadLetterResponse {
+	return &DeadLetterResponse{
+		ID:           message.ID,
+		Topic:        message.Topic,
+		Subscription: message.Subscription,
+		EventID:      message.EventID,
+		EventType:    message.EventType,
+		Payload:      json.RawMessage(message.Payload),
+		Error:        message.Error,
+		Attempts:     message.Attempts,
+		Replays:      message.Replays,
+		FailedAt:     message.FailedAt,
+		ReplayedAt:   message.ReplayedAt,
+		CreatedAt:    message.CreatedAt,
+	}
+}
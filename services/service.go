@@ -2,6 +2,9 @@ package horizon_services
 
 import (
 	"context"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/lands-horizon/horizon-server/services/horizon"
@@ -14,6 +17,9 @@ type HorizonService struct {
 	Storage     horizon.StorageService
 	Cache       horizon.CacheService
 	Broker      horizon.MessageBrokerService
+	Policy      horizon.TopicPolicy
+	Outbox      horizon.OutboxService
+	DeadLetters horizon.DeadLetterService
 	Cron        horizon.SchedulerService
 	Security    horizon.SecurityService
 	OTP         horizon.OTPService
@@ -22,6 +28,14 @@ type HorizonService struct {
 	Request     horizon.APIService
 	QR          horizon.QRService
 	Validator   *validator.Validate
+
+	runHooks []func(ctx context.Context) error
+
+	// auditing is set by the repositories recording an audit log, see RepositoryParams.Audit
+	auditing bool
+
+	errorMutex sync.Mutex
+	onError    horizon.ErrorHandler
 }
 
 type HorizonServiceConfig struct {
@@ -30,6 +44,8 @@ type HorizonServiceConfig struct {
 	StorageConfig        *StorageServiceConfig
 	CacheConfig          *CacheServiceConfig
 	BrokerConfig         *BrokerServiceConfig
+	TopicPolicy          horizon.TopicPolicy
+	OutboxConfig         *OutboxServiceConfig
 	SecurityConfig       *SecurityServiceConfig
 	OTPServiceConfig     *OTPServiceConfig
 	SMSServiceConfig     *SMSServiceConfig
@@ -52,6 +68,7 @@ func NewHorizonService(cfg HorizonServiceConfig) *HorizonService {
 			cfg.RequestServiceConfig.MetricsPort,
 			cfg.RequestServiceConfig.ClientURL,
 			cfg.RequestServiceConfig.ClientName,
+			cfg.RequestServiceConfig.RequestTimeout,
 		)
 	} else {
 		service.Request = horizon.NewHorizonAPIService(
@@ -59,6 +76,7 @@ func NewHorizonService(cfg HorizonServiceConfig) *HorizonService {
 			service.Environment.GetInt("APP_METRICS_PORT", 8001),
 			service.Environment.GetString("APP_CLIENT_URL", "http://localhost:3000"),
 			service.Environment.GetString("APP_CLIENT_NAME", "test-client"),
+			service.Environment.GetDuration("APP_REQUEST_TIMEOUT", 30*time.Second),
 		)
 	}
 	if cfg.SecurityConfig != nil {
@@ -136,17 +154,99 @@ func NewHorizonService(cfg HorizonServiceConfig) *HorizonService {
 		)
 	}
 
-	if cfg.BrokerConfig != nil {
+	if (cfg.BrokerConfig != nil && cfg.BrokerConfig.Memory) || (cfg.BrokerConfig == nil && service.Environment.GetBool("BROKER_MEMORY", false)) {
+		service.Broker = horizon.NewMemoryMessageBroker(horizon.DeliverAsync)
+	} else if cfg.BrokerConfig != nil {
 		service.Broker = horizon.NewHorizonMessageBroker(
 			cfg.BrokerConfig.Host,
 			cfg.BrokerConfig.Port,
+			horizon.BrokerOptions{
+				Name:                cfg.BrokerConfig.Name,
+				Token:               cfg.BrokerConfig.Token,
+				Username:            cfg.BrokerConfig.Username,
+				Password:            cfg.BrokerConfig.Password,
+				NKeySeedFile:        cfg.BrokerConfig.NKeySeedFile,
+				CredentialsFile:     cfg.BrokerConfig.CredentialsFile,
+				TLS:                 cfg.BrokerConfig.TLS,
+				TLSCAFile:           cfg.BrokerConfig.TLSCAFile,
+				TLSCertFile:         cfg.BrokerConfig.TLSCertFile,
+				TLSKeyFile:          cfg.BrokerConfig.TLSKeyFile,
+				MaxReconnects:       cfg.BrokerConfig.MaxReconnects,
+				ReconnectWait:       cfg.BrokerConfig.ReconnectWait,
+				MaxReconnectWait:    cfg.BrokerConfig.MaxReconnectWait,
+				ReconnectBufferSize: cfg.BrokerConfig.ReconnectBufferSize,
+				ConnectTimeout:      cfg.BrokerConfig.ConnectTimeout,
+				PingInterval:        cfg.BrokerConfig.PingInterval,
+			},
+			cfg.BrokerConfig.Streams...,
 		)
 	} else {
+		var streams []horizon.BrokerStream
+		for _, subject := range strings.Split(service.Environment.GetString("NATS_STREAMS", ""), ",") {
+			if subject = strings.TrimSpace(subject); subject != "" {
+				streams = append(streams, horizon.BrokerStream{
+					Subjects: []string{subject},
+					MaxAge:   service.Environment.GetDuration("NATS_STREAM_MAX_AGE", 7*24*time.Hour),
+				})
+			}
+		}
 		service.Broker = horizon.NewHorizonMessageBroker(
 			service.Environment.GetString("NATS_HOST", "localhost"),
 			service.Environment.GetInt("NATS_CLIENT_PORT", 4222),
+			horizon.BrokerOptions{
+				Name:                service.Environment.GetString("APP_NAME", ""),
+				Token:               service.Environment.GetString("NATS_TOKEN", ""),
+				Username:            service.Environment.GetString("NATS_USERNAME", ""),
+				Password:            service.Environment.GetString("NATS_PASSWORD", ""),
+				NKeySeedFile:        service.Environment.GetString("NATS_NKEY_SEED_FILE", ""),
+				CredentialsFile:     service.Environment.GetString("NATS_CREDENTIALS_FILE", ""),
+				TLS:                 service.Environment.GetBool("NATS_TLS", false),
+				TLSCAFile:           service.Environment.GetString("NATS_TLS_CA_FILE", ""),
+				TLSCertFile:         service.Environment.GetString("NATS_TLS_CERT_FILE", ""),
+				TLSKeyFile:          service.Environment.GetString("NATS_TLS_KEY_FILE", ""),
+				MaxReconnects:       service.Environment.GetInt("NATS_MAX_RECONNECTS", -1),
+				ReconnectWait:       service.Environment.GetDuration("NATS_RECONNECT_WAIT", 2*time.Second),
+				MaxReconnectWait:    service.Environment.GetDuration("NATS_MAX_RECONNECT_WAIT", 30*time.Second),
+				ReconnectBufferSize: service.Environment.GetInt("NATS_RECONNECT_BUFFER_SIZE", 8*1024*1024),
+				ConnectTimeout:      service.Environment.GetDuration("NATS_CONNECT_TIMEOUT", 2*time.Second),
+				PingInterval:        service.Environment.GetDuration("NATS_PING_INTERVAL", 2*time.Minute),
+			},
+			streams...,
 		)
 	}
+	service.Request.HealthCheck("broker", service.Broker.Ping)
+	// Clients only reach the topics the policy declares; broker calls made for a
+	// client carry its claims, see horizon.WithBrokerClaims
+	if cfg.TopicPolicy != nil {
+		service.Policy = cfg.TopicPolicy
+		service.Broker = horizon.NewPolicyMessageBroker(service.Broker, cfg.TopicPolicy)
+	}
+	// The outbox lives in the database, so services without one publish directly
+	databaseConfigured := cfg.SQLConfig != nil || service.Environment.GetString("DATABASE_URL", "") != ""
+	if databaseConfigured {
+		if cfg.OutboxConfig != nil {
+			service.Outbox = horizon.NewHorizonOutbox(
+				service.Database,
+				service.Broker,
+				cfg.OutboxConfig.Interval,
+				cfg.OutboxConfig.BatchSize,
+				cfg.OutboxConfig.MaxAttempts,
+				cfg.OutboxConfig.Retention,
+			)
+		} else {
+			service.Outbox = horizon.NewHorizonOutbox(
+				service.Database,
+				service.Broker,
+				service.Environment.GetDuration("OUTBOX_INTERVAL", 2*time.Second),
+				service.Environment.GetInt("OUTBOX_BATCH_SIZE", 100),
+				service.Environment.GetInt("OUTBOX_MAX_ATTEMPTS", 10),
+				service.Environment.GetDuration("OUTBOX_RETENTION", 24*time.Hour),
+			)
+		}
+	}
+	if databaseConfigured {
+		service.DeadLetters = horizon.NewHorizonDeadLetters(service.Database, service.Broker)
+	}
 	if cfg.OTPServiceConfig != nil {
 		service.OTP = horizon.NewHorizonOTP(
 			cfg.OTPServiceConfig.Secret,
@@ -231,6 +331,36 @@ func (h *HorizonService) Run(ctx context.Context) error {
 			return err
 		}
 	}
+	if h.auditing {
+		if h.Database == nil {
+			return eris.New("audited repositories require a database service")
+		}
+		if err := h.Database.Client().AutoMigrate(&AuditLog{}); err != nil {
+			return eris.Wrap(err, "failed to migrate audit table")
+		}
+	}
+	if h.Outbox != nil {
+		if h.Database == nil {
+			return eris.New("outbox service requires a database service")
+		}
+		if h.Broker == nil {
+			return eris.New("outbox service requires a broker service")
+		}
+		if err := h.Outbox.Run(ctx); err != nil {
+			return err
+		}
+	}
+	if h.DeadLetters != nil {
+		if h.Database == nil {
+			return eris.New("dead letter service requires a database service")
+		}
+		if h.Broker == nil {
+			return eris.New("dead letter service requires a broker service")
+		}
+		if err := h.DeadLetters.Run(ctx); err != nil {
+			return err
+		}
+	}
 	if h.OTP != nil {
 		if h.Cache == nil {
 			return eris.New("OTP service requires a cache service")
@@ -249,6 +379,11 @@ func (h *HorizonService) Run(ctx context.Context) error {
 			return err
 		}
 	}
+	for _, hook := range h.runHooks {
+		if err := hook(ctx); err != nil {
+			return err
+		}
+	}
 	if h.Request != nil {
 		if err := h.Request.Run(ctx); err != nil {
 			return err
@@ -257,6 +392,41 @@ func (h *HorizonService) Run(ctx context.Context) error {
 	return nil
 }
 
+// OnRun registers a hook that Run calls once every service is started,
+// before the API server begins accepting requests
+func (h *HorizonService) OnRun(hook func(ctx context.Context) error) {
+	h.runHooks = append(h.runHooks, hook)
+}
+
+// OnError replaces the hook receiving the errors of background work: broker
+// handlers, the outbox relay, scheduled purges and cache invalidation. They are
+// printed by default.
+func (h *HorizonService) OnError(handler horizon.ErrorHandler) {
+	if handler == nil {
+		handler = horizon.PrintError
+	}
+	h.errorMutex.Lock()
+	h.onError = handler
+	h.errorMutex.Unlock()
+	if h.Broker != nil {
+		h.Broker.OnError(handler)
+	}
+	if h.Outbox != nil {
+		h.Outbox.OnError(handler)
+	}
+}
+
+// ReportError hands err to the hook set by OnError, for background work that has no caller to return it to
+func (h *HorizonService) ReportError(topic string, err error) {
+	h.errorMutex.Lock()
+	onError := h.onError
+	h.errorMutex.Unlock()
+	if onError == nil {
+		onError = horizon.PrintError
+	}
+	onError(topic, err)
+}
+
 func (h *HorizonService) Stop(ctx context.Context) error {
 	if h.Request != nil {
 		if err := h.Request.Stop(ctx); err != nil {
@@ -279,6 +449,16 @@ func (h *HorizonService) Stop(ctx context.Context) error {
 			return err
 		}
 	}
+	if h.Outbox != nil {
+		if err := h.Outbox.Stop(ctx); err != nil {
+			return err
+		}
+	}
+	if h.DeadLetters != nil {
+		if err := h.DeadLetters.Stop(ctx); err != nil {
+			return err
+		}
+	}
 	if h.Broker != nil {
 		if err := h.Broker.Stop(ctx); err != nil {
 			return err
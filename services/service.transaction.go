@@ -0,0 +1,128 @@
+package horizon_services
+
+import (
+	"context"
+	"database/sql"
+	"math/rand/v2"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/rotisserie/eris"
+	"gorm.io/gorm"
+)
+
+/*
+err := provider.Service.Transaction(ctx, func(uow *horizon_services.UnitOfWork) error {
+	if err := feedback.Manager.Create(uow.Context(), entry); err != nil {
+		return err
+	}
+	return uow.Transaction(func(uow *horizon_services.UnitOfWork) error {
+		return media.Manager.UpdateFieldsWithTx(uow.Context(), uow.Tx(), mediaID, fields)
+	})
+})
+*/
+
+// TransactionAttempts bounds how many times Transaction runs fn when the
+// database reports a serialization failure or a deadlock
+const TransactionAttempts = 3
+
+// UnitOfWork is an open transaction shared by every repository used within
+// HorizonService.Transaction. Repository methods called with Context() join it,
+// so the Tx() variants are only needed for raw queries. Broadcasts are written to
+// the outbox in the transaction and relayed only once it commits. A UnitOfWork
+// must not be used from several goroutines at once.
+type UnitOfWork struct {
+	ctx         context.Context
+	tx          *gorm.DB
+	afterCommit []func()
+}
+
+type unitOfWorkContextKey struct{}
+
+// UnitOfWorkFromContext returns the unit of work a context was created by
+func UnitOfWorkFromContext(ctx context.Context) (*UnitOfWork, bool) {
+	uow, ok := ctx.Value(unitOfWorkContextKey{}).(*UnitOfWork)
+	return uow, ok
+}
+
+// Transaction runs fn in a unit of work and commits it when fn returns nil. Called
+// with a context that already belongs to a unit of work it opens a savepoint in it
+// instead. fn is run again, in a fresh transaction, when the commit fails on a
+// serialization failure or deadlock, so it must not have side effects outside the
+// database other than those registered with AfterCommit.
+func (h *HorizonService) Transaction(ctx context.Context, fn func(uow *UnitOfWork) error, opts ...*sql.TxOptions) error {
+	if parent, ok := UnitOfWorkFromContext(ctx); ok {
+		return parent.Transaction(fn)
+	}
+	if h.Database == nil {
+		return eris.New("transaction requires a database service")
+	}
+	for attempt := 1; ; attempt++ {
+		uow := &UnitOfWork{}
+		err := h.Database.Client().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			uow.tx = tx
+			uow.ctx = context.WithValue(ctx, unitOfWorkContextKey{}, uow)
+			return fn(uow)
+		}, opts...)
+		if err == nil {
+			if h.Outbox != nil {
+				h.Outbox.Notify()
+			}
+			for _, callback := range uow.afterCommit {
+				callback()
+			}
+			return nil
+		}
+		if attempt >= TransactionAttempts || !isSerializationFailure(err) {
+			return err
+		}
+		backoff := time.Duration(attempt*attempt)*25*time.Millisecond + time.Duration(rand.IntN(25))*time.Millisecond
+		select {
+		case <-ctx.Done():
+			return eris.Wrap(ctx.Err(), "transaction retry cancelled")
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// Context returns the context to pass to repositories so that they join the unit of work
+func (u *UnitOfWork) Context() context.Context {
+	return u.ctx
+}
+
+// Tx returns the transaction of the unit of work
+func (u *UnitOfWork) Tx() *gorm.DB {
+	return u.tx
+}
+
+// Transaction runs fn under a savepoint. An error from fn rolls back to the
+// savepoint and discards the AfterCommit callbacks fn registered, leaving the
+// rest of the unit of work intact.
+func (u *UnitOfWork) Transaction(fn func(uow *UnitOfWork) error) error {
+	nested := &UnitOfWork{}
+	if err := u.tx.Transaction(func(tx *gorm.DB) error {
+		nested.tx = tx
+		nested.ctx = context.WithValue(u.ctx, unitOfWorkContextKey{}, nested)
+		return fn(nested)
+	}); err != nil {
+		return err
+	}
+	u.afterCommit = append(u.afterCommit, nested.afterCommit...)
+	return nil
+}
+
+// AfterCommit registers callback to run once the outermost transaction commits.
+// Callbacks are dropped when it rolls back.
+func (u *UnitOfWork) AfterCommit(callback func()) {
+	u.afterCommit = append(u.afterCommit, callback)
+}
+
+// isSerializationFailure reports whether err is a PostgreSQL serialization
+// failure or deadlock, after which the transaction can safely be retried
+func isSerializationFailure(err error) bool {
+	var pgErr *pgconn.PgError
+	if !eris.As(err, &pgErr) {
+		return false
+	}
+	return pgErr.Code == "40001" || pgErr.Code == "40P01"
+}
@@ -0,0 +1,39 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/lands-horizon/horizon-server/services/horizon"
+)
+
+func (c *Controller) BroadcastController() {
+	req := c.provider.Service.Request
+
+	// scope has already read the claims of the user and user organization tokens
+	gateway := horizon.NewBrokerGateway(c.provider.Service.Broker, req.Origins(), func(ctx echo.Context) (horizon.TopicPermission, error) {
+		claims, ok := horizon.BrokerClaimsFromContext(c.actor(ctx))
+		if !ok {
+			return nil, echo.NewHTTPError(http.StatusUnauthorized, "authentication required")
+		}
+		return c.provider.Service.Policy.Permission(claims), nil
+	})
+
+	req.RegisterRoute(horizon.Route{
+		Route:    "/broadcast/events",
+		Method:   "GET",
+		Request:  "?topic=feedback.update.<id>&topic=...",
+		Response: "text/event-stream",
+		Note:     "Server-Sent Events of the given broker topics; requires the user token and topics the topic policy allows",
+		Stream:   true,
+	}, gateway.Events)
+
+	req.RegisterRoute(horizon.Route{
+		Route:    "/broadcast/ws",
+		Method:   "GET",
+		Request:  `{"action":"subscribe"|"unsubscribe"|"publish","topic":"feedback.update.<id>","data":...}`,
+		Response: "GatewayFrame",
+		Note:     "WebSocket relaying the broker topics subscribed to; requires the user token and topics the topic policy allows",
+		Stream:   true,
+	}, gateway.WebSocket)
+}
@@ -0,0 +1,14 @@
+package controller
+
+import (
+	horizon_services "github.com/lands-horizon/horizon-server/services"
+)
+
+// DeadLetterController lets administrators inspect and replay the broker
+// messages whose handlers kept failing. Dead letters are only kept with a database.
+func (c *Controller) DeadLetterController() {
+	if c.provider.Service.DeadLetters == nil {
+		return
+	}
+	horizon_services.RegisterDeadLetterRoutes(c.provider.Service.Request, c.provider.Service.DeadLetters, c.admin)
+}
@@ -1,11 +1,10 @@
 package controller
 
 import (
-	"context"
 	"net/http"
-	"time"
 
 	"github.com/labstack/echo/v4"
+	horizon_services "github.com/lands-horizon/horizon-server/services"
 	"github.com/lands-horizon/horizon-server/services/horizon"
 	"github.com/lands-horizon/horizon-server/src/model"
 )
@@ -13,110 +12,81 @@ import (
 func (c *Controller) FeedbackController() {
 	req := c.provider.Service.Request
 
-	req.RegisterRoute(horizon.Route{
+	horizon_services.RegisterCRUDRoutes(req, c.feedback.Manager, horizon_services.CRUDRoutes[model.Feedback, model.FeedbackRequest]{
 		Route:    "/feedback",
-		Method:   "GET",
-		Response: "TFeedback[]",
-	}, func(ctx echo.Context) error {
-		feedback, err := c.feedback.Manager.ListRaw(context.Background())
-		if err != nil {
-			return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
-		}
-		return ctx.JSON(http.StatusOK, feedback)
+		Param:    "feedback_id",
+		Resource: "TFeedback",
+		Map: func(ctx echo.Context, req *model.FeedbackRequest, feedback *model.Feedback) error {
+			feedback.Email = req.Email
+			feedback.Description = req.Description
+			feedback.FeedbackType = req.FeedbackType
+			feedback.MediaID = req.MediaID
+			return nil
+		},
+		Export: horizon_services.CRUDRoute{Middleware: []echo.MiddlewareFunc{c.admin}},
+		Import: horizon_services.CRUDRoute{Middleware: []echo.MiddlewareFunc{c.admin}},
 	})
 
 	req.RegisterRoute(horizon.Route{
-		Route:    "/feedback/:feedback_id",
+		Route:    "/feedback/trash",
 		Method:   "GET",
-		Response: "TFeedback",
+		Response: "Paginated<TFeedback>",
+		Note:     "soft-deleted feedback; supports the same query parameters as /feedback",
 	}, func(ctx echo.Context) error {
-		context := context.Background()
-		feedbackId, err := horizon.EngineUUIDParam(ctx, "feedback_id")
+		query, err := c.feedback.Manager.Query(ctx)
 		if err != nil {
 			return err
 		}
-		feedback, err := c.feedback.Manager.GetByIDRaw(context, *feedbackId)
-		if err != nil {
-			return ctx.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
-		}
-		return ctx.JSON(http.StatusOK, feedback)
-	})
-
-	req.RegisterRoute(horizon.Route{
-		Route:    "/feedback",
-		Method:   "POST",
-		Request:  "TFeedback",
-		Response: "TFeedback",
-	}, func(ctx echo.Context) error {
-		context := context.Background()
-		req, err := c.feedback.Manager.Validate(ctx)
+		result, err := c.feedback.Manager.ListDeleted(c.actor(ctx), query)
 		if err != nil {
-			return err
-		}
-		model := &model.Feedback{
-			Email:        req.Email,
-			Description:  req.Description,
-			FeedbackType: req.FeedbackType,
-			MediaID:      req.MediaID,
-			CreatedAt:    time.Now().UTC(),
-			UpdatedAt:    time.Now().UTC(),
-		}
-		if err := c.feedback.Manager.Create(context, model); err != nil {
 			return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 		}
-		return ctx.JSON(http.StatusCreated, c.feedback.Manager.ToModel(model))
-	})
+		return ctx.JSON(http.StatusOK, horizon_services.PageResult[model.FeedbackResponse]{
+			Items:      c.feedback.Manager.ToModels(result.Items),
+			Total:      result.Total,
+			Page:       result.Page,
+			Size:       result.Size,
+			NextCursor: result.NextCursor,
+		})
+	}, c.admin)
 
 	req.RegisterRoute(horizon.Route{
-		Route:    "/feedback/:feedback_id",
-		Method:   "PUT",
-		Request:  "TFeedback",
+		Route:    "/feedback/:feedback_id/restore",
+		Method:   "POST",
 		Response: "TFeedback",
 	}, func(ctx echo.Context) error {
-		context := context.Background()
-
+		context := c.actor(ctx)
 		feedbackId, err := horizon.EngineUUIDParam(ctx, "feedback_id")
 		if err != nil {
 			return err
 		}
-
-		req, err := c.feedback.Manager.Validate(ctx)
-		if err != nil {
-			return err
+		if err := c.feedback.Manager.RestoreByID(context, *feedbackId); err != nil {
+			return recordError(ctx, err)
 		}
-
 		feedback, err := c.feedback.Manager.GetByID(context, *feedbackId)
 		if err != nil {
 			return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 		}
-		feedback.Email = req.Email
-		feedback.Description = req.Description
-		feedback.FeedbackType = req.FeedbackType
-		feedback.UpdatedAt = time.Now().UTC()
-		feedback.MediaID = req.MediaID
-		if err := c.feedback.Manager.Update(context, feedback); err != nil {
-			return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
-		}
-		return ctx.JSON(http.StatusCreated, c.feedback.Manager.ToModel(feedback))
-	})
+		ctx.Response().Header().Set("ETag", c.feedback.Manager.ETag(feedback))
+		return ctx.JSON(http.StatusOK, c.feedback.Manager.ToModel(feedback))
+	}, c.admin)
 
 	req.RegisterRoute(horizon.Route{
-		Route:  "/feedback/:feedback_id",
+		Route:  "/feedback/:feedback_id/purge",
 		Method: "DELETE",
+		Note:   "permanently removes the feedback, deleted or not",
 	}, func(ctx echo.Context) error {
-		context := context.Background()
+		context := c.actor(ctx)
 		feedbackId, err := horizon.EngineUUIDParam(ctx, "feedback_id")
 		if err != nil {
 			return err
 		}
-		feedback, err := c.feedback.Manager.GetByID(context, *feedbackId)
-		if err != nil {
-			return ctx.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
-		}
-		if err := c.feedback.Manager.DeleteByID(context, feedback.ID); err != nil {
-			return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		feedback := &model.Feedback{ID: *feedbackId}
+		if err := c.feedback.Manager.ForceDelete(context, feedback); err != nil {
+			return recordError(ctx, err)
 		}
 		return ctx.NoContent(http.StatusNoContent)
-	})
+	}, c.admin)
 
+	c.feedback.Manager.RegisterHistoryRoute("/feedback/:feedback_id/history", "feedback_id")
 }
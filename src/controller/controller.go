@@ -1,9 +1,19 @@
 package controller
 
 import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	horizon_services "github.com/lands-horizon/horizon-server/services"
+	"github.com/lands-horizon/horizon-server/services/horizon"
 	"github.com/lands-horizon/horizon-server/src"
 	"github.com/lands-horizon/horizon-server/src/cooperative_tokens"
 	"github.com/lands-horizon/horizon-server/src/model"
+	"github.com/rotisserie/eris"
+	"gorm.io/gorm"
 )
 
 type Controller struct {
@@ -49,7 +59,106 @@ func NewController(
 	}, nil
 }
 
+// actor returns the request context, which carries the actor and tenant set by scope
+// and is cancelled when the client goes away or the request times out
+func (c *Controller) actor(ctx echo.Context) context.Context {
+	return ctx.Request().Context()
+}
+
+// detached returns the request context without its cancellation, for writes that
+// must land even when the client disconnects, such as marking a failed upload
+func (c *Controller) detached(ctx echo.Context) context.Context {
+	return context.WithoutCancel(ctx.Request().Context())
+}
+
+// system returns a context carrying only the trace of the request, for messages
+// the server publishes on its own behalf rather than under the user's claims
+func (c *Controller) system(ctx echo.Context) context.Context {
+	system := context.Background()
+	if trace, ok := horizon.TraceFromContext(ctx.Request().Context()); ok {
+		system = horizon.WithTrace(system, trace)
+	}
+	return system
+}
+
+// scope attributes repository changes of the request to the signed in user and
+// restricts them to the organization and branch of their user organization token.
+// Broker calls made for the request are checked against the topic policy with
+// the same claims.
+func (c *Controller) scope(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		scoped := ctx.Request().Context()
+		var claims horizon.BrokerClaims
+		if cookie, err := ctx.Cookie(c.userToken.Token.Name); err == nil && cookie.Value != "" {
+			if claim, err := c.userToken.Token.VerifyToken(scoped, cookie.Value); err == nil {
+				scoped = horizon_services.WithActor(scoped, claim.UserID)
+				claims.UserID = claim.UserID
+				claims.Admin = c.isAdmin(claim.UserID)
+			}
+		}
+		if cookie, err := ctx.Cookie(c.userOrganizationToken.Token.Name); err == nil && cookie.Value != "" {
+			// An organization token counts only next to the user token it was issued to
+			if claim, err := c.userOrganizationToken.Token.VerifyToken(scoped, cookie.Value); err == nil && claims.UserID != "" && claim.UserID == claims.UserID {
+				claims.OrganizationID = claim.OrganizationID
+				claims.BranchID = claim.BranchID
+				organizationID, orgErr := uuid.Parse(claim.OrganizationID)
+				branchID, branchErr := uuid.Parse(claim.BranchID)
+				if orgErr == nil {
+					if branchErr != nil {
+						branchID = uuid.Nil
+					}
+					scoped = horizon_services.WithTenant(scoped, horizon_services.Tenant{
+						OrganizationID: organizationID,
+						BranchID:       branchID,
+					})
+				}
+			}
+		}
+		if claims.UserID != "" {
+			scoped = horizon.WithBrokerClaims(scoped, claims)
+		}
+		ctx.SetRequest(ctx.Request().WithContext(scoped))
+		return next(ctx)
+	}
+}
+
+// admin lets through the signed in administrators
+func (c *Controller) admin(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		claims, ok := horizon.BrokerClaimsFromContext(c.actor(ctx))
+		if !ok {
+			return echo.NewHTTPError(http.StatusUnauthorized, "authentication required")
+		}
+		if !claims.Admin {
+			return echo.NewHTTPError(http.StatusForbidden, "administrators only")
+		}
+		return next(ctx)
+	}
+}
+
+// recordError answers 404 when err is caused by a missing row and 500 otherwise
+func recordError(ctx echo.Context, err error) error {
+	if eris.Is(err, gorm.ErrRecordNotFound) {
+		return ctx.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	}
+	return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+}
+
+// isAdmin reports whether userID is listed in APP_ADMIN_USERS, a comma separated
+// list of user ids
+func (c *Controller) isAdmin(userID string) bool {
+	for _, admin := range strings.Split(c.provider.Service.Environment.GetString("APP_ADMIN_USERS", ""), ",") {
+		if admin = strings.TrimSpace(admin); admin != "" && admin == userID {
+			return true
+		}
+	}
+	return false
+}
+
 func (c *Controller) Routes() {
+	c.provider.Service.Request.Client().Use(c.scope)
 	c.MediaController()
 	c.FeedbackController()
+	c.BroadcastController()
+	c.DeadLetterController()
 }
@@ -1,11 +1,12 @@
 package controller
 
 import (
-	"context"
+	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/labstack/echo/v4"
+	horizon_services "github.com/lands-horizon/horizon-server/services"
 	"github.com/lands-horizon/horizon-server/services/horizon"
 	"github.com/lands-horizon/horizon-server/src/model"
 )
@@ -14,34 +15,18 @@ func (c *Controller) MediaController() {
 
 	req := c.provider.Service.Request
 
-	req.RegisterRoute(horizon.Route{
+	horizon_services.RegisterCRUDRoutes(req, c.media.Manager, horizon_services.CRUDRoutes[model.Media, model.MediaRequest]{
 		Route:    "/media",
-		Method:   "GET",
-		Response: "TMedia[]",
-	}, func(ctx echo.Context) error {
-		media, err := c.media.Manager.ListRaw(context.Background())
-		if err != nil {
-			return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
-		}
-		return ctx.JSON(http.StatusOK, media)
-	})
-
-	req.RegisterRoute(horizon.Route{
-		Route:    "/media/:media_id",
-		Method:   "GET",
-		Response: "TMedia",
-	}, func(ctx echo.Context) error {
-		context := context.Background()
-		mediaId, err := horizon.EngineUUIDParam(ctx, "media_id")
-		if err != nil {
-			return err
-		}
-
-		media, err := c.media.Manager.GetByIDRaw(context, *mediaId)
-		if err != nil {
-			return ctx.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
-		}
-		return ctx.JSON(http.StatusOK, media)
+		Param:    "media_id",
+		Resource: "TMedia",
+		Map: func(ctx echo.Context, req *model.MediaRequest, media *model.Media) error {
+			media.FileName = req.FileName
+			return nil
+		},
+		Update: horizon_services.CRUDRoute{Note: "This only change file name"},
+		Create: horizon_services.CRUDRoute{Disabled: true},
+		Delete: horizon_services.CRUDRoute{Disabled: true},
+		Import: horizon_services.CRUDRoute{Disabled: true},
 	})
 
 	req.RegisterRoute(horizon.Route{
@@ -51,7 +36,7 @@ func (c *Controller) MediaController() {
 		Response: "TMedia",
 		Note:     "this route is used for uploading files",
 	}, func(ctx echo.Context) error {
-		context := context.Background()
+		context := c.actor(ctx)
 		file, err := ctx.FormFile("file")
 		if err != nil {
 			return echo.NewHTTPError(http.StatusBadRequest, "missing file")
@@ -71,16 +56,26 @@ func (c *Controller) MediaController() {
 		if err := c.media.Manager.Create(context, initial); err != nil {
 			return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 		}
+		detached := c.detached(ctx)
+
+		// Progress is only relayed to the clients following the upload; the row is
+		// written once the upload ends. The server publishes it, not the uploader.
+		progressContext := c.system(ctx)
+		progressTopic := fmt.Sprintf("media.progress.%s", initial.ID)
+		reported := int64(-1)
 		storage, err := c.provider.Service.Storage.UploadFromHeader(context, file, func(progress, total int64, storage *horizon.Storage) {
-			_ = c.media.Manager.Update(context, &model.Media{
-				ID:        initial.ID,
-				Progress:  progress,
-				Status:    "progress",
-				UpdatedAt: time.Now().UTC(),
+			if progress == reported {
+				return
+			}
+			reported = progress
+			_ = c.provider.Service.Broker.Publish(progressContext, progressTopic, map[string]any{
+				"id":       initial.ID,
+				"progress": progress,
+				"status":   "progress",
 			})
 		})
 		if err != nil {
-			_ = c.media.Manager.Update(context, &model.Media{
+			_ = c.media.Manager.Update(detached, &model.Media{
 				ID:        initial.ID,
 				Status:    "error",
 				UpdatedAt: time.Now().UTC(),
@@ -105,39 +100,11 @@ func (c *Controller) MediaController() {
 		return ctx.JSON(http.StatusCreated, c.media.Manager.ToModel(completed))
 	})
 
-	req.RegisterRoute(horizon.Route{
-		Route:    "/media/:media_id",
-		Method:   "PUT",
-		Request:  "TMedia",
-		Response: "TMedia",
-		Note:     "This only change file name",
-	}, func(ctx echo.Context) error {
-		context := context.Background()
-		mediaId, err := horizon.EngineUUIDParam(ctx, "media_id")
-		if err != nil {
-			return err
-		}
-		req, err := c.media.Manager.Validate(ctx)
-		if err != nil {
-			return err
-		}
-		model := &model.Media{
-			FileName:  req.FileName,
-			UpdatedAt: time.Now().UTC(),
-		}
-
-		if err := c.media.Manager.UpdateByID(context, *mediaId, model); err != nil {
-			return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
-		}
-		return ctx.JSON(http.StatusCreated, c.media.Manager.ToModel(model))
-
-	})
-
 	req.RegisterRoute(horizon.Route{
 		Route:  "/media/:media_id",
 		Method: "DELETE",
 	}, func(ctx echo.Context) error {
-		context := context.Background()
+		context := c.actor(ctx)
 		mediaId, err := horizon.EngineUUIDParam(ctx, "media_id")
 		if err != nil {
 			return err
@@ -146,23 +113,16 @@ func (c *Controller) MediaController() {
 		if err != nil {
 			return ctx.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
 		}
-
-		if err := c.provider.Service.Storage.DeleteFile(context, &horizon.Storage{
-			FileName:   media.FileName,
-			FileSize:   media.FileSize,
-			FileType:   media.FileType,
-			StorageKey: media.StorageKey,
-			URL:        media.URL,
-			BucketName: media.BucketName,
-			Status:     "delete",
-		}); err != nil {
-			return ctx.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		if err := c.media.Manager.Precondition(ctx, media); err != nil {
+			return ctx.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
 		}
 
+		// The stored file is removed once the media is purged, see NewMediaCollection
 		if err := c.media.Manager.DeleteByID(context, *mediaId); err != nil {
 			return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 		}
 		return ctx.NoContent(http.StatusNoContent)
 	})
 
+	c.media.Manager.RegisterHistoryRoute("/media/:media_id/history", "media_id")
 }
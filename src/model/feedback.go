@@ -17,6 +17,7 @@ type (
 		CreatedAt time.Time      `gorm:"not null;default:now()"`
 		UpdatedAt time.Time      `gorm:"not null;default:now()"`
 		DeletedAt gorm.DeletedAt `gorm:"index"`
+		Version   int64          `gorm:"not null;default:1"`
 
 		Email        string     `gorm:"type:varchar(255)"`
 		Description  string     `gorm:"type:text"`
@@ -34,6 +35,7 @@ type (
 		Media        *MediaResponse `json:"media,omitempty"`
 		CreatedAt    string         `json:"createdAt"`
 		UpdatedAt    string         `json:"updatedAt"`
+		Version      int64          `json:"version"`
 	}
 
 	FeedbackRequest struct {
@@ -51,8 +53,28 @@ type (
 
 func NewFeedbackCollection(provider *src.Provider, media *MediaCollection) (*FeedbackCollection, error) {
 	manager := horizon_services.NewRepository(horizon_services.RepositoryParams[Feedback, FeedbackResponse, FeedbackRequest]{
-		Preloads: nil,
-		Service:  provider.Service,
+		Preloads:    nil,
+		Audit:       true,
+		AuditRedact: []string{"email"},
+		Retention:   provider.Service.Environment.GetDuration("TRASH_RETENTION", 30*24*time.Hour),
+		Cache: &horizon_services.CacheParams{
+			TTL:     10 * time.Minute,
+			ListTTL: time.Minute,
+			Topics:  []string{"feedback.create", "feedback.update", "feedback.delete", "feedback.restore", "feedback.purge"},
+		},
+		Service:    provider.Service,
+		Sortable:   []string{"created_at", "updated_at", "email", "feedback_type"},
+		Filterable: []string{"email", "feedback_type", "media_id", "created_at", "updated_at"},
+		Searchable: []string{"description", "email"},
+		Includable: []string{"media"},
+		Entity: func(req *FeedbackRequest) (*Feedback, error) {
+			return &Feedback{
+				Email:        req.Email,
+				Description:  req.Description,
+				FeedbackType: req.FeedbackType,
+				MediaID:      req.MediaID,
+			}, nil
+		},
 		Resource: func(data *Feedback) *FeedbackResponse {
 			if data == nil {
 				return nil
@@ -61,6 +83,7 @@ func NewFeedbackCollection(provider *src.Provider, media *MediaCollection) (*Fee
 				ID:           data.ID,
 				CreatedAt:    data.CreatedAt.Format(time.RFC3339),
 				UpdatedAt:    data.UpdatedAt.Format(time.RFC3339),
+				Version:      data.Version,
 				MediaID:      data.MediaID,
 				Media:        media.Manager.ToModel(data.Media),
 				Email:        data.Email,
@@ -86,6 +109,18 @@ func NewFeedbackCollection(provider *src.Provider, media *MediaCollection) (*Fee
 				fmt.Sprintf("feedback.delete.%s", data.ID),
 			}
 		},
+		Restored: func(data *Feedback) []string {
+			return []string{
+				"feedback.restore",
+				fmt.Sprintf("feedback.restore.%s", data.ID),
+			}
+		},
+		ForceDeleted: func(data *Feedback) []string {
+			return []string{
+				"feedback.purge",
+				fmt.Sprintf("feedback.purge.%s", data.ID),
+			}
+		},
 	})
 	return &FeedbackCollection{
 		Manager: manager,
@@ -9,6 +9,7 @@ import (
 	horizon_services "github.com/lands-horizon/horizon-server/services"
 	"github.com/lands-horizon/horizon-server/services/horizon"
 	"github.com/lands-horizon/horizon-server/src"
+	"github.com/rotisserie/eris"
 	"gorm.io/gorm"
 )
 
@@ -19,6 +20,7 @@ type (
 		CreatedAt time.Time      `gorm:"not null;default:now()"`
 		UpdatedAt time.Time      `gorm:"not null;default:now()"`
 		DeletedAt gorm.DeletedAt `gorm:"index"`
+		Version   int64          `gorm:"not null;default:1"`
 
 		FileName   string `gorm:"type:varchar(2048);unsigned" json:"file_name"`
 		FileSize   int64  `gorm:"unsigned" json:"file_size"`
@@ -45,6 +47,7 @@ type (
 		BucketName  string    `json:"bucket_name"`
 		Status      string    `json:"status"`
 		Progress    int64     `json:"progress"`
+		Version     int64     `json:"version"`
 	}
 
 	MediaRequest struct {
@@ -59,38 +62,81 @@ type (
 
 func NewMediaCollection(provider *src.Provider) (*MediaCollection, error) {
 	manager := horizon_services.NewRepository(horizon_services.RepositoryParams[Media, MediaResponse, MediaRequest]{
-		Preloads: nil,
-		Service:  provider.Service,
+		Preloads:  nil,
+		Audit:     true,
+		Retention: provider.Service.Environment.GetDuration("TRASH_RETENTION", 30*24*time.Hour),
+		Cache: &horizon_services.CacheParams{
+			TTL:     10 * time.Minute,
+			ListTTL: time.Minute,
+			Topics:  []string{"media.create", "media.update", "media.delete", "media.restore", "media.purge"},
+		},
+		Service:    provider.Service,
+		Sortable:   []string{"created_at", "updated_at", "file_name", "file_size", "file_type", "status"},
+		Filterable: []string{"file_name", "file_type", "status", "created_at", "updated_at"},
+		Searchable: []string{"file_name"},
+		// Deleted media stay restorable until purged, so the stored file goes with the row
+		Hooks: horizon_services.Hooks[Media]{
+			AfterForceDelete: func(ctx context.Context, tx *gorm.DB, data *Media) error {
+				if data.StorageKey == "" {
+					return nil
+				}
+				storage := &horizon.Storage{
+					FileName:   data.FileName,
+					FileSize:   data.FileSize,
+					FileType:   data.FileType,
+					StorageKey: data.StorageKey,
+					URL:        data.URL,
+					BucketName: data.BucketName,
+					Status:     "delete",
+				}
+				uow, ok := horizon_services.UnitOfWorkFromContext(ctx)
+				if !ok {
+					return provider.Service.Storage.DeleteFile(ctx, storage)
+				}
+				// The file goes only once the row is gone for good
+				detached := context.WithoutCancel(ctx)
+				uow.AfterCommit(func() {
+					if err := provider.Service.Storage.DeleteFile(detached, storage); err != nil {
+						provider.Service.ReportError("", eris.Wrapf(err, "failed to delete file of media %s", data.ID))
+					}
+				})
+				return nil
+			},
+		},
 		Resource: func(data *Media) *MediaResponse {
 			if data == nil {
 				return nil
 			}
-			temporaryURL, err := provider.Service.Storage.GeneratePresignedURL(context.Background(), &horizon.Storage{
+			return &MediaResponse{
+				ID:         data.ID,
+				CreatedAt:  data.CreatedAt.Format(time.RFC3339),
+				UpdatedAt:  data.UpdatedAt.Format(time.RFC3339),
 				FileName:   data.FileName,
 				FileSize:   data.FileSize,
 				FileType:   data.FileType,
 				StorageKey: data.StorageKey,
+				URL:        data.URL,
+				Key:        data.Key,
 				BucketName: data.BucketName,
-			}, time.Minute*30)
-			if err != nil {
-				temporaryURL = ""
-			}
-			return &MediaResponse{
-				ID:          data.ID,
-				CreatedAt:   data.CreatedAt.Format(time.RFC3339),
-				UpdatedAt:   data.UpdatedAt.Format(time.RFC3339),
-				FileName:    data.FileName,
-				FileSize:    data.FileSize,
-				FileType:    data.FileType,
-				StorageKey:  data.StorageKey,
-				URL:         data.URL,
-				Key:         data.Key,
-				BucketName:  data.BucketName,
-				DownloadURL: temporaryURL,
-				Status:      data.Status,
-				Progress:    data.Progress,
+				Status:     data.Status,
+				Progress:   data.Progress,
+				Version:    data.Version,
 			}
 		},
+		Computed: map[string]func(*Media, *MediaResponse){
+			"download_url": func(data *Media, response *MediaResponse) {
+				temporaryURL, err := provider.Service.Storage.GeneratePresignedURL(context.Background(), &horizon.Storage{
+					FileName:   data.FileName,
+					FileSize:   data.FileSize,
+					FileType:   data.FileType,
+					StorageKey: data.StorageKey,
+					BucketName: data.BucketName,
+				}, time.Minute*30)
+				if err == nil {
+					response.DownloadURL = temporaryURL
+				}
+			},
+		},
 		Created: func(data *Media) []string {
 			return []string{
 				"media.create",
@@ -109,6 +155,18 @@ func NewMediaCollection(provider *src.Provider) (*MediaCollection, error) {
 				fmt.Sprintf("media.delete.%s", data.ID),
 			}
 		},
+		Restored: func(data *Media) []string {
+			return []string{
+				"media.restore",
+				fmt.Sprintf("media.restore.%s", data.ID),
+			}
+		},
+		ForceDeleted: func(data *Media) []string {
+			return []string{
+				"media.purge",
+				fmt.Sprintf("media.purge.%s", data.ID),
+			}
+		},
 	})
 	return &MediaCollection{
 		Manager: manager,
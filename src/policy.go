@@ -0,0 +1,19 @@
+package src
+
+import (
+	horizon_services "github.com/lands-horizon/horizon-server/services"
+	"github.com/lands-horizon/horizon-server/services/horizon"
+)
+
+// NewTopicPolicy declares the broker topics clients may follow. Collection wide
+// feedback topics carry the email of every submitter, so only administrators may
+// follow them; other users follow a feedback by its id.
+func NewTopicPolicy() horizon.TopicPolicy {
+	return horizon.NewHorizonTopicPolicy(
+		horizon.TopicRule{Pattern: horizon_services.TenantTopicPattern(">"), Require: horizon.ClaimUser | horizon.ClaimOrganization, Subscribe: true},
+		horizon.TopicRule{Pattern: horizon_services.UserTopicPattern(">"), Require: horizon.ClaimUser, Subscribe: true},
+		horizon.TopicRule{Pattern: "feedback.*", Require: horizon.ClaimUser | horizon.ClaimAdmin, Subscribe: true},
+		horizon.TopicRule{Pattern: "feedback.*.{id}", Require: horizon.ClaimUser, Subscribe: true},
+		horizon.TopicRule{Pattern: "media.>", Require: horizon.ClaimUser, Subscribe: true},
+	)
+}
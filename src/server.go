@@ -14,6 +14,7 @@ func NewProvider() *Provider {
 		EnvironmentConfig: &horizon_services.EnvironmentServiceConfig{
 			Path: "./.env",
 		},
+		TopicPolicy: NewTopicPolicy(),
 	})
 	return &Provider{
 		Service: horizonService,